@@ -1,14 +1,19 @@
 import os
 import re
 import json
+import time
+import uuid
+import logging
 import warnings
+from contextvars import ContextVar
 from collections import Counter
 
 import uvicorn
 import anthropic
-from fastapi import FastAPI, HTTPException
+from fastapi import FastAPI, HTTPException, Request
+from fastapi.responses import StreamingResponse
 from pydantic import BaseModel, Field
-from typing import List, Dict, Any
+from typing import List, Dict, Any, Optional
 
 import numpy as np
 from sklearn.cluster import KMeans
@@ -24,12 +29,104 @@ load_dotenv()
 
 app = FastAPI()
 
+# Go 서버가 보낸 X-Request-ID를 로그에 함께 남겨 두 서버의 로그를 연결합니다.
+request_id_var: ContextVar[str] = ContextVar("request_id", default="-")
+
+class RequestIDFilter(logging.Filter):
+    def filter(self, record):
+        if not hasattr(record, "request_id"):
+            record.request_id = request_id_var.get()
+        return True
+
+logger = logging.getLogger("ai_server")
+_handler = logging.StreamHandler()
+_handler.setFormatter(logging.Formatter("%(asctime)s %(levelname)s [%(request_id)s] %(message)s"))
+_handler.addFilter(RequestIDFilter())
+logger.addHandler(_handler)
+logger.setLevel(os.getenv("LOG_LEVEL", "INFO").upper())
+
+# OpenTelemetry 트레이싱 (선택): Go 서버가 보낸 traceparent 헤더를 이어받아
+# 같은 트레이스 안에 AI 서버 요청 스팬을 기록합니다.
+# OTEL_TRACES_EXPORTER=otlp|console 로 켜고, OTLP 수집기 주소는 OTEL_EXPORTER_OTLP_ENDPOINT로 지정합니다.
+def setup_tracing():
+    exporter_name = os.getenv("OTEL_TRACES_EXPORTER", "none").lower()
+    if exporter_name == "none":
+        return
+    try:
+        from opentelemetry import trace
+        from opentelemetry.sdk.resources import Resource
+        from opentelemetry.sdk.trace import TracerProvider
+        from opentelemetry.sdk.trace.export import BatchSpanProcessor, ConsoleSpanExporter
+        from opentelemetry.instrumentation.fastapi import FastAPIInstrumentor
+    except ImportError:
+        logger.warning("opentelemetry 패키지가 없어 트레이싱을 사용하지 않습니다.")
+        return
+
+    if exporter_name == "otlp":
+        from opentelemetry.exporter.otlp.proto.http.trace_exporter import OTLPSpanExporter
+        exporter = OTLPSpanExporter()
+    else:
+        exporter = ConsoleSpanExporter()
+
+    provider = TracerProvider(resource=Resource.create({
+        "service.name": os.getenv("OTEL_SERVICE_NAME", "acornhub-ai"),
+    }))
+    provider.add_span_processor(BatchSpanProcessor(exporter))
+    trace.set_tracer_provider(provider)
+    FastAPIInstrumentor.instrument_app(app)
+    logger.info(f"OpenTelemetry 트레이싱 활성화 (exporter={exporter_name})")
+
+setup_tracing()
+
+# 요청 하나에서 호출한 LLM의 토큰 수. Go 서버가 응답 헤더로 받아 사용자별 AI 사용량으로 기록합니다.
+token_usage_var: ContextVar[Optional[dict]] = ContextVar("token_usage", default=None)
+
+def new_token_usage() -> dict:
+    return {"input_tokens": 0, "output_tokens": 0}
+
+def add_token_usage(input_tokens, output_tokens, usage: Optional[dict] = None):
+    """LLM 호출 하나의 토큰 수를 usage(없으면 현재 요청의 사용량)에 더합니다."""
+    usage = usage if usage is not None else token_usage_var.get()
+    if usage is None: return
+    usage["input_tokens"] += input_tokens or 0
+    usage["output_tokens"] += output_tokens or 0
+
+def add_gemini_usage(response):
+    metadata = getattr(response, "usage_metadata", None)
+    if metadata:
+        add_token_usage(metadata.prompt_token_count, metadata.candidates_token_count)
+
+@app.middleware("http")
+async def request_id_middleware(request: Request, call_next):
+    request_id = request.headers.get("X-Request-ID") or uuid.uuid4().hex[:16]
+    token = request_id_var.set(request_id)
+    usage = new_token_usage()
+    usage_token = token_usage_var.set(usage)
+    start = time.perf_counter()
+    try:
+        response = await call_next(request)
+    finally:
+        request_id_var.reset(token)
+        token_usage_var.reset(usage_token)
+    response.headers["X-Request-ID"] = request_id
+    # 스트리밍 응답은 헤더를 먼저 보내므로 토큰 수를 usage 이벤트로 따로 알려 줍니다.
+    response.headers["X-AI-Input-Tokens"] = str(usage["input_tokens"])
+    response.headers["X-AI-Output-Tokens"] = str(usage["output_tokens"])
+    duration_ms = (time.perf_counter() - start) * 1000
+    logger.info("%s %s %d %.0fms", request.method, request.url.path, response.status_code, duration_ms,
+                extra={"request_id": request_id})
+    return response
+
 class Card(BaseModel):
     id: int
     content: str
 
+class ClusterCard(Card):
+    embedding: Optional[List[float]] = None  # Go 서버가 저장해 둔 임베딩
+
 class ClusterRequest(BaseModel):
-    cards: List[Card]
+    cards: List[ClusterCard]
+    num_clusters: Optional[int] = None  # 없으면 카드 수에 맞춰 정합니다
 
 class ClusterInfo(BaseModel):
     category_name: str
@@ -47,15 +144,29 @@ class TagGenerationResponse(BaseModel):
 class CategoryInfo(BaseModel):
     category_name: str
     card_ids: List[int]
+    # 하위 카테고리. card_ids에는 이 카테고리에 직접 속한 카드만 들어 있습니다.
+    children: List['CategoryInfo'] = []
+
+class ReportOptions(BaseModel):
+    # 보고서 템플릿/생성 옵션. 비어 있는 항목은 기본값을 사용합니다.
+    sections: List[str] = []
+    tone: str = ""
+    length: str = ""  # short | medium | long
+    language: str = ""
+    audience: str = ""
 
 class AgentInvokeRequest(BaseModel):
     topic: str
     all_tags: List[str]
     all_categories: List[CategoryInfo]
     all_cards: List[Card]
+    options: Optional[ReportOptions] = None
+    doc_type: str = "report"  # notes | outline | report
 
 class AgentInvokeResponse(BaseModel):
     report: str
+    # 에이전트가 search_cards로 실제로 읽은 카드 ID (출처 추적용)
+    card_ids: List[int] = []
 
 models = {}
 claude_client = None
@@ -64,35 +175,44 @@ claude_client = None
 def load_models():
     """서버 시작 시 AI 모델들을 로드합니다."""
     global claude_client
-    print("--- AI 모델 로딩 시작 ---")
+    logger.info("--- AI 모델 로딩 시작 ---")
     try:
         gemini_api_key = os.getenv("GEMINI_API_KEY")
         if gemini_api_key:
             models['gemini_client'] = genai.Client(api_key=gemini_api_key)
-            print("Gemini 클라이언트 초기화 완료.")
+            logger.info("Gemini 클라이언트 초기화 완료.")
         else:
-            print("경고: GEMINI_API_KEY가 없어 Gemini 관련 기능이 제한됩니다.")
+            logger.warning("GEMINI_API_KEY가 없어 Gemini 관련 기능이 제한됩니다.")
             models['gemini_client'] = None
 
         anthropic_api_key = os.getenv("ANTHROPIC_API_KEY")
         if anthropic_api_key:
             claude_client = anthropic.Anthropic(api_key=anthropic_api_key)
-            print("Anthropic (Claude) 클라이언트 초기화 완료.")
+            logger.info("Anthropic (Claude) 클라이언트 초기화 완료.")
         else:
-            print("경고: ANTHROPIC_API_KEY가 없어 Claude 관련 기능이 제한됩니다.")
+            logger.warning("ANTHROPIC_API_KEY가 없어 Claude 관련 기능이 제한됩니다.")
 
         models['okt'] = Okt()
-        print("Okt 형태소 분석기 초기화 완료.")
+        logger.info("Okt 형태소 분석기 초기화 완료.")
         models['keybert'] = KeyBERT('distiluse-base-multilingual-cased')
-        print("KeyBERT 모델 초기화 완료.")
+        logger.info("KeyBERT 모델 초기화 완료.")
         models['ner_pipeline'] = pipeline("ner", model="soddokayo/klue-roberta-large-klue-ner", aggregation_strategy="simple")
-        print("KLUE NER 모델 초기화 완료.")
+        logger.info("KLUE NER 모델 초기화 완료.")
         
-        print("--- 모든 AI 모델 로딩 완료 ---")
+        logger.info("--- 모든 AI 모델 로딩 완료 ---")
     except Exception as e:
-        print(f"모델 로딩 중 치명적인 오류 발생: {e}")
+        logger.error(f"모델 로딩 중 치명적인 오류 발생: {e}")
         raise e
 
+@app.get("/healthz")
+async def healthz():
+    """Go 서버의 /readyz 프로브가 AI 서버 접근 가능 여부를 확인하는 데 사용합니다."""
+    return {
+        "status": "ok",
+        "gemini": models.get('gemini_client') is not None,
+        "claude": claude_client is not None,
+    }
+
 def get_tags_by_frequency(text, n_tags=20):
     nouns = models['okt'].nouns(re.sub(r'[^가-힣A-Za-z0-9\s]', '', text))
     return [n for n, c in Counter(n for n in nouns if len(n) > 1).most_common(n_tags)]
@@ -108,14 +228,16 @@ def get_tags_by_okt_phrases(text, n_tags=20):
 def get_tags_by_ner(text):
     return [entity['word'].replace(" ", "") for entity in models['ner_pipeline'](text)]
 
-def get_embeddings(texts: List[str]):
+EMBEDDING_MODEL = "gemini-embedding-001"
+
+def get_embeddings(texts: List[str], model: str = EMBEDDING_MODEL):
     gemini_client = models.get('gemini_client')
     if not gemini_client:
-        print("임베딩 오류: Gemini 클라이언트가 없습니다.")
+        logger.error("임베딩 오류: Gemini 클라이언트가 없습니다.")
         return None
     try:
         result = gemini_client.models.embed_content(
-            model="gemini-embedding-001",
+            model=model,
             contents=texts
         )
 
@@ -123,7 +245,7 @@ def get_embeddings(texts: List[str]):
         return np.array(embedding_list)
     
     except Exception as e:
-        print(f"임베딩 생성 중 오류: {e}")
+        logger.error(f"임베딩 생성 중 오류: {e}")
         return None
 
 def name_clusters_with_llm(grouped_texts: Dict[int, List[str]]):
@@ -132,7 +254,7 @@ def name_clusters_with_llm(grouped_texts: Dict[int, List[str]]):
     if not gemini_client: return {i: f"카테고리 {i+1}" for i in grouped_texts.keys()}
     
     for cluster_id, texts in grouped_texts.items():
-        print(f"\n--- 클러스터 {cluster_id}의 카테고리 이름 생성 중... ---")
+        logger.info(f"--- 클러스터 {cluster_id}의 카테고리 이름 생성 중... ---")
         content_for_prompt = "\n".join([f"- {text}" for text in texts])
         prompt = f"""
         다음은 하나의 그룹으로 묶인 문서들입니다.
@@ -145,11 +267,12 @@ def name_clusters_with_llm(grouped_texts: Dict[int, List[str]]):
         """
         try:
             response = gemini_client.models.generate_content(model="gemini-2.5-flash", contents=prompt)
+            add_gemini_usage(response)
             cluster_name = response.text.strip().replace("*", "")
             cluster_names[cluster_id] = cluster_name
-            print(f"생성된 이름: {cluster_name}")
+            logger.info(f"생성된 이름: {cluster_name}")
         except Exception as e:
-            print(f"LLM 호출 중 오류: {e}")
+            logger.error(f"LLM 호출 중 오류: {e}")
             cluster_names[cluster_id] = f"카테고리 {cluster_id}"
     
     return cluster_names
@@ -181,6 +304,7 @@ async def generate_tags(request: TagGenerationRequest):
 
     try:
         response = models['gemini_client'].models.generate_content(model="gemini-2.5-flash", contents=prompt)
+        add_gemini_usage(response)
         
         if "없음" in response.text:
             return {"tags": []}
@@ -188,21 +312,41 @@ async def generate_tags(request: TagGenerationRequest):
         final_tags = [tag.strip() for tag in response.text.split(',')]
         return {"tags": final_tags}
     except Exception as e:
-        print(f"태그 생성 LLM 호출 오류: {e}")
+        logger.error(f"태그 생성 LLM 호출 오류: {e}")
         # LLM 실패 시, 후보군 중 일부를 그냥 반환
         return {"tags": candidate_tags[:max_tags]}
 
+class EmbedRequest(BaseModel):
+    texts: List[str]
+    model: Optional[str] = None
+
+@app.post("/embeddings")
+def embed_texts(request: EmbedRequest):
+    """Go 서버가 저장해 두고 쓰는 카드 임베딩. 응답의 model과 함께 저장됩니다."""
+    model = request.model or EMBEDDING_MODEL
+    if not request.texts:
+        return {"model": model, "embeddings": []}
+    vectors = get_embeddings(request.texts, model)
+    if vectors is None: raise HTTPException(status_code=500, detail="임베딩 생성 실패.")
+    return {"model": model, "embeddings": vectors.tolist()}
+
 @app.post("/cards/cluster", response_model=ClusterResponse)
 async def cluster_cards(request: ClusterRequest):
     cards = request.cards
     if len(cards) < 2: return {"clusters": [{"category_name": "미분류", "card_ids": [c.id for c in cards]}]}
 
     card_contents = [card.content for card in cards]
-    card_vectors = get_embeddings(card_contents)
+    if all(card.embedding for card in cards):
+        card_vectors = np.array([card.embedding for card in cards])
+    else:
+        card_vectors = get_embeddings(card_contents)
     if card_vectors is None: raise HTTPException(status_code=500, detail="카드 벡터 임베딩 생성 실패.")
         
-    num_clusters = min(len(cards) // 2, 5)
-    if num_clusters < 2: num_clusters = 2
+    if request.num_clusters:
+        num_clusters = min(request.num_clusters, len(cards))
+    else:
+        num_clusters = min(len(cards) // 2, 5)
+        if num_clusters < 2: num_clusters = 2
     
     kmeans = KMeans(n_clusters=num_clusters, random_state=42, n_init='auto')
     cluster_labels = kmeans.fit_predict(card_vectors)
@@ -223,70 +367,282 @@ async def cluster_cards(request: ClusterRequest):
 
 card_db_for_agent = {}
 
+def subtree_card_ids(cat_info: Dict) -> list[int]:
+    """카테고리와 모든 하위 카테고리의 카드 ID"""
+    ids = list(cat_info['card_ids'])
+    for child in cat_info.get('children') or []:
+        ids.extend(subtree_card_ids(child))
+    return ids
+
+def category_paths(categories: List[CategoryInfo], prefix: str = "") -> list[str]:
+    """카테고리 트리를 "상위 > 하위" 경로 목록으로 펼칩니다."""
+    paths = []
+    for cat in categories:
+        path = f"{prefix} > {cat.category_name}" if prefix else cat.category_name
+        paths.append(path)
+        paths.extend(category_paths(cat.children, path))
+    return paths
+
 def search_cards_for_agent(categories: list[str], all_categories: List[Dict]) -> list[dict]:
-    print(f"\n[Tool Call] search_cards(categories={categories})")
+    logger.info(f"[Tool Call] search_cards(categories={categories})")
     found_card_ids = set()
-    if categories and all_categories:
-        for cat_info in all_categories:
-            if cat_info['category_name'] in categories:
-                found_card_ids.update(cat_info['card_ids'])
+    # 경로("상위 > 하위")로 불러도 마지막 이름으로 찾고, 상위 카테고리를 고르면 하위 카테고리 카드도 함께 찾습니다.
+    wanted = {c.split('>')[-1].strip() for c in categories or []}
+    stack = list(all_categories or [])
+    while stack:
+        cat_info = stack.pop()
+        if cat_info['category_name'] in wanted:
+            found_card_ids.update(subtree_card_ids(cat_info))
+        stack.extend(cat_info.get('children') or [])
     
     results = [{"id": cid, "content": card_db_for_agent.get(cid, "내용 없음")} for cid in found_card_ids]
-    print(f"[Tool Result] Found {len(results)} cards.")
+    logger.info(f"[Tool Result] Found {len(results)} cards.")
     return results
 
-@app.post("/agent/invoke", response_model=AgentInvokeResponse)
-async def invoke_agent(request: AgentInvokeRequest):
-    if not claude_client: raise HTTPException(status_code=503, detail="Claude 모델이 로드되지 않았습니다.")
-
-    global card_db_for_agent
-    card_db_for_agent = {card.id: card.content for card in request.all_cards}
-
-    tools = [{"name": "search_cards", "description": "관련 카드 내용을 검색합니다.", "input_schema": {
-        "type": "object", "properties": {
-            "categories": {"type": "array", "items": {"type": "string"}, "description": "검색할 카테고리 이름 목록"}
-        }, "required": ["categories"]
-    }}]
-
-    prompt = f"""당신은 전문 보고서 작성 AI 에이전트입니다.
-    ## 최종 목표: '{request.topic}'에 대한 보고서 초안을 '개요', '서론', '본론', '결론' 구조로 **HTML 형식**으로 작성하세요.
-    - 각 섹션 제목('개요', '서론', '본론', '결론')은 `<h2>` 태그로 감싸세요.
-    - 모든 문단은 `<p>` 태그로 감싸세요.
+AGENT_TOOLS = [{"name": "search_cards", "description": "관련 카드 내용을 검색합니다.", "input_schema": {
+    "type": "object", "properties": {
+        "categories": {"type": "array", "items": {"type": "string"}, "description": "검색할 카테고리 이름 목록"}
+    }, "required": ["categories"]
+}}]
+AGENT_MODEL = "claude-sonnet-4-5-20250929"
+AGENT_MAX_TURNS = 3
+
+DEFAULT_REPORT_SECTIONS = ["개요", "서론", "본론", "결론"]
+REPORT_LENGTH_GUIDE = {
+    "short": "A4 1쪽 내외로 핵심만 간결하게",
+    "medium": "A4 2~3쪽 분량으로",
+    "long": "A4 5쪽 이상으로 자세하게",
+}
+
+def build_format_guide(options: Optional[ReportOptions]) -> str:
+    """템플릿/생성 옵션 중 섹션 이외의 항목을 프롬프트 지침으로 만듭니다."""
+    if not options:
+        return ""
+    lines = []
+    if options.tone:
+        lines.append(f"- 어조: {options.tone}")
+    if options.length in REPORT_LENGTH_GUIDE:
+        lines.append(f"- 분량: {REPORT_LENGTH_GUIDE[options.length]} 작성하세요.")
+    if options.language:
+        lines.append(f"- 작성 언어: {options.language} (섹션 제목도 이 언어로 작성하세요)")
+    if options.audience:
+        lines.append(f"- 대상 독자: {options.audience}")
+    if not lines:
+        return ""
+    return "## 작성 형식:\n    " + "\n    ".join(lines) + "\n    "
+
+def build_doc_type_goal(request: AgentInvokeRequest) -> str:
+    """문서 종류(doc_type)에 맞는 최종 목표와 구조 지침을 만듭니다."""
+    sections = (request.options and request.options.sections) or DEFAULT_REPORT_SECTIONS
+    section_list = ", ".join(f"'{s}'" for s in sections)
+    if request.doc_type == "notes":
+        return f"""## 최종 목표: '{request.topic}'에 대해 카드에서 찾은 핵심 사실을 정리한 메모를 **HTML 형식**으로 작성하세요.
+    - 핵심 사실은 `<ul><li>` 글머리 기호로 짧게 정리하고, 주제별로 묶을 때는 `<h3>` 제목을 사용하세요."""
+    if request.doc_type == "outline":
+        return f"""## 최종 목표: '{request.topic}'에 대한 보고서 개요를 {section_list} 구조로 **HTML 형식**으로 작성하세요.
+    - 각 섹션 제목({section_list})은 `<h2>` 태그로 감싸세요.
+    - 각 섹션 아래에는 다룰 핵심 항목만 `<ul><li>`로 짧게 나열하고, 문단은 쓰지 마세요."""
+    return f"""## 최종 목표: '{request.topic}'에 대한 보고서 초안을 {section_list} 구조로 **HTML 형식**으로 작성하세요.
+    - 각 섹션 제목({section_list})은 `<h2>` 태그로 감싸세요.
+    - 모든 문단은 `<p>` 태그로 감싸세요."""
+
+def build_agent_prompt(request: AgentInvokeRequest) -> str:
+    return f"""당신은 전문 보고서 작성 AI 에이전트입니다.
+    {build_doc_type_goal(request)}
     - 최종 결과물은 앞 뒤 다른 설명 없이 완전한 HTML 코드여야 합니다.
     - 다만, html 에서 head, body 등의 태그는 제외하며, 오직 내용 부분만 작성하세요.
     ## 사용 가능 정보:
     - 전체 태그: {request.all_tags}
-    - 전체 카테고리: {[cat.category_name for cat in request.all_categories]}
-    ## 작업 절차:
+    - 전체 카테고리(상위 > 하위): {category_paths(request.all_categories)}
+    {build_format_guide(request.options)}## 작업 절차:
     1. 주제와 가장 관련 높은 카테고리를 선택해 `search_cards` 함수로 정보를 수집.
     2. 수집된 정보들을 종합하여 최종 보고서를 논리적인 HTML 형식으로 작성. 보고서 외 불필요한 설명은 제외.
+    ## 출처 표시:
+    - 카드 내용을 근거로 쓴 문장 끝에는 해당 카드의 id를 `[card:id]` 형식으로 표시하세요. 예: `...입니다.[card:12]`
+    - 여러 카드를 근거로 했다면 `[card:12,15]`처럼 쉼표로 구분하세요.
+    - `search_cards`로 검색한 카드의 id만 사용하고, id를 지어내지 마세요.
     """
+
+def run_agent_tools(response, request: AgentInvokeRequest) -> tuple[list[dict], list[dict]]:
+    """응답의 tool_use 블록을 실행해 (tool_result 목록, 검색 진행 정보 목록)을 반환합니다."""
+    tool_results, searches = [], []
+    for tool_block in [b for b in response.content if b.type == "tool_use"]:
+        if tool_block.name == "search_cards":
+            categories = tool_block.input.get("categories")
+            result = search_cards_for_agent(
+                categories=categories,
+                all_categories=[c.dict() for c in request.all_categories]
+            )
+            searches.append({"categories": categories or [], "found": len(result), "card_ids": [c["id"] for c in result]})
+            tool_results.append({"type": "tool_result", "tool_use_id": tool_block.id, "content": json.dumps(result, ensure_ascii=False)})
+    return tool_results, searches
+
+def run_agent(request: AgentInvokeRequest, prompt: str) -> dict:
+    """프롬프트로 에이전트를 실행하고 {"report", "card_ids"}를 반환합니다."""
+    if not claude_client: raise HTTPException(status_code=503, detail="Claude 모델이 로드되지 않았습니다.")
+
+    global card_db_for_agent
+    card_db_for_agent = {card.id: card.content for card in request.all_cards}
+
     messages = [{"role": "user", "content": prompt}]
+    retrieved_ids = set()
     
     try:
-        for _ in range(3):
+        for _ in range(AGENT_MAX_TURNS):
             response = claude_client.messages.create(
-                model="claude-sonnet-4-5-20250929", max_tokens=4096, tools=tools, messages=messages
+                model=AGENT_MODEL, max_tokens=4096, tools=AGENT_TOOLS, messages=messages
             )
+            add_token_usage(response.usage.input_tokens, response.usage.output_tokens)
             messages.append({"role": "assistant", "content": response.content})
             if response.stop_reason != "tool_use": break
 
-            tool_results = []
-            for tool_block in [b for b in response.content if b.type == "tool_use"]:
-                if tool_block.name == "search_cards":
-                    result = search_cards_for_agent(
-                        categories=tool_block.input.get("categories"),
-                        all_categories=[c.dict() for c in request.all_categories]
-                    )
-                    tool_results.append({"type": "tool_result", "tool_use_id": tool_block.id, "content": json.dumps(result, ensure_ascii=False)})
+            tool_results, searches = run_agent_tools(response, request)
+            for search in searches:
+                retrieved_ids.update(search["card_ids"])
             messages.append({"role": "user", "content": tool_results})
 
         final_text = next((b.text for b in response.content if b.type == 'text'), "최종 보고서를 생성하지 못했습니다.")
-        return {"report": final_text}
+        return {"report": final_text, "card_ids": sorted(retrieved_ids)}
     except Exception as e:
-        print(f"Claude 에이전트 실행 중 오류: {e}")
+        logger.error(f"Claude 에이전트 실행 중 오류: {e}")
         raise HTTPException(status_code=500, detail=f"AI 에이전트 실행 중 오류 발생: {e}")
 
+@app.post("/agent/invoke", response_model=AgentInvokeResponse)
+def invoke_agent(request: AgentInvokeRequest):
+    return run_agent(request, build_agent_prompt(request))
+
+class SectionRequest(AgentInvokeRequest):
+    # 문서 전체 중 섹션 하나만 다시 쓰거나(regenerate) 내용을 보강(expand)합니다.
+    mode: str = "regenerate"  # regenerate | expand
+    format: str = "html"  # html | markdown
+    document: str
+    section_title: str
+    section_content: str
+    instruction: str = ""
+
+def build_section_prompt(request: SectionRequest) -> str:
+    if request.mode == "expand":
+        goal = "기존 섹션 내용을 유지하면서 카드에서 찾은 근거와 설명을 더해 더 자세하게 보강하세요."
+    else:
+        goal = "기존 섹션 내용을 참고하되 카드에서 찾은 근거로 섹션 본문을 새로 작성하세요."
+    if request.format == "markdown":
+        format_rule = "Markdown으로 작성하고, 섹션 제목과 같거나 높은 수준의 제목(#)은 쓰지 마세요. 하위 제목은 사용할 수 있습니다."
+    else:
+        format_rule = "HTML로 작성하고(문단은 `<p>`), 섹션 제목과 같거나 높은 수준의 제목 태그는 쓰지 마세요. head, body 등의 태그는 제외합니다."
+    instruction = f"\n    ## 사용자 요청:\n    {request.instruction}" if request.instruction else ""
+    return f"""당신은 전문 보고서 작성 AI 에이전트입니다.
+    '{request.topic}' 보고서의 '{request.section_title}' 섹션을 수정합니다.
+    ## 목표: {goal}{instruction}
+    ## 출력 형식:
+    - 섹션 제목을 제외한 **본문만** 출력하세요. 앞뒤 다른 설명은 쓰지 마세요.
+    - {format_rule}
+    {build_format_guide(request.options)}## 사용 가능 정보:
+    - 전체 태그: {request.all_tags}
+    - 전체 카테고리(상위 > 하위): {category_paths(request.all_categories)}
+    - 필요한 정보는 `search_cards` 함수로 관련 카테고리의 카드를 검색해 수집하세요.
+    ## 출처 표시:
+    - 카드 내용을 근거로 쓴 문장 끝에는 해당 카드의 id를 `[card:id]` 형식으로 표시하세요. 여러 카드는 `[card:12,15]`처럼 쉼표로 구분하세요.
+    - `search_cards`로 검색한 카드의 id만 사용하고, id를 지어내지 마세요.
+    ## 현재 섹션 본문:
+    {request.section_content}
+    ## 문서 전체 (다른 섹션과 내용이 겹치지 않게 참고하세요):
+    {request.document}
+    """
+
+@app.post("/agent/section", response_model=AgentInvokeResponse)
+def regenerate_section(request: SectionRequest):
+    return run_agent(request, build_section_prompt(request))
+
+DOC_TYPE_NAMES = {"notes": "메모", "outline": "개요", "report": "보고서"}
+
+class ExpandRequest(AgentInvokeRequest):
+    # 사용자가 직접 쓴 문서(source_type)를 바탕으로 doc_type 문서를 새로 씁니다.
+    format: str = "html"  # 기존 문서 형식 (html | markdown)
+    document: str
+    source_type: str = "notes"
+    instruction: str = ""
+
+def build_expand_prompt(request: ExpandRequest) -> str:
+    source = DOC_TYPE_NAMES.get(request.source_type, "문서")
+    target = DOC_TYPE_NAMES.get(request.doc_type, "보고서")
+    source_format = "Markdown" if request.format == "markdown" else "HTML"
+    instruction = f"\n    ## 사용자 요청:\n    {request.instruction}" if request.instruction else ""
+    return f"""당신은 전문 보고서 작성 AI 에이전트입니다.
+    사용자가 직접 작성한 {source}({source_format})를 바탕으로 {target}를 작성합니다.
+    - 사용자가 쓴 내용과 구조, 주장을 최대한 살리고, 부족한 근거와 설명은 `search_cards`로 찾은 카드로 보강하세요.
+    - 사용자가 쓴 제목(섹션)이 있으면 아래 구조 지침보다 사용자의 구조를 우선해 그대로 유지하세요.{instruction}
+    {build_doc_type_goal(request)}
+    - 최종 결과물은 앞 뒤 다른 설명 없이 완전한 HTML 코드여야 합니다.
+    - 다만, html 에서 head, body 등의 태그는 제외하며, 오직 내용 부분만 작성하세요.
+    ## 사용 가능 정보:
+    - 전체 태그: {request.all_tags}
+    - 전체 카테고리(상위 > 하위): {category_paths(request.all_categories)}
+    {build_format_guide(request.options)}## 출처 표시:
+    - 카드 내용을 근거로 쓴 문장 끝에는 해당 카드의 id를 `[card:id]` 형식으로 표시하세요. 여러 카드는 `[card:12,15]`처럼 쉼표로 구분하세요.
+    - `search_cards`로 검색한 카드의 id만 사용하고, id를 지어내지 마세요.
+    ## 사용자가 작성한 {source}:
+    {request.document}
+    """
+
+@app.post("/agent/expand", response_model=AgentInvokeResponse)
+def expand_document(request: ExpandRequest):
+    return run_agent(request, build_expand_prompt(request))
+
+def sse_event(event: str, data: dict) -> str:
+    return f"event: {event}\ndata: {json.dumps(data, ensure_ascii=False)}\n\n"
+
+@app.post("/agent/stream")
+def stream_agent(request: AgentInvokeRequest):
+    """/agent/invoke와 같은 작업을 Server-Sent Events로 중계합니다.
+
+    이벤트 종류:
+    - progress: {"stage": "thinking"|"searching"|"writing", "categories": [...], "found": n, "card_ids": [...]}
+    - token: {"text": "..."} 생성 중인 보고서 조각
+    - reset: {} 직전까지 보낸 token이 도구 호출 전 중간 응답이었으므로 버려야 함
+    - usage: {"input_tokens": n, "output_tokens": n} 스트림 전체의 토큰 수 (done 또는 error 직전)
+    - done: {"report": "...", "card_ids": [...]} 최종 보고서 전체와 에이전트가 읽은 카드 ID
+    - error: {"detail": "..."}
+    """
+    if not claude_client: raise HTTPException(status_code=503, detail="Claude 모델이 로드되지 않았습니다.")
+
+    global card_db_for_agent
+    card_db_for_agent = {card.id: card.content for card in request.all_cards}
+
+    def events():
+        messages = [{"role": "user", "content": build_agent_prompt(request)}]
+        retrieved_ids = set()
+        usage = new_token_usage()
+        try:
+            for turn in range(AGENT_MAX_TURNS):
+                yield sse_event("progress", {"stage": "thinking" if turn == 0 else "writing"})
+                with claude_client.messages.stream(
+                    model=AGENT_MODEL, max_tokens=4096, tools=AGENT_TOOLS, messages=messages
+                ) as stream:
+                    for text in stream.text_stream:
+                        yield sse_event("token", {"text": text})
+                    response = stream.get_final_message()
+                add_token_usage(response.usage.input_tokens, response.usage.output_tokens, usage)
+
+                messages.append({"role": "assistant", "content": response.content})
+                if response.stop_reason != "tool_use": break
+
+                yield sse_event("reset", {})
+                tool_results, searches = run_agent_tools(response, request)
+                for search in searches:
+                    retrieved_ids.update(search["card_ids"])
+                    yield sse_event("progress", {"stage": "searching", **search})
+                messages.append({"role": "user", "content": tool_results})
+
+            final_text = next((b.text for b in response.content if b.type == 'text'), "최종 보고서를 생성하지 못했습니다.")
+            yield sse_event("usage", usage)
+            yield sse_event("done", {"report": final_text, "card_ids": sorted(retrieved_ids)})
+        except Exception as e:
+            logger.error(f"Claude 에이전트 스트리밍 중 오류: {e}")
+            yield sse_event("usage", usage)
+            yield sse_event("error", {"detail": f"AI 에이전트 실행 중 오류 발생: {e}"})
+
+    return StreamingResponse(events(), media_type="text/event-stream", headers={"Cache-Control": "no-cache"})
+
 if __name__ == "__main__":
     print("AI 서버를 시작합니다. http://127.0.0.1:8000 에서 실행됩니다.")
     uvicorn.run(app, host="0.0.0.0", port=8000)
\ No newline at end of file
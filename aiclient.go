@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// aiStatusError는 AI 서버가 200이 아닌 상태 코드를 반환했을 때의 오류입니다.
+type aiStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *aiStatusError) Error() string {
+	return fmt.Sprintf("AI 서버 오류 (상태 코드: %d): %s", e.StatusCode, e.Body)
+}
+
+// aiEndpointPolicy는 AI 엔드포인트별 호출 정책입니다.
+// 같은 입력에 대해 다시 계산해도 부작용이 없는 엔드포인트만 idempotent로 표시해 재시도합니다.
+type aiEndpointPolicy struct {
+	timeout    time.Duration
+	idempotent bool
+}
+
+func aiPolicy(path string) aiEndpointPolicy {
+	switch path {
+	case "/tags/generate":
+		return aiEndpointPolicy{timeout: cfg.AI.TagsTimeout, idempotent: true}
+	case "/cards/cluster":
+		return aiEndpointPolicy{timeout: cfg.AI.ClusterTimeout, idempotent: true}
+	case "/embeddings":
+		return aiEndpointPolicy{timeout: cfg.AI.DefaultTimeout, idempotent: true}
+	case "/agent/invoke", "/agent/section", "/agent/expand":
+		// 보고서 생성은 비용이 크고 오래 걸리므로 재시도하지 않습니다.
+		return aiEndpointPolicy{timeout: cfg.AI.AgentTimeout}
+	case "/agent/stream":
+		return aiEndpointPolicy{timeout: cfg.AI.StreamTimeout}
+	default:
+		return aiEndpointPolicy{timeout: cfg.AI.DefaultTimeout}
+	}
+}
+
+// aiBreaker는 모든 AI 엔드포인트가 공유하는 회로 차단기입니다.
+// AI 서버 프로세스 하나가 모든 엔드포인트를 처리하므로 한 곳의 장애는 전체 장애로 간주합니다.
+var aiBreaker *circuitBreaker
+
+// aiUnavailableError는 회로가 열려 있어 호출하지 않았을 때 반환됩니다.
+type aiUnavailableError struct {
+	RetryAfter time.Duration
+}
+
+func (e *aiUnavailableError) Error() string {
+	return errCircuitOpen.Error()
+}
+
+func (e *aiUnavailableError) Unwrap() error {
+	return errCircuitOpen
+}
+
+// aiPost는 AI 서버의 path로 in을 JSON으로 보내고, 응답 본문을 out에 디코딩합니다.
+// ctx에 요청 ID가 있으면 X-Request-ID 헤더로 함께 전달해 두 서버의 로그를 연결하고,
+// 호출마다 클라이언트 스팬을 만들어 traceparent 헤더로 AI 서버 스팬과 같은 트레이스에 묶습니다.
+//
+// 각 시도는 엔드포인트별 타임아웃과 ctx(요청이 끊기면 취소됨) 중 먼저 끝나는 쪽에 묶이며,
+// idempotent 엔드포인트는 연결 오류나 5xx 응답일 때 지수 백오프로 재시도합니다.
+// 회로 차단기가 열려 있으면 AI 서버를 호출하지 않고 *aiUnavailableError를 즉시 반환합니다.
+// 사용자가 오늘 AI 사용 한도를 넘었으면 *aiQuotaError를 반환하고, 시도마다 사용량을 기록합니다.
+func aiPost(ctx context.Context, path string, in, out interface{}) (err error) {
+	ctx, span := tracer.Start(ctx, "AI POST "+path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String("POST"),
+			semconv.URLFull(cfg.AI.ServerURL+path),
+		),
+	)
+	defer func() { endSpan(span, err) }()
+
+	reqBytes, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("AI 요청 JSON 직렬화 실패: %w", err)
+	}
+
+	if err := checkAIQuota(ctx); err != nil {
+		observeAIRequest(path, time.Now(), err)
+		return err
+	}
+
+	policy := aiPolicy(path)
+	attempts := 1
+	if policy.idempotent {
+		attempts += cfg.AI.MaxRetries
+	}
+
+	backoff := cfg.AI.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		if ok, retryAfter := aiBreaker.allow(); !ok {
+			observeAIRequest(path, time.Now(), errCircuitOpen)
+			return &aiUnavailableError{RetryAfter: retryAfter}
+		}
+
+		start := time.Now()
+		var tokens aiTokens
+		tokens, err = aiPostOnce(ctx, path, policy.timeout, reqBytes, out)
+		observeAIRequest(path, start, err)
+		recordAIUsage(requestInfoFrom(ctx), path, len(reqBytes), time.Since(start), tokens, err)
+
+		switch {
+		case err == nil:
+			aiBreaker.success()
+			return nil
+		case ctx.Err() != nil:
+			// 호출한 쪽이 요청을 취소했으므로 AI 서버 상태는 판단하지 않습니다.
+			aiBreaker.release()
+			return err
+		case isAIServerFailure(err):
+			aiBreaker.failure()
+		default:
+			// 4xx처럼 요청 자체가 잘못된 경우는 AI 서버 장애로 보지 않고 재시도하지도 않습니다.
+			aiBreaker.success()
+			return err
+		}
+
+		if attempt >= attempts {
+			return err
+		}
+		span.AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", attempt), attribute.String("error", err.Error())))
+
+		// 백오프에 ±50% 지터를 더해 여러 요청이 동시에 재시도하지 않게 합니다.
+		wait := backoff/2 + time.Duration(rand.Int64N(int64(backoff)+1))
+		backoff *= 2
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// aiPostOnce는 AI 서버를 한 번 호출하고, 응답 헤더로 받은 토큰 수를 반환합니다.
+func aiPostOnce(ctx context.Context, path string, timeout time.Duration, reqBytes []byte, out interface{}) (aiTokens, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", cfg.AI.ServerURL+path, bytes.NewReader(reqBytes))
+	if err != nil {
+		return aiTokens{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if id := requestIDFrom(ctx); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return aiTokens{}, fmt.Errorf("AI 서버 응답 시간 초과 (%s): %w", timeout, err)
+		}
+		return aiTokens{}, err
+	}
+	defer resp.Body.Close()
+	trace.SpanFromContext(ctx).SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	tokens := tokensFromHeader(resp.Header)
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return tokens, &aiStatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return tokens, fmt.Errorf("AI 응답 JSON 디코딩 실패: %w", err)
+	}
+	return tokens, nil
+}
+
+// aiEventStream은 AI 서버의 SSE 응답 스트림입니다. 다 읽은 뒤 반드시 close를 호출해야 합니다.
+type aiEventStream struct {
+	path   string
+	start  time.Time
+	body   io.ReadCloser
+	span   trace.Span
+	cancel context.CancelFunc
+
+	// 사용량 기록용: 호출한 요청의 정보, 요청 크기, usage 이벤트로 받은 토큰 수
+	info       *requestInfo
+	inputBytes int
+	tokens     aiTokens
+}
+
+// aiOpenStream은 AI 서버의 SSE 엔드포인트(path)에 in을 보내고 200 응답을 받을 때까지 기다립니다.
+// 회로 차단기와 요청 ID·traceparent 전달은 aiPost와 같고, 스트림은 재시도하지 않습니다.
+// 응답 헤더를 받은 뒤의 오류(스트림 도중 끊김)는 AI 서버 장애로 집계하지 않습니다.
+func aiOpenStream(ctx context.Context, path string, in interface{}) (*aiEventStream, error) {
+	ctx, span := tracer.Start(ctx, "AI POST "+path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String("POST"),
+			semconv.URLFull(cfg.AI.ServerURL+path),
+		),
+	)
+	start := time.Now()
+	fail := func(err error) (*aiEventStream, error) {
+		observeAIRequest(path, start, err)
+		endSpan(span, err)
+		return nil, err
+	}
+
+	reqBytes, err := json.Marshal(in)
+	if err != nil {
+		return fail(fmt.Errorf("AI 요청 JSON 직렬화 실패: %w", err))
+	}
+
+	if err := checkAIQuota(ctx); err != nil {
+		return fail(err)
+	}
+	if ok, retryAfter := aiBreaker.allow(); !ok {
+		return fail(&aiUnavailableError{RetryAfter: retryAfter})
+	}
+
+	timeout := aiPolicy(path).timeout
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	req, err := http.NewRequestWithContext(ctx, "POST", cfg.AI.ServerURL+path, bytes.NewReader(reqBytes))
+	if err != nil {
+		cancel()
+		aiBreaker.release()
+		return fail(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	if id := requestIDFrom(ctx); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		err = &aiStatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+	if err != nil {
+		cancel()
+		switch {
+		case ctx.Err() != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded):
+			aiBreaker.release()
+		case isAIServerFailure(err):
+			aiBreaker.failure()
+		default:
+			aiBreaker.success()
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("AI 서버 응답 시간 초과 (%s): %w", timeout, err)
+		}
+		recordAIUsage(requestInfoFrom(ctx), path, len(reqBytes), time.Since(start), aiTokens{}, err)
+		return fail(err)
+	}
+
+	aiBreaker.success()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	return &aiEventStream{
+		path: path, start: start, body: resp.Body, span: span, cancel: cancel,
+		info: requestInfoFrom(ctx), inputBytes: len(reqBytes),
+	}, nil
+}
+
+// each는 스트림이 끝나거나 fn이 오류를 반환할 때까지 이벤트마다 fn을 호출합니다.
+// usage 이벤트는 사용량 기록에만 쓰고 fn에는 넘기지 않습니다.
+func (s *aiEventStream) each(fn func(event, data string) error) error {
+	return readSSE(s.body, func(event, data string) error {
+		if event == aiUsageEvent {
+			json.Unmarshal([]byte(data), &s.tokens)
+			return nil
+		}
+		return fn(event, data)
+	})
+}
+
+// close는 AI 서버와의 연결을 끊고 스트림 전체의 결과(err)를 메트릭, 스팬, AI 사용량에 기록합니다.
+func (s *aiEventStream) close(err error) {
+	s.cancel()
+	s.body.Close()
+	observeAIRequest(s.path, s.start, err)
+	recordAIUsage(s.info, s.path, s.inputBytes, time.Since(s.start), s.tokens, err)
+	endSpan(s.span, err)
+}
+
+// isAIServerFailure는 오류가 AI 서버 장애(연결 실패, 타임아웃, 5xx)인지 판단합니다.
+func isAIServerFailure(err error) bool {
+	var statusErr *aiStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	return true
+}
+
+// writeAIError는 AI 호출 실패를 사용자가 이해할 수 있는 응답으로 변환합니다.
+// feature는 실패한 기능 이름(예: "카드 클러스터링")입니다.
+func writeAIError(w http.ResponseWriter, r *http.Request, feature string, err error) {
+	var unavailable *aiUnavailableError
+	var quota *aiQuotaError
+	var statusErr *aiStatusError
+	switch {
+	case errors.As(err, &quota):
+		w.Header().Set("Retry-After", strconv.Itoa(int(quota.RetryAfter.Seconds())+1))
+		httpError(w, r, feature+" 기능을 사용할 수 없습니다: "+quota.Error()+". 한도는 UTC 자정에 초기화됩니다.", http.StatusTooManyRequests)
+	case errors.As(err, &unavailable):
+		w.Header().Set("Retry-After", strconv.Itoa(int(unavailable.RetryAfter.Seconds())+1))
+		httpError(w, r, feature+" 기능을 일시적으로 사용할 수 없습니다. AI 서버가 응답하지 않아 잠시 후 다시 시도해주세요.", http.StatusServiceUnavailable)
+	case errors.Is(err, context.DeadlineExceeded):
+		httpError(w, r, feature+" 요청이 시간 내에 완료되지 않았습니다. 잠시 후 다시 시도해주세요.", http.StatusGatewayTimeout)
+	case errors.As(err, &statusErr):
+		httpError(w, r, fmt.Sprintf("%s 실패: AI 서버가 오류를 반환했습니다 (상태 코드: %d)", feature, statusErr.StatusCode), http.StatusBadGateway)
+	default:
+		httpError(w, r, feature+" 실패: AI 서버 호출 실패: "+err.Error(), http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// errCircuitOpen은 AI 서버 장애로 회로가 열려 호출을 시도하지 않았음을 뜻합니다.
+var errCircuitOpen = errors.New("AI 서버를 일시적으로 사용할 수 없습니다")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker는 연속 실패가 threshold에 도달하면 openFor 동안 호출을 즉시 거부합니다.
+// openFor가 지나면 한 번의 시험 호출(half-open)을 허용하고, 성공하면 다시 닫습니다.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+	trialBusy bool
+
+	threshold int
+	openFor   time.Duration
+	now       func() time.Time
+}
+
+func newCircuitBreaker(threshold int, openFor time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, openFor: openFor, now: time.Now}
+}
+
+// allow는 호출을 시도해도 되는지 반환합니다. false이면 retryAfter 뒤에 다시 시도할 수 있습니다.
+func (b *circuitBreaker) allow() (ok bool, retryAfter time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		elapsed := b.now().Sub(b.openedAt)
+		if elapsed < b.openFor {
+			return false, b.openFor - elapsed
+		}
+		b.state = breakerHalfOpen
+		b.trialBusy = true
+		return true, 0
+	case breakerHalfOpen:
+		// 시험 호출이 끝날 때까지 다른 호출은 거부합니다.
+		if b.trialBusy {
+			return false, time.Second
+		}
+		b.trialBusy = true
+		return true, 0
+	default:
+		return true, 0
+	}
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = breakerClosed
+	b.failures = 0
+	b.trialBusy = false
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trialBusy = false
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// release는 결과를 판단할 수 없는 호출(클라이언트가 요청을 취소한 경우 등)이 끝났을 때
+// 상태를 바꾸지 않고 시험 호출 자리만 반환합니다.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trialBusy = false
+}
+
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != breakerClosed
+}
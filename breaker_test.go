@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeClock은 circuitBreaker.now를 대신하는 시계입니다.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(threshold int, openFor time.Duration) (*circuitBreaker, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	b := newCircuitBreaker(threshold, openFor)
+	b.now = clock.now
+	return b, clock
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b, clock := newTestBreaker(3, 30*time.Second)
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := b.allow(); !ok {
+			t.Fatalf("실패 %d번 뒤에 호출이 거부되었습니다", i)
+		}
+		b.failure()
+	}
+	if b.isOpen() {
+		t.Fatal("threshold 전에 회로가 열렸습니다")
+	}
+
+	// 성공하면 연속 실패 수가 처음부터 다시 셉니다.
+	b.success()
+	for i := 0; i < 3; i++ {
+		b.allow()
+		b.failure()
+	}
+	if !b.isOpen() {
+		t.Fatal("연속 실패 3번 뒤에도 회로가 닫혀 있습니다")
+	}
+
+	clock.advance(10 * time.Second)
+	ok, retryAfter := b.allow()
+	if ok {
+		t.Fatal("열린 회로가 호출을 허용했습니다")
+	}
+	if retryAfter != 20*time.Second {
+		t.Errorf("retryAfter = %s, want 20s", retryAfter)
+	}
+}
+
+func TestBreakerHalfOpenAllowsSingleProbe(t *testing.T) {
+	b, clock := newTestBreaker(1, 30*time.Second)
+	b.allow()
+	b.failure()
+
+	clock.advance(30 * time.Second)
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("openFor가 지난 뒤 시험 호출이 거부되었습니다")
+	}
+	if ok, _ := b.allow(); ok {
+		t.Fatal("시험 호출 중에 두 번째 호출이 허용되었습니다")
+	}
+
+	// 시험 호출이 실패하면 다시 openFor 동안 엽니다.
+	b.failure()
+	if ok, _ := b.allow(); ok {
+		t.Fatal("시험 호출 실패 뒤에 호출이 허용되었습니다")
+	}
+
+	clock.advance(30 * time.Second)
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("두 번째 시험 호출이 거부되었습니다")
+	}
+	b.success()
+	if b.isOpen() {
+		t.Fatal("시험 호출 성공 뒤에도 회로가 열려 있습니다")
+	}
+	for i := 0; i < 3; i++ {
+		if ok, _ := b.allow(); !ok {
+			t.Fatal("닫힌 회로가 호출을 거부했습니다")
+		}
+	}
+}
+
+func TestBreakerReleaseKeepsState(t *testing.T) {
+	b, clock := newTestBreaker(1, 30*time.Second)
+	b.allow()
+	b.failure()
+	clock.advance(30 * time.Second)
+
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("시험 호출이 거부되었습니다")
+	}
+	// 결과를 알 수 없는 호출은 시험 호출 자리만 돌려주고 회로는 그대로 둡니다.
+	b.release()
+	if !b.isOpen() {
+		t.Fatal("release 뒤에 회로가 닫혔습니다")
+	}
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("release 뒤에 새 시험 호출이 거부되었습니다")
+	}
+}
+
+// setupAIPostTest는 handler로 응답하는 가짜 AI 서버와 half-open 상태의 aiBreaker를 준비합니다.
+func setupAIPostTest(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	setupTestDB(t)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	prevCfg, prevBreaker := cfg, aiBreaker
+	t.Cleanup(func() { cfg, aiBreaker = prevCfg, prevBreaker })
+	cfg = defaultConfig()
+	cfg.AI.ServerURL = server.URL
+	cfg.AI.MaxRetries = 0
+
+	var clock *fakeClock
+	aiBreaker, clock = newTestBreaker(1, 30*time.Second)
+	aiBreaker.allow()
+	aiBreaker.failure()
+	clock.advance(30 * time.Second)
+}
+
+func TestAIPostClientErrorClosesBreaker(t *testing.T) {
+	setupAIPostTest(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	})
+
+	var out map[string]interface{}
+	if err := aiPost(context.Background(), "/tags/generate", map[string]string{}, &out); err == nil {
+		t.Fatal("400 응답에 오류가 없습니다")
+	}
+	// 4xx는 AI 서버가 살아 있다는 뜻이므로 시험 호출 성공으로 봅니다.
+	if aiBreaker.isOpen() {
+		t.Error("4xx 응답 뒤에도 회로가 열려 있습니다")
+	}
+}
+
+func TestAIPostCallerCancelReleasesProbe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	setupAIPostTest(t, func(w http.ResponseWriter, r *http.Request) {
+		// 본문을 다 읽어야 서버가 연결 끊김을 감지해 r.Context()를 취소합니다.
+		io.Copy(io.Discard, r.Body)
+		cancel()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+
+	var out map[string]interface{}
+	if err := aiPost(ctx, "/tags/generate", map[string]string{}, &out); err == nil {
+		t.Fatal("취소된 호출에 오류가 없습니다")
+	}
+	if !aiBreaker.isOpen() {
+		t.Fatal("호출한 쪽의 취소로 회로가 닫혔습니다")
+	}
+	if ok, _ := aiBreaker.allow(); !ok {
+		t.Error("취소된 시험 호출이 자리를 돌려주지 않았습니다")
+	}
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
@@ -16,13 +18,22 @@ type Card struct {
 	Category  string `json:"category,omitempty"`
 	ProjectID int64  `json:"project_id"`
 	UserID    int64  `json:"user_id,omitempty"` // 서버에서 채우므로 클라이언트 요청에는 불필요
+	// AI 태그 생성에 실패해 백그라운드에서 다시 시도 중이면 true (응답 전용)
+	TagsPending bool `json:"tags_pending,omitempty"`
+
+	// 자동 분류 결과. 기존 카테고리와의 유사도이며, 직접 정했거나 클러스터링으로 정한 카테고리는 비어 있습니다.
+	CategoryConfidence *float64 `json:"category_confidence,omitempty"`
+	// 유사도가 낮아 '미분류'로 남긴 카드의 가장 가까운 카테고리 (검토용)
+	SuggestedCategory string `json:"suggested_category,omitempty"`
+	// 백그라운드에서 자동 분류를 기다리는 중이면 true (응답 전용)
+	ClassifyPending bool `json:"classify_pending,omitempty"`
 }
 
 // /api/cards 와 /api/cards/{id} 경로의 요청을 처리합니다.
 func handleCards(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(userContextKey).(int64)
 	if !ok {
-		http.Error(w, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
 		return
 	}
 
@@ -46,63 +57,74 @@ func handleCards(w http.ResponseWriter, r *http.Request) {
 	case "DELETE":
 		deleteCard(w, r, userID, idFromPath)
 	default:
-		http.Error(w, "지원하지 않는 메소드", http.StatusMethodNotAllowed)
+		httpError(w, r, "지원하지 않는 메소드", http.StatusMethodNotAllowed)
 	}
 }
 
 func createCard(w http.ResponseWriter, r *http.Request, userID int64) {
 	var card Card
 	if err := json.NewDecoder(r.Body).Decode(&card); err != nil {
-		http.Error(w, "잘못된 JSON 형식", http.StatusBadRequest)
+		httpError(w, r, "잘못된 JSON 형식", http.StatusBadRequest)
 		return
 	}
 	card.UserID = userID
 	card.Category = "미분류"
 
 	var projectOwnerID int64
-	err := db.QueryRow("SELECT user_id FROM projects WHERE id = ?", card.ProjectID).Scan(&projectOwnerID)
+	err := db.QueryRowContext(r.Context(), "SELECT user_id FROM projects WHERE id = ?", card.ProjectID).Scan(&projectOwnerID)
 	if err != nil || projectOwnerID != userID {
-		http.Error(w, "프로젝트를 찾을 수 없거나 권한이 없습니다", http.StatusForbidden)
-		return
-	}
-
-	// 태그가 비어있을 경우, AI 서버를 호출하여 자동 생성
-	if card.Tags == "" && card.Text != "" {
-		reqBody := map[string]string{"content": card.Text}
-		reqBytes, err := json.Marshal(reqBody)
-		if err == nil {
-			resp, err := http.Post("http://127.0.0.1:8000/tags/generate", "application/json", bytes.NewBuffer(reqBytes))
-			if err == nil {
-				defer resp.Body.Close()
-				if resp.StatusCode == http.StatusOK {
-					var tagResp struct {
-						Tags []string `json:"tags"`
-					}
-					if err := json.NewDecoder(resp.Body).Decode(&tagResp); err == nil {
-						card.Tags = strings.Join(tagResp.Tags, ",")
-					}
-				}
-			}
+		httpError(w, r, "프로젝트를 찾을 수 없거나 권한이 없습니다", http.StatusForbidden)
+		return
+	}
+	setUsageProject(r.Context(), card.ProjectID)
+
+	// 태그가 비어있을 경우, tags.engine 설정에 따라 자동 생성
+	// AI 태그 생성 실패가 카드 생성 자체를 막지 않도록 하고,
+	// 로컬 태그도 만들지 못했으면 카드 저장 후 백그라운드 작업으로 다시 시도합니다.
+	var tagErr error
+	tagEngine := ""
+	if card.Tags == "" && (card.Text != "" || card.URL != "") {
+		var tags []string
+		tags, tagEngine, tagErr = generateCardTags(r.Context(), card.Text, card.URL)
+		if tagEngine != "" {
+			card.Tags = strings.Join(tags, ",")
+			w.Header().Set("X-Tags-Engine", tagEngine)
 		}
-		// 프로토타입 단계에서는 AI 태그 생성 실패가 카드 생성 자체를 막지 않도록 함
 	}
 
-	result, err := db.Exec(
+	result, err := db.ExecContext(r.Context(),
 		"INSERT INTO cards (cardtext, cardurl, cardtags, category, project_id, user_id) VALUES (?, ?, ?, ?, ?, ?)",
 		card.Text, card.URL, card.Tags, card.Category, card.ProjectID, card.UserID,
 	)
 	if err != nil {
-		http.Error(w, "카드 생성 실패: "+err.Error(), http.StatusInternalServerError)
+		httpError(w, r, "카드 생성 실패: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	cardID, err := result.LastInsertId()
 	if err != nil {
-		http.Error(w, "카드 ID 가져오기 실패", http.StatusInternalServerError)
+		httpError(w, r, "카드 ID 가져오기 실패", http.StatusInternalServerError)
 		return
 	}
 	card.CardID = cardID
 
+	if tagErr != nil {
+		// AI 태그 없이 저장되었음을 응답 헤더와 로그로 알려 조용히 실패하지 않도록 합니다.
+		w.Header().Set("X-AI-Degraded", "tags")
+		if tagEngine == tagEngineLocal {
+			slog.Warn("AI 태그 생성 실패, 로컬 태그로 카드 저장",
+				"request_id", requestIDFrom(r.Context()), "card_id", cardID, "error", tagErr)
+		} else {
+			card.TagsPending = jobs.enqueue("card-tags", retryCardTagsJob(cardID, card.ProjectID, card.Text, detachedRequestInfo(r.Context())))
+			slog.Warn("AI 태그 생성 실패, 태그 없이 카드 저장",
+				"request_id", requestIDFrom(r.Context()), "card_id", cardID, "retry_queued", card.TagsPending, "error", tagErr)
+		}
+	}
+	if cfg.Classify.Enabled && card.Text != "" {
+		card.ClassifyPending = jobs.enqueue("card-classify", classifyCardJob(cardID, card.ProjectID, card.Text, detachedRequestInfo(r.Context())))
+	}
+	publishProjectEvent(r.Context(), card.ProjectID, eventCardCreated, card)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(card)
@@ -111,25 +133,32 @@ func createCard(w http.ResponseWriter, r *http.Request, userID int64) {
 func getCardsByProject(w http.ResponseWriter, r *http.Request, userID int64) {
 	projectIDStr := r.URL.Query().Get("project_id")
 	if projectIDStr == "" {
-		http.Error(w, "project_id 쿼리 파라미터가 필요합니다", http.StatusBadRequest)
+		httpError(w, r, "project_id 쿼리 파라미터가 필요합니다", http.StatusBadRequest)
 		return
 	}
 	projectID, err := strconv.ParseInt(projectIDStr, 10, 64)
 	if err != nil {
-		http.Error(w, "잘못된 project_id", http.StatusBadRequest)
+		httpError(w, r, "잘못된 project_id", http.StatusBadRequest)
 		return
 	}
 
 	var projectOwnerID int64
-	err = db.QueryRow("SELECT user_id FROM projects WHERE id = ?", projectID).Scan(&projectOwnerID)
+	err = db.QueryRowContext(r.Context(), "SELECT user_id FROM projects WHERE id = ?", projectID).Scan(&projectOwnerID)
 	if err != nil || projectOwnerID != userID {
-		http.Error(w, "프로젝트에 대한 권한이 없습니다", http.StatusForbidden)
+		httpError(w, r, "프로젝트에 대한 권한이 없습니다", http.StatusForbidden)
 		return
 	}
 
-	rows, err := db.Query("SELECT id, cardtext, cardurl, cardtags, category, project_id, user_id FROM cards WHERE project_id = ? AND user_id = ?", projectID, userID)
+	query := "SELECT id, cardtext, cardurl, cardtags, category, project_id, user_id, category_confidence, suggested_category FROM cards WHERE project_id = ? AND user_id = ?"
+	args := []interface{}{projectID, userID}
+	// review=true면 자동 분류 유사도가 낮아 검토가 필요한 카드만 반환합니다.
+	if r.URL.Query().Get("review") == "true" {
+		query += " AND category = ? AND suggested_category IS NOT NULL"
+		args = append(args, uncategorizedCategory)
+	}
+	rows, err := db.QueryContext(r.Context(), query, args...)
 	if err != nil {
-		http.Error(w, "카드 목록 조회 실패", http.StatusInternalServerError)
+		httpError(w, r, "카드 목록 조회 실패", http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close()
@@ -137,10 +166,13 @@ func getCardsByProject(w http.ResponseWriter, r *http.Request, userID int64) {
 	var cards []Card
 	for rows.Next() {
 		var c Card
-		if err := rows.Scan(&c.CardID, &c.Text, &c.URL, &c.Tags, &c.Category, &c.ProjectID, &c.UserID); err != nil {
-			http.Error(w, "DB 스캔 실패", http.StatusInternalServerError)
+		var confidence sql.NullFloat64
+		var suggested sql.NullString
+		if err := rows.Scan(&c.CardID, &c.Text, &c.URL, &c.Tags, &c.Category, &c.ProjectID, &c.UserID, &confidence, &suggested); err != nil {
+			httpError(w, r, "DB 스캔 실패", http.StatusInternalServerError)
 			return
 		}
+		c.setClassification(confidence, suggested)
 		cards = append(cards, c)
 	}
 
@@ -151,16 +183,19 @@ func getCardsByProject(w http.ResponseWriter, r *http.Request, userID int64) {
 func getCard(w http.ResponseWriter, r *http.Request, userID int64, idFromPath string) {
 	cardID, err := strconv.ParseInt(idFromPath, 10, 64)
 	if err != nil {
-		http.Error(w, "잘못된 id 경로", http.StatusBadRequest)
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
 		return
 	}
 
 	var card Card
-	err = db.QueryRow("SELECT id, cardtext, cardurl, cardtags, category, project_id, user_id FROM cards WHERE id = ? AND user_id = ?", cardID, userID).Scan(&card.CardID, &card.Text, &card.URL, &card.Tags, &card.Category, &card.ProjectID, &card.UserID)
+	var confidence sql.NullFloat64
+	var suggested sql.NullString
+	err = db.QueryRowContext(r.Context(), "SELECT id, cardtext, cardurl, cardtags, category, project_id, user_id, category_confidence, suggested_category FROM cards WHERE id = ? AND user_id = ?", cardID, userID).Scan(&card.CardID, &card.Text, &card.URL, &card.Tags, &card.Category, &card.ProjectID, &card.UserID, &confidence, &suggested)
 	if err != nil {
-		http.Error(w, "카드를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		httpError(w, r, "카드를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
 		return
 	}
+	card.setClassification(confidence, suggested)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(card)
@@ -168,72 +203,194 @@ func getCard(w http.ResponseWriter, r *http.Request, userID int64, idFromPath st
 
 func updateCard(w http.ResponseWriter, r *http.Request, userID int64, idFromPath string) {
 	if idFromPath == "" {
-		http.Error(w, "경로에 id가 필요합니다", http.StatusBadRequest)
+		httpError(w, r, "경로에 id가 필요합니다", http.StatusBadRequest)
 		return
 	}
 	cardID, err := strconv.ParseInt(idFromPath, 10, 64)
 	if err != nil {
-		http.Error(w, "잘못된 id 경로", http.StatusBadRequest)
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
 		return
 	}
 
 	var card Card
 	if err := json.NewDecoder(r.Body).Decode(&card); err != nil {
-		http.Error(w, "잘못된 JSON 형식", http.StatusBadRequest)
+		httpError(w, r, "잘못된 JSON 형식", http.StatusBadRequest)
+		return
+	}
+
+	projectID, err := cardProjectID(r.Context(), cardID, userID)
+	if err != nil {
+		httpError(w, r, "카드를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
 		return
 	}
 
-	result, err := db.Exec(
-		"UPDATE cards SET cardtext = ?, cardurl = ?, cardtags = ?, category = ? WHERE id = ? AND user_id = ?",
-		card.Text, card.URL, card.Tags, card.Category, cardID, userID,
+	// 카테고리를 직접 바꾸면 자동 분류 결과는 지웁니다.
+	result, err := db.ExecContext(r.Context(),
+		`UPDATE cards SET cardtext = ?, cardurl = ?, cardtags = ?, category = ?,
+			category_confidence = CASE WHEN category IS ? THEN category_confidence END,
+			suggested_category = CASE WHEN category IS ? THEN suggested_category END
+		WHERE id = ? AND user_id = ?`,
+		card.Text, card.URL, card.Tags, card.Category, card.Category, card.Category, cardID, userID,
 	)
 	if err != nil {
-		http.Error(w, "카드 수정 실패", http.StatusInternalServerError)
+		httpError(w, r, "카드 수정 실패", http.StatusInternalServerError)
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		http.Error(w, "수정된 행 수 가져오기 실패", http.StatusInternalServerError)
+		httpError(w, r, "수정된 행 수 가져오기 실패", http.StatusInternalServerError)
 		return
 	}
 	if rowsAffected == 0 {
-		http.Error(w, "카드를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		httpError(w, r, "카드를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
 		return
 	}
 
 	card.CardID = cardID
 	card.UserID = userID
+	card.ProjectID = projectID
+	publishProjectEvent(r.Context(), projectID, eventCardUpdated, card)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(card)
 }
 
 func deleteCard(w http.ResponseWriter, r *http.Request, userID int64, idFromPath string) {
 	if idFromPath == "" {
-		http.Error(w, "경로에 id가 필요합니다", http.StatusBadRequest)
+		httpError(w, r, "경로에 id가 필요합니다", http.StatusBadRequest)
 		return
 	}
 	cardID, err := strconv.ParseInt(idFromPath, 10, 64)
 	if err != nil {
-		http.Error(w, "잘못된 id 경로", http.StatusBadRequest)
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
 		return
 	}
 
-	result, err := db.Exec("DELETE FROM cards WHERE id = ? AND user_id = ?", cardID, userID)
+	projectID, err := cardProjectID(r.Context(), cardID, userID)
 	if err != nil {
-		http.Error(w, "카드 삭제 실패", http.StatusInternalServerError)
+		httpError(w, r, "카드를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		return
+	}
+
+	// 카드와 카드를 가리키는 인용 정보는 함께 지워지거나 함께 남아야 합니다.
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		httpError(w, r, "카드 삭제 실패", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(r.Context(), "DELETE FROM cards WHERE id = ? AND user_id = ?", cardID, userID)
+	if err != nil {
+		httpError(w, r, "카드 삭제 실패", http.StatusInternalServerError)
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		http.Error(w, "삭제된 행 수 가져오기 실패", http.StatusInternalServerError)
+		httpError(w, r, "삭제된 행 수 가져오기 실패", http.StatusInternalServerError)
 		return
 	}
 	if rowsAffected == 0 {
-		http.Error(w, "카드를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		httpError(w, r, "카드를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), "DELETE FROM document_citations WHERE card_id = ?", cardID); err != nil {
+		httpError(w, r, "카드 인용 정보 삭제 실패", http.StatusInternalServerError)
 		return
 	}
+	if err := tx.Commit(); err != nil {
+		httpError(w, r, "카드 삭제 실패", http.StatusInternalServerError)
+		return
+	}
+	publishProjectEvent(r.Context(), projectID, eventCardDeleted, map[string]int64{"id": cardID})
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// cardProjectID는 userID가 소유한 카드가 속한 프로젝트 ID를 반환합니다.
+func cardProjectID(ctx context.Context, cardID int64, userID int64) (int64, error) {
+	var projectID int64
+	err := db.QueryRowContext(ctx, "SELECT project_id FROM cards WHERE id = ? AND user_id = ?", cardID, userID).Scan(&projectID)
+	return projectID, err
+}
+
+// generateTags는 AI 서버 /tags/generate 엔드포인트를 호출해 카드 내용의 태그를 생성합니다.
+func generateTags(ctx context.Context, text string) ([]string, error) {
+	var tagResp struct {
+		Tags []string `json:"tags"`
+	}
+	if err := aiPost(ctx, "/tags/generate", map[string]string{"content": text}, &tagResp); err != nil {
+		return nil, err
+	}
+	return tagResp.Tags, nil
+}
+
+// generateCardTags는 tags.engine 설정에 따라 카드 태그를 만들고, 사용한 엔진(ai 또는 local)을 반환합니다.
+// auto에서 AI 서버를 쓸 수 없으면 로컬 추출기로 만든 태그와 함께 AI 오류를 반환하며,
+// 태그를 만들지 못했으면 engine이 빈 문자열입니다. 내용이 없으면 URL로 로컬 태그만 만듭니다.
+func generateCardTags(ctx context.Context, text, cardURL string) (tags []string, engine string, err error) {
+	if cfg.Tags.Engine == tagEngineLocal || strings.TrimSpace(text) == "" {
+		return localTags(text, cardURL, cfg.Tags.MaxTags), tagEngineLocal, nil
+	}
+	tags, err = generateTags(ctx, text)
+	if err == nil {
+		return tags, tagEngineAI, nil
+	}
+	if cfg.Tags.Engine == tagEngineAI || ctx.Err() != nil {
+		return nil, "", err
+	}
+	return localTags(text, cardURL, cfg.Tags.MaxTags), tagEngineLocal, err
+}
+
+// handleCardRetag는 POST /api/cards/{id}/retag 요청을 처리합니다.
+// 설정된 엔진으로 태그를 다시 만들어 기존 태그를 바꾸고, 바뀐 카드를 반환합니다.
+func handleCardRetag(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+	cardID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
+		return
+	}
+
+	var card Card
+	var confidence sql.NullFloat64
+	var suggested sql.NullString
+	err = db.QueryRowContext(r.Context(), "SELECT id, COALESCE(cardtext, ''), COALESCE(cardurl, ''), COALESCE(cardtags, ''), COALESCE(category, ''), project_id, user_id, category_confidence, suggested_category FROM cards WHERE id = ? AND user_id = ?", cardID, userID).Scan(&card.CardID, &card.Text, &card.URL, &card.Tags, &card.Category, &card.ProjectID, &card.UserID, &confidence, &suggested)
+	if err != nil {
+		httpError(w, r, "카드를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		return
+	}
+	card.setClassification(confidence, suggested)
+	setUsageProject(r.Context(), card.ProjectID)
+	if strings.TrimSpace(card.Text) == "" && strings.TrimSpace(card.URL) == "" {
+		httpError(w, r, "태그를 만들 카드 내용이나 URL이 없습니다", http.StatusBadRequest)
+		return
+	}
+
+	tags, engine, err := generateCardTags(r.Context(), card.Text, card.URL)
+	if engine == "" {
+		writeAIError(w, r, "태그 생성", err)
+		return
+	}
+	if err != nil {
+		w.Header().Set("X-AI-Degraded", "tags")
+		slog.Warn("AI 태그 생성 실패, 로컬 태그로 다시 만듭니다", "request_id", requestIDFrom(r.Context()), "card_id", cardID, "error", err)
+	}
+	w.Header().Set("X-Tags-Engine", engine)
+
+	card.Tags = strings.Join(tags, ",")
+	if _, err := db.ExecContext(r.Context(), "UPDATE cards SET cardtags = ? WHERE id = ? AND user_id = ?", card.Tags, cardID, userID); err != nil {
+		httpError(w, r, "카드 태그 저장 실패", http.StatusInternalServerError)
+		return
+	}
+	publishProjectEvent(r.Context(), card.ProjectID, eventCardUpdated, map[string]interface{}{"id": cardID, "cardtags": card.Tags})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(card)
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 카테고리 계층
+//
+// 카드는 카테고리를 이름으로 가리키므로 계층은 category_parents에 하위 카테고리 이름 → 상위 카테고리 이름으로만
+// 저장합니다. 상위 카테고리가 없는 카테고리는 최상위입니다. 트리에는 자기 또는 하위 카테고리에 카드가 있는
+// 카테고리만 나오며, 카드가 모두 하위 카테고리로 옮겨 간 상위 카테고리는 card_ids가 빈 채로 나옵니다.
+// 하위 카테고리는 한 카테고리의 카드를 다시 클러스터링해 만들거나(subcluster) 직접 상위 카테고리를 지정해 만듭니다.
+
+// SubclusterRequest는 POST /api/projects/{id}/categories/subcluster 요청 본문입니다.
+// k, dry_run, engine은 클러스터링과 같고, scope와 tags는 쓰지 않습니다.
+type SubclusterRequest struct {
+	Category string `json:"category"`
+	ClusterOptions
+}
+
+// CategoryParentRequest는 PUT /api/projects/{id}/categories/parent 요청 본문입니다. parent가 비어 있으면 최상위로 옮깁니다.
+type CategoryParentRequest struct {
+	Category string `json:"category"`
+	Parent   string `json:"parent"`
+}
+
+// errInvalidCategory는 카테고리 계층 요청이 잘못되었을 때 반환됩니다.
+var errInvalidCategory = errors.New("잘못된 카테고리")
+
+// handleCategories는 GET /api/projects/{id}/categories 요청을 처리합니다. 카테고리 트리를 반환합니다.
+func handleCategories(w http.ResponseWriter, r *http.Request) {
+	userID, projectID, ok := categoryProject(w, r)
+	if !ok {
+		return
+	}
+	categories, err := getAllCategoriesForProject(r.Context(), projectID, userID)
+	if err != nil {
+		httpError(w, r, "카테고리 조회 실패", http.StatusInternalServerError)
+		return
+	}
+	if categories == nil {
+		categories = []CategoryInfo{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categories)
+}
+
+// handleCategoryParent는 PUT /api/projects/{id}/categories/parent 요청을 처리합니다.
+// 카테고리를 다른 카테고리의 하위로 옮기거나(parent) 최상위로 꺼냅니다(parent 비움). 옮긴 뒤의 트리를 반환합니다.
+func handleCategoryParent(w http.ResponseWriter, r *http.Request) {
+	userID, projectID, ok := categoryProject(w, r)
+	if !ok {
+		return
+	}
+	var req CategoryParentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "잘못된 JSON 형식", http.StatusBadRequest)
+		return
+	}
+	req.Category, req.Parent = strings.TrimSpace(req.Category), strings.TrimSpace(req.Parent)
+
+	if err := setCategoryParent(r.Context(), projectID, userID, req.Category, req.Parent); err != nil {
+		if errors.Is(err, errInvalidCategory) {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+		} else {
+			httpError(w, r, "카테고리 계층 저장 실패", http.StatusInternalServerError)
+		}
+		return
+	}
+	publishProjectEvent(r.Context(), projectID, eventCategoryMoved, req)
+
+	categories, err := getAllCategoriesForProject(r.Context(), projectID, userID)
+	if err != nil {
+		httpError(w, r, "카테고리 조회 실패", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categories)
+}
+
+// handleSubcluster는 POST /api/projects/{id}/categories/subcluster 요청을 처리합니다.
+// 한 카테고리에 직접 속한 카드를 다시 묶어 그 카테고리의 하위 카테고리로 저장하고, 제안과 실행 ID를 반환합니다.
+// dry_run이면 저장하지 않고 parent가 채워진 제안만 반환하며, 이 제안은 /cluster/apply로 적용할 수 있습니다.
+func handleSubcluster(w http.ResponseWriter, r *http.Request) {
+	userID, projectID, ok := categoryProject(w, r)
+	if !ok {
+		return
+	}
+	var req SubclusterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		httpError(w, r, "잘못된 JSON 형식", http.StatusBadRequest)
+		return
+	}
+	req.Category = strings.TrimSpace(req.Category)
+	if req.Category == "" || req.Category == uncategorizedCategory {
+		httpError(w, r, "나눌 category가 필요합니다 ('미분류'는 나눌 수 없습니다)", http.StatusBadRequest)
+		return
+	}
+	if req.Scope != "" || len(req.Tags) > 0 {
+		httpError(w, r, "하위 클러스터링에는 scope와 tags를 쓸 수 없습니다", http.StatusBadRequest)
+		return
+	}
+	if err := req.normalize(r); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	aiRequest, err := categoryCandidates(r.Context(), projectID, userID, req.Category)
+	if err != nil {
+		httpError(w, r, "카드 목록 조회 실패: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(aiRequest.Cards) < minClusters {
+		httpError(w, r, fmt.Sprintf("카테고리 %q에 직접 속한 카드가 %d개 이상이어야 나눌 수 있습니다", req.Category, minClusters), http.StatusBadRequest)
+		return
+	}
+	setUsageProject(r.Context(), projectID)
+	proposal, ok := proposeClusters(w, r, aiRequest, req.ClusterOptions)
+	if !ok {
+		return
+	}
+	proposal.Parent = req.Category
+
+	names, parents, err := projectCategories(r.Context(), projectID, userID)
+	if err != nil {
+		httpError(w, r, "카테고리 조회 실패", http.StatusInternalServerError)
+		return
+	}
+	proposal.Clusters = nestClusters(names, parents, req.Category, proposal.Clusters)
+
+	if req.DryRun {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(proposal)
+		return
+	}
+
+	runID, err := applyClusters(r.Context(), projectID, userID, clusterRunSourceSubcluster, proposal.Parent, proposal.CardIDs, proposal.Clusters)
+	if err != nil {
+		httpError(w, r, "카테고리 업데이트 실패: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	publishProjectEvent(r.Context(), projectID, eventCardsClustered, proposal.Clusters)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		ClusterProposal
+		RunID int64 `json:"run_id"`
+	}{proposal, runID})
+}
+
+// categoryProject는 경로의 프로젝트 ID를 읽고 요청한 유저의 프로젝트인지 확인합니다. 아니면 오류 응답을 씁니다.
+func categoryProject(w http.ResponseWriter, r *http.Request) (userID, projectID int64, ok bool) {
+	userID, ok = r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return 0, 0, false
+	}
+	projectID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	var owner int64
+	err = db.QueryRowContext(r.Context(), "SELECT user_id FROM projects WHERE id = ?", projectID).Scan(&owner)
+	if err != nil || owner != userID {
+		httpError(w, r, "프로젝트를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		return 0, 0, false
+	}
+	return userID, projectID, true
+}
+
+// categoryCandidates는 category에 직접 속한 카드를 AI 요청 형식으로 모읍니다.
+func categoryCandidates(ctx context.Context, projectID, userID int64, category string) (ClusterAIRequest, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT id, cardtext, COALESCE(cardtags, '') FROM cards WHERE project_id = ? AND user_id = ? AND category = ?",
+		projectID, userID, category,
+	)
+	if err != nil {
+		return ClusterAIRequest{}, err
+	}
+	defer rows.Close()
+
+	var aiRequest ClusterAIRequest
+	for rows.Next() {
+		var card ClusterCard
+		var tags string
+		if err := rows.Scan(&card.ID, &card.Content, &tags); err != nil {
+			return ClusterAIRequest{}, err
+		}
+		card.Tags = splitTags(tags)
+		aiRequest.Cards = append(aiRequest.Cards, card)
+	}
+	return aiRequest, rows.Err()
+}
+
+// nestClusters는 parent를 나눈 클러스터 이름이 계층을 망가뜨리지 않도록 고칩니다.
+// '미분류'로 묶인 카드는 parent에 그대로 두고, 조상이거나 다른 가지에 있는 카테고리와 이름이 같으면 "parent - 이름"으로 바꿉니다.
+func nestClusters(names map[string]bool, parents map[string]string, parent string, clusters []ClusterInfo) []ClusterInfo {
+	for i, cluster := range clusters {
+		switch {
+		case cluster.CategoryName == uncategorizedCategory:
+			clusters[i].CategoryName = parent
+		case subcategoryConflict(names, parents, parent, cluster.CategoryName):
+			clusters[i].CategoryName = parent + " - " + cluster.CategoryName
+		}
+	}
+	return clusters
+}
+
+// subcategoryConflict는 name을 parent의 하위 카테고리로 둘 수 없으면 true입니다.
+// parent의 조상이면 순환이 생기고, parent 밖에 이미 있는 카테고리면 그 카드까지 parent 아래로 옮겨지기 때문입니다.
+func subcategoryConflict(names map[string]bool, parents map[string]string, parent, name string) bool {
+	if name == parent {
+		return false
+	}
+	for _, ancestor := range categoryAncestors(parents, parent) {
+		if ancestor == name {
+			return true
+		}
+	}
+	if !names[name] {
+		return false
+	}
+	for _, ancestor := range categoryAncestors(parents, name) {
+		if ancestor == parent {
+			return false
+		}
+	}
+	return true
+}
+
+// setCategoryParent는 category의 상위 카테고리를 parent로 바꿉니다. parent가 비어 있으면 최상위로 옮깁니다.
+func setCategoryParent(ctx context.Context, projectID, userID int64, category, parent string) error {
+	names, parents, err := projectCategories(ctx, projectID, userID)
+	if err != nil {
+		return err
+	}
+	if category == "" || !names[category] {
+		return fmt.Errorf("%w: 프로젝트에 카테고리 %q가 없습니다", errInvalidCategory, category)
+	}
+	if category == uncategorizedCategory || parent == uncategorizedCategory {
+		return fmt.Errorf("%w: '미분류'는 계층에 넣을 수 없습니다", errInvalidCategory)
+	}
+	if parent == "" {
+		_, err = db.ExecContext(ctx, "DELETE FROM category_parents WHERE project_id = ? AND name = ?", projectID, category)
+		return err
+	}
+	if !names[parent] {
+		return fmt.Errorf("%w: 프로젝트에 카테고리 %q가 없습니다", errInvalidCategory, parent)
+	}
+	if parent == category {
+		return fmt.Errorf("%w: 자기 자신을 상위 카테고리로 둘 수 없습니다", errInvalidCategory)
+	}
+	for _, ancestor := range categoryAncestors(parents, parent) {
+		if ancestor == category {
+			return fmt.Errorf("%w: %q는 %q의 하위 카테고리입니다", errInvalidCategory, parent, category)
+		}
+	}
+	_, err = db.ExecContext(ctx,
+		"INSERT INTO category_parents (project_id, name, parent) VALUES (?, ?, ?) ON CONFLICT (project_id, name) DO UPDATE SET parent = excluded.parent",
+		projectID, category, parent,
+	)
+	return err
+}
+
+// projectCategories는 프로젝트의 카테고리 이름(카드가 있거나 계층에 있는 것)과 하위 → 상위 관계를 읽습니다.
+func projectCategories(ctx context.Context, projectID, userID int64) (map[string]bool, map[string]string, error) {
+	direct, err := categoryCardIDs(ctx, projectID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	parents, err := loadCategoryParents(ctx, projectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	names := make(map[string]bool, len(direct)+len(parents))
+	for name := range direct {
+		names[name] = true
+	}
+	for name, parent := range parents {
+		names[name] = true
+		names[parent] = true
+	}
+	return names, parents, nil
+}
+
+// categoryCardIDs는 카테고리별로 직접 속한 카드 ID를 읽습니다.
+func categoryCardIDs(ctx context.Context, projectID, userID int64) (map[string][]int64, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT category, id FROM cards WHERE project_id = ? AND user_id = ? AND category IS NOT NULL AND category != '' ORDER BY id",
+		projectID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	direct := make(map[string][]int64)
+	for rows.Next() {
+		var category string
+		var id int64
+		if err := rows.Scan(&category, &id); err != nil {
+			return nil, err
+		}
+		direct[category] = append(direct[category], id)
+	}
+	return direct, rows.Err()
+}
+
+func loadCategoryParents(ctx context.Context, projectID int64) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name, parent FROM category_parents WHERE project_id = ?", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parents := make(map[string]string)
+	for rows.Next() {
+		var name, parent string
+		if err := rows.Scan(&name, &parent); err != nil {
+			return nil, err
+		}
+		parents[name] = parent
+	}
+	return parents, rows.Err()
+}
+
+// categoryAncestors는 name의 상위 카테고리를 가까운 것부터 반환합니다. 순환이 있으면 거기서 멈춥니다.
+func categoryAncestors(parents map[string]string, name string) []string {
+	var ancestors []string
+	seen := map[string]bool{name: true}
+	for parent, ok := parents[name]; ok && !seen[parent]; parent, ok = parents[parent] {
+		seen[parent] = true
+		ancestors = append(ancestors, parent)
+	}
+	return ancestors
+}
+
+// buildCategoryTree는 카테고리별 카드와 계층으로 트리를 만듭니다. 자기 또는 하위에 카드가 있는 카테고리만 넣고,
+// 같은 단계의 카테고리는 이름순으로 정렬합니다. 순환에 걸린 카테고리는 최상위에 둡니다.
+func buildCategoryTree(direct map[string][]int64, parents map[string]string) []CategoryInfo {
+	included := make(map[string]bool)
+	for name := range direct {
+		included[name] = true
+		for _, ancestor := range categoryAncestors(parents, name) {
+			included[ancestor] = true
+		}
+	}
+
+	children := make(map[string][]string)
+	var roots []string
+	for name := range included {
+		parent, ok := parents[name]
+		cyclic := false
+		for _, ancestor := range categoryAncestors(parents, parent) {
+			if ancestor == name {
+				cyclic = true
+			}
+		}
+		if ok && parent != name && !cyclic {
+			children[parent] = append(children[parent], name)
+		} else {
+			roots = append(roots, name)
+		}
+	}
+
+	var build func(names []string) []CategoryInfo
+	build = func(names []string) []CategoryInfo {
+		sort.Strings(names)
+		nodes := make([]CategoryInfo, 0, len(names))
+		for _, name := range names {
+			ids := direct[name]
+			if ids == nil {
+				ids = []int64{}
+			}
+			nodes = append(nodes, CategoryInfo{CategoryName: name, CardIDs: ids, Children: build(children[name])})
+		}
+		return nodes
+	}
+	return build(roots)
+}
+
+// findCategory는 트리에서 이름이 name인 카테고리를 찾습니다.
+func findCategory(categories []CategoryInfo, name string) *CategoryInfo {
+	for i := range categories {
+		if categories[i].CategoryName == name {
+			return &categories[i]
+		}
+		if found := findCategory(categories[i].Children, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// allCardIDs는 카테고리와 모든 하위 카테고리의 카드 ID입니다.
+func (c CategoryInfo) allCardIDs() []int64 {
+	ids := append([]int64(nil), c.CardIDs...)
+	for _, child := range c.Children {
+		ids = append(ids, child.allCardIDs()...)
+	}
+	return ids
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AI 에이전트는 근거로 쓴 카드를 본문에 [card:12] 또는 [card:12,15] 형식으로 표시합니다.
+var citationMarker = regexp.MustCompile(`\[card:\s*(\d+(?:\s*,\s*\d+)*)\s*\]`)
+
+// documentCitation은 문서가 참고한 카드 하나입니다.
+// Ordinal은 본문 인용 번호([1], [2] ...)이며, 에이전트가 검색만 하고 본문에 인용하지 않은 카드는 0입니다.
+type documentCitation struct {
+	CardID  int64
+	Ordinal int
+}
+
+// applyCitations는 본문의 [card:ID] 표시에 처음 나온 순서대로 인용 번호를 매겨 문서에 저장할 인용 목록을 반환합니다.
+// 본문에는 [card:ID] 표시를 카드 하나에 하나씩([card:12,15] → [card:12][card:15]) 남기고,
+// projectCards에 없는 ID(에이전트가 지어낸 ID)는 지웁니다. 번호가 붙은 인용 표시는 render.go가 응답할 때 만듭니다.
+// retrieved는 에이전트가 검색한 카드 ID로, 본문에 인용되지 않았더라도 출처 목록에 남깁니다.
+func applyCitations(content string, projectCards map[int64]bool, retrieved []int64) (string, []documentCitation) {
+	return applyCitationsFrom(content, projectCards, retrieved, nil)
+}
+
+// applyCitationsFrom은 문서 일부를 새로 생성했을 때 쓰는 applyCitations입니다.
+// existing(카드 ID → 인용 번호)에 있는 카드는 같은 번호를 쓰고, 새 카드는 그 다음 번호부터 매기며,
+// 반환하는 인용 목록에는 새로 인용된 카드만 들어갑니다.
+func applyCitationsFrom(content string, projectCards map[int64]bool, retrieved []int64, existing map[int64]int) (string, []documentCitation) {
+	ordinals := make(map[int64]int, len(existing))
+	next := 1
+	for id, n := range existing {
+		ordinals[id] = n
+		next = max(next, n+1)
+	}
+	var citations []documentCitation
+
+	content = citationMarker.ReplaceAllStringFunc(content, func(marker string) string {
+		var b strings.Builder
+		for _, idStr := range strings.Split(citationMarker.FindStringSubmatch(marker)[1], ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(idStr), 10, 64)
+			if err != nil || !projectCards[id] {
+				continue
+			}
+			n, ok := ordinals[id]
+			if !ok {
+				n = next
+				next++
+				ordinals[id] = n
+				citations = append(citations, documentCitation{CardID: id, Ordinal: n})
+			}
+			fmt.Fprintf(&b, "[card:%d]", id)
+		}
+		return b.String()
+	})
+
+	for _, id := range retrieved {
+		if _, ok := ordinals[id]; ok || !projectCards[id] {
+			continue
+		}
+		ordinals[id] = 0
+		citations = append(citations, documentCitation{CardID: id})
+	}
+	return content, citations
+}
+
+// citationSups는 본문의 [card:ID] 표시를 ordinals(카드 ID → 인용 번호)의 번호를 단 인용 표시로 바꿉니다.
+// 사용자가 편집으로 넣어 번호가 없는 카드는 가장 큰 번호 다음부터 나온 순서대로 번호를 매깁니다.
+func citationSups(content string, ordinals map[int64]int) string {
+	next := 1
+	for _, n := range ordinals {
+		next = max(next, n+1)
+	}
+	extra := make(map[int64]int)
+	return citationMarker.ReplaceAllStringFunc(content, func(marker string) string {
+		var b strings.Builder
+		for _, idStr := range strings.Split(citationMarker.FindStringSubmatch(marker)[1], ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(idStr), 10, 64)
+			if err != nil {
+				continue
+			}
+			n, ok := ordinals[id]
+			if !ok {
+				if n, ok = extra[id]; !ok {
+					n = next
+					next++
+					extra[id] = n
+				}
+			}
+			fmt.Fprintf(&b, `<sup class="citation" data-card-id="%d">[%d]</sup>`, id, n)
+		}
+		return b.String()
+	})
+}
+
+// citedInContent는 본문에 cardID 카드의 인용 표시가 남아 있는지 봅니다.
+// 예전 버전이 본문에 직접 저장한 <sup data-card-id> 표시도 인정합니다.
+func citedInContent(content string, cardID int64) bool {
+	for _, m := range citationMarker.FindAllStringSubmatch(content, -1) {
+		for _, idStr := range strings.Split(m[1], ",") {
+			if id, err := strconv.ParseInt(strings.TrimSpace(idStr), 10, 64); err == nil && id == cardID {
+				return true
+			}
+		}
+	}
+	return strings.Contains(content, fmt.Sprintf(`data-card-id="%d"`, cardID))
+}
+
+// projectCardSet은 보고서 생성 요청에 포함된 카드 ID 집합입니다.
+func projectCardSet(cards []CardForAI) map[int64]bool {
+	set := make(map[int64]bool, len(cards))
+	for _, c := range cards {
+		set[c.ID] = true
+	}
+	return set
+}
+
+// insertCitations는 tx 안에서 문서의 인용 목록을 저장합니다.
+// 검색만 되었던 카드(ordinal NULL)가 새로 인용되면 인용 번호를 채웁니다.
+func insertCitations(ctx context.Context, tx *sql.Tx, docID int64, citations []documentCitation) error {
+	for _, c := range citations {
+		var ordinal interface{}
+		if c.Ordinal > 0 {
+			ordinal = c.Ordinal
+		}
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO document_citations (document_id, card_id, ordinal) VALUES (?, ?, ?)
+			ON CONFLICT (document_id, card_id) DO UPDATE SET ordinal = COALESCE(document_citations.ordinal, excluded.ordinal)`,
+			docID, c.CardID, ordinal,
+		)
+		if err != nil {
+			return fmt.Errorf("인용 정보 저장 실패: %w", err)
+		}
+	}
+	return nil
+}
+
+// documentCitationOrdinals는 문서에 이미 인용 번호가 매겨진 카드와 그 번호입니다.
+func documentCitationOrdinals(ctx context.Context, docID int64) (map[int64]int, error) {
+	rows, err := db.QueryContext(ctx, "SELECT card_id, ordinal FROM document_citations WHERE document_id = ? AND ordinal IS NOT NULL", docID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ordinals := make(map[int64]int)
+	for rows.Next() {
+		var cardID int64
+		var ordinal int
+		if err := rows.Scan(&cardID, &ordinal); err != nil {
+			return nil, err
+		}
+		ordinals[cardID] = ordinal
+	}
+	return ordinals, rows.Err()
+}
+
+// DocumentSource는 GET /api/documents/{id}/sources 응답 항목입니다.
+type DocumentSource struct {
+	CardID   int64  `json:"card_id"`
+	Ordinal  int    `json:"ordinal,omitempty"`
+	CardText string `json:"cardtext"`
+	CardURL  string `json:"cardurl"`
+	Category string `json:"category"`
+	// InContent는 현재 본문에 이 카드의 인용 표시가 남아 있는지 여부입니다 (편집으로 지워졌을 수 있음).
+	InContent bool `json:"in_content"`
+}
+
+// handleDocumentSources는 GET /api/documents/{id}/sources 요청을 처리합니다.
+// 본문 인용 번호 순서로, 본문에 인용되지 않고 검색만 된 카드는 그 뒤에 반환합니다.
+func handleDocumentSources(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+	docID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
+		return
+	}
+
+	var content string
+	err = db.QueryRowContext(r.Context(), "SELECT content FROM documents WHERE id = ? AND user_id = ?", docID, userID).Scan(&content)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			httpError(w, r, "문서를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		} else {
+			httpError(w, r, "문서 조회 실패", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT dc.card_id, COALESCE(dc.ordinal, 0), c.cardtext, COALESCE(c.cardurl, ''), COALESCE(c.category, '')
+		FROM document_citations dc
+		JOIN cards c ON c.id = dc.card_id
+		WHERE dc.document_id = ?`, docID)
+	if err != nil {
+		httpError(w, r, "출처 조회 실패", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	sources := []DocumentSource{}
+	for rows.Next() {
+		var s DocumentSource
+		if err := rows.Scan(&s.CardID, &s.Ordinal, &s.CardText, &s.CardURL, &s.Category); err != nil {
+			httpError(w, r, "DB 스캔 실패", http.StatusInternalServerError)
+			return
+		}
+		s.InContent = citedInContent(content, s.CardID)
+		sources = append(sources, s)
+	}
+	sort.SliceStable(sources, func(i, j int) bool {
+		oi, oj := sources[i].Ordinal, sources[j].Ordinal
+		if (oi == 0) != (oj == 0) {
+			return oi != 0
+		}
+		if oi != oj {
+			return oi < oj
+		}
+		return sources[i].CardID < sources[j].CardID
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sources)
+}
+
+// CitingDocument는 GET /api/cards/{id}/documents 응답 항목입니다.
+type CitingDocument struct {
+	ID        int64     `json:"id"`
+	Title     string    `json:"title"`
+	Status    string    `json:"status"`
+	Ordinal   int       `json:"ordinal,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// handleCardDocuments는 GET /api/cards/{id}/documents 요청을 처리합니다. 카드를 출처로 사용한 문서 목록입니다.
+func handleCardDocuments(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+	cardID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := cardProjectID(r.Context(), cardID, userID); err != nil {
+		httpError(w, r, "카드를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT d.id, d.title, d.status, COALESCE(dc.ordinal, 0), d.updated_at
+		FROM document_citations dc
+		JOIN documents d ON d.id = dc.document_id
+		WHERE dc.card_id = ? AND d.user_id = ?
+		ORDER BY d.updated_at DESC`, cardID, userID)
+	if err != nil {
+		httpError(w, r, "문서 목록 조회 실패", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	documents := []CitingDocument{}
+	for rows.Next() {
+		var d CitingDocument
+		if err := rows.Scan(&d.ID, &d.Title, &d.Status, &d.Ordinal, &d.UpdatedAt); err != nil {
+			httpError(w, r, "DB 스캔 실패", http.StatusInternalServerError)
+			return
+		}
+		documents = append(documents, d)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(documents)
+}
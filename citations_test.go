@@ -0,0 +1,119 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestApplyCitationsFrom(t *testing.T) {
+	projectCards := map[int64]bool{3: true, 5: true, 7: true, 9: true}
+	tests := []struct {
+		name        string
+		content     string
+		retrieved   []int64
+		existing    map[int64]int
+		wantContent string
+		want        []documentCitation
+	}{
+		{
+			"처음 나온 순서대로 번호",
+			"가 [card:7] 나 [card:3, 7] 다",
+			nil, nil,
+			"가 [card:7] 나 [card:3][card:7] 다",
+			[]documentCitation{{7, 1}, {3, 2}},
+		},
+		{
+			"지어낸 ID는 지움",
+			"가 [card:99] 나 [card:5,42]",
+			nil, nil,
+			"가  나 [card:5]",
+			[]documentCitation{{5, 1}},
+		},
+		{
+			"기존 번호는 유지하고 새 카드는 다음 번호부터",
+			"[card:9] [card:3] [card:5]",
+			nil, map[int64]int{3: 1, 7: 4},
+			"[card:9] [card:3] [card:5]",
+			[]documentCitation{{9, 5}, {5, 6}},
+		},
+		{
+			"인용하지 않은 검색 카드는 번호 없이",
+			"[card:3]",
+			[]int64{3, 5, 42, 5}, nil,
+			"[card:3]",
+			[]documentCitation{{3, 1}, {5, 0}},
+		},
+		{
+			"기존 카드는 검색 목록에 있어도 다시 넣지 않음",
+			"본문",
+			[]int64{3, 9}, map[int64]int{3: 1},
+			"본문",
+			[]documentCitation{{9, 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, citations := applyCitationsFrom(tt.content, projectCards, tt.retrieved, tt.existing)
+			if content != tt.wantContent {
+				t.Errorf("본문 = %q, want %q", content, tt.wantContent)
+			}
+			if !slices.Equal(citations, tt.want) {
+				t.Errorf("인용 = %v, want %v", citations, tt.want)
+			}
+		})
+	}
+}
+
+func TestCitationSups(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		ordinals map[int64]int
+		want     string
+	}{
+		{
+			"저장된 번호 사용",
+			"가[card:5] 나[card:3]",
+			map[int64]int{3: 1, 5: 2},
+			`가<sup class="citation" data-card-id="5">[2]</sup> 나<sup class="citation" data-card-id="3">[1]</sup>`,
+		},
+		{
+			"번호 없는 카드는 가장 큰 번호 다음부터",
+			"[card:8][card:3] [card:8] [card:9]",
+			map[int64]int{3: 4},
+			`<sup class="citation" data-card-id="8">[5]</sup><sup class="citation" data-card-id="3">[4]</sup> ` +
+				`<sup class="citation" data-card-id="8">[5]</sup> <sup class="citation" data-card-id="9">[6]</sup>`,
+		},
+		{
+			"번호 목록이 없음",
+			"[card:2, 4]",
+			nil,
+			`<sup class="citation" data-card-id="2">[1]</sup><sup class="citation" data-card-id="4">[2]</sup>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := citationSups(tt.content, tt.ordinals); got != tt.want {
+				t.Errorf("citationSups = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCitedInContent(t *testing.T) {
+	tests := []struct {
+		content string
+		cardID  int64
+		want    bool
+	}{
+		{"가 [card:3, 12]", 12, true},
+		{"가 [card:12]", 1, false},
+		{`예전 <sup class="citation" data-card-id="7">[1]</sup>`, 7, true},
+		{"[card:70]", 7, false},
+	}
+	for _, tt := range tests {
+		if got := citedInContent(tt.content, tt.cardID); got != tt.want {
+			t.Errorf("citedInContent(%q, %d) = %v, want %v", tt.content, tt.cardID, got, tt.want)
+		}
+	}
+}
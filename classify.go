@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// 새 카드 자동 분류
+//
+// createCard가 저장한 카드를 백그라운드 작업으로 프로젝트의 기존 카테고리 중 가장 가까운 곳에 넣습니다.
+// 카테고리마다 카드 임베딩 평균(중심)을 구하고, 새 카드와 코사인 유사도가 가장 높은 카테고리를 고릅니다.
+// 유사도(category_confidence)가 classify.min_confidence 이상이면 카테고리를 바꾸고, 낮으면 '미분류'로 두고
+// 가장 가까운 카테고리를 suggested_category로 남겨 사용자가 검토하게 합니다.
+
+// clearClassification은 클러스터링처럼 카테고리를 새로 정할 때 자동 분류 결과를 지우는 SET 절입니다.
+const clearClassification = "category_confidence = NULL, suggested_category = NULL"
+
+// classifySamplesPerCategory는 카테고리 중심을 구할 때 쓰는 카테고리별 최근 카드 수입니다.
+const classifySamplesPerCategory = 50
+
+// cardClassification은 카드 하나의 분류 결과입니다.
+type cardClassification struct {
+	Category   string
+	Confidence float64
+}
+
+// setClassification은 DB에서 읽은 자동 분류 결과를 카드에 채웁니다.
+func (c *Card) setClassification(confidence sql.NullFloat64, suggested sql.NullString) {
+	if confidence.Valid {
+		c.CategoryConfidence = &confidence.Float64
+	}
+	c.SuggestedCategory = suggested.String
+}
+
+// classifyCard는 text와 가장 가까운 프로젝트 카테고리를 찾습니다. 분류된 카드가 하나도 없으면 ok가 false입니다.
+func classifyCard(ctx context.Context, projectID, cardID int64, text string) (result cardClassification, ok bool, err error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT cardtext, category FROM cards WHERE project_id = ? AND id != ? AND category IS NOT NULL AND category NOT IN ('', ?) AND cardtext != '' ORDER BY id DESC",
+		projectID, cardID, uncategorizedCategory,
+	)
+	if err != nil {
+		return result, false, err
+	}
+	defer rows.Close()
+
+	texts := []string{text}
+	var categories []string
+	perCategory := make(map[string]int)
+	for rows.Next() {
+		var cardText, category string
+		if err := rows.Scan(&cardText, &category); err != nil {
+			return result, false, err
+		}
+		if perCategory[category] >= classifySamplesPerCategory {
+			continue
+		}
+		perCategory[category]++
+		texts = append(texts, cardText)
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		return result, false, err
+	}
+	if len(categories) == 0 {
+		return result, false, nil
+	}
+
+	vecs, err := embedTexts(ctx, texts)
+	if err != nil {
+		return result, false, err
+	}
+
+	centroids := make(map[string][]float32)
+	for i, category := range categories {
+		vec := vecs[i+1]
+		centroid, exists := centroids[category]
+		if !exists {
+			centroid = make([]float32, len(vec))
+			centroids[category] = centroid
+		}
+		if len(centroid) != len(vec) {
+			continue
+		}
+		// 길이를 맞춘 벡터를 더해 긴 카드가 중심을 끌어가지 않게 합니다.
+		norm := float32(vectorNorm(vec))
+		if norm == 0 {
+			continue
+		}
+		for j := range vec {
+			centroid[j] += vec[j] / norm
+		}
+	}
+
+	result.Confidence = -1
+	for category, centroid := range centroids {
+		if score := cosineSimilarity(vecs[0], centroid); score > result.Confidence {
+			result = cardClassification{Category: category, Confidence: score}
+		}
+	}
+	return result, true, nil
+}
+
+// classifyCardJob은 새 카드를 기존 카테고리로 분류하는 백그라운드 작업입니다.
+// 그 사이 사용자가 카테고리를 정했거나 클러스터링이 실행되었다면 덮어쓰지 않습니다.
+func classifyCardJob(cardID int64, projectID int64, text string, info requestInfo) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		ctx = context.WithValue(ctx, requestInfoKey, &info)
+		c, ok, err := classifyCard(ctx, projectID, cardID, text)
+		if err != nil {
+			return fmt.Errorf("카드 %d 자동 분류 실패: %w", cardID, err)
+		}
+		if !ok {
+			return nil
+		}
+
+		data := map[string]interface{}{"id": cardID, "category_confidence": c.Confidence}
+		var result sql.Result
+		if c.Confidence >= cfg.Classify.MinConfidence {
+			data["category"] = c.Category
+			result, err = db.ExecContext(ctx,
+				"UPDATE cards SET category = ?, category_confidence = ?, suggested_category = NULL WHERE id = ? AND category = ? AND category_confidence IS NULL",
+				c.Category, c.Confidence, cardID, uncategorizedCategory,
+			)
+		} else {
+			data["suggested_category"] = c.Category
+			result, err = db.ExecContext(ctx,
+				"UPDATE cards SET category_confidence = ?, suggested_category = ? WHERE id = ? AND category = ? AND category_confidence IS NULL",
+				c.Confidence, c.Category, cardID, uncategorizedCategory,
+			)
+		}
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			publishProjectEvent(ctx, projectID, eventCardUpdated, data)
+		}
+		return nil
+	}
+}
@@ -1,21 +1,30 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
 )
 
 // Python AI 서버 /cards/cluster 엔드포인트에 보내는 요청 형식
+// NumClusters가 0이면 AI 서버가 카드 수에 맞춰 클러스터 개수를 정합니다.
 type ClusterAIRequest struct {
-	Cards []ClusterCard `json:"cards"`
+	Cards       []ClusterCard `json:"cards"`
+	NumClusters int           `json:"num_clusters,omitempty"`
 }
 type ClusterCard struct {
 	ID      int64  `json:"id"`
 	Content string `json:"content"`
+	// 저장해 둔 임베딩. 있으면 AI 서버가 카드를 다시 임베딩하지 않습니다.
+	Embedding []float32 `json:"embedding,omitempty"`
+	// 로컬 엔진이 카테고리 이름을 지을 때 쓰는 태그 (AI 서버에는 보내지 않음)
+	Tags []string `json:"-"`
 }
 
 // Python AI 서버 /cards/cluster 엔드포인트에서 받는 응답 형식
@@ -27,124 +36,481 @@ type ClusterInfo struct {
 	CardIDs      []int64 `json:"card_ids"`
 }
 
+const (
+	clusterScopeAll           = "all"
+	clusterScopeUncategorized = "uncategorized"
+
+	// auto: AI 서버로 묶고, AI 서버를 쓸 수 없으면 로컬 엔진으로 묶습니다.
+	clusterEngineAuto  = "auto"
+	clusterEngineAI    = "ai"
+	clusterEngineLocal = "local"
+
+	uncategorizedCategory = "미분류"
+	minClusters           = 2
+	maxClusters           = 20
+	maxCategoryNameLen    = 100
+)
+
+// ClusterOptions는 POST /api/projects/cluster 요청 본문입니다. 본문 없이 호출하면
+// 프로젝트의 모든 카드를 AI 서버가 정한 개수로 묶어 바로 저장합니다.
+type ClusterOptions struct {
+	K      int      `json:"k"`       // 클러스터 개수 (2~20, 0이면 자동)
+	Scope  string   `json:"scope"`   // all(기본) 또는 uncategorized
+	Tags   []string `json:"tags"`    // 이 태그 중 하나라도 가진 카드만 묶습니다
+	DryRun bool     `json:"dry_run"` // true면 저장하지 않고 제안만 반환합니다
+	Engine string   `json:"engine"`  // auto, ai, local (없으면 engine 쿼리 파라미터, 그다음 cluster.engine 설정)
+}
+
+// ClusterProposal은 dry_run 응답이자 POST /api/projects/{id}/cluster/apply 요청 본문입니다.
+// CardIDs는 클러스터링 대상 카드이며, 적용하면 Clusters에 들어 있지 않은 대상 카드는 '미분류'가 됩니다.
+type ClusterProposal struct {
+	CardIDs  []int64       `json:"card_ids"`
+	Clusters []ClusterInfo `json:"clusters"`
+	// 제안을 만든 엔진 (ai 또는 local). 적용할 때는 무시합니다.
+	Engine string `json:"engine,omitempty"`
+	// 한 카테고리를 나눈 제안이면 그 카테고리. 적용하면 클러스터가 이 카테고리의 하위 카테고리가 됩니다.
+	Parent string `json:"parent,omitempty"`
+}
+
+// errInvalidClusters는 적용하려는 클러스터 제안이 잘못되었을 때 반환됩니다.
+var errInvalidClusters = errors.New("잘못된 클러스터 제안")
+
 // POST /api/projects/cluster?project_id={id}
 func handleCluster(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		http.Error(w, "POST 메소드만 지원합니다.", http.StatusMethodNotAllowed)
+		httpError(w, r, "POST 메소드만 지원합니다.", http.StatusMethodNotAllowed)
 		return
 	}
 
 	userID, ok := r.Context().Value(userContextKey).(int64)
 	if !ok {
-		http.Error(w, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
 		return
 	}
 
 	projectIDStr := r.URL.Query().Get("project_id")
 	if projectIDStr == "" {
-		http.Error(w, "project_id 쿼리 파라미터가 필요합니다", http.StatusBadRequest)
+		httpError(w, r, "project_id 쿼리 파라미터가 필요합니다", http.StatusBadRequest)
 		return
 	}
 	projectID, err := strconv.ParseInt(projectIDStr, 10, 64)
 	if err != nil {
-		http.Error(w, "잘못된 project_id", http.StatusBadRequest)
+		httpError(w, r, "잘못된 project_id", http.StatusBadRequest)
 		return
 	}
 
-	rows, err := db.Query("SELECT id, cardtext FROM cards WHERE project_id = ? AND user_id = ?", projectID, userID)
+	var opts ClusterOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil && err != io.EOF {
+		httpError(w, r, "잘못된 JSON 형식", http.StatusBadRequest)
+		return
+	}
+	if err := opts.normalize(r); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	aiRequest, err := clusterCandidates(r.Context(), projectID, userID, opts)
 	if err != nil {
-		http.Error(w, "카드 목록 조회 실패: "+err.Error(), http.StatusInternalServerError)
+		httpError(w, r, "카드 목록 조회 실패: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setUsageProject(r.Context(), projectID)
+	proposal, ok := proposeClusters(w, r, aiRequest, opts)
+	if !ok {
 		return
 	}
+	if opts.DryRun {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(proposal)
+		return
+	}
+
+	// 전체 카드를 묶을 때는 예전처럼 프로젝트의 모든 카드를 초기화합니다.
+	scope := proposal.CardIDs
+	if opts.Scope == clusterScopeAll && len(opts.Tags) == 0 {
+		scope = nil
+	}
+	runID, err := applyClusters(r.Context(), projectID, userID, clusterRunSourceCluster, "", scope, proposal.Clusters)
+	if err != nil {
+		httpError(w, r, "카테고리 업데이트 실패: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	publishProjectEvent(r.Context(), projectID, eventCardsClustered, proposal.Clusters)
+
+	// 응답 본문은 예전 그대로 두고, 되돌릴 때 쓸 실행 ID는 헤더로 알려 줍니다.
+	w.Header().Set("X-Cluster-Run-ID", strconv.FormatInt(runID, 10))
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "카드 클러스터링 및 업데이트가 성공적으로 완료되었습니다.")
+}
+
+// normalize는 비어 있는 옵션에 기본값을 채우고 값이 올바른지 확인합니다.
+// engine은 본문, engine 쿼리 파라미터, cluster.engine 설정 순으로 정합니다.
+func (o *ClusterOptions) normalize(r *http.Request) error {
+	if o.Scope == "" {
+		o.Scope = clusterScopeAll
+	}
+	if o.Engine == "" {
+		o.Engine = r.URL.Query().Get("engine")
+	}
+	if o.Engine == "" {
+		o.Engine = cfg.Cluster.Engine
+	}
+	if !validClusterEngine(o.Engine) {
+		return errors.New("잘못된 engine 값 (auto, ai, local)")
+	}
+	if o.Scope != clusterScopeAll && o.Scope != clusterScopeUncategorized {
+		return errors.New("잘못된 scope 값 (all, uncategorized)")
+	}
+	if o.K != 0 && (o.K < minClusters || o.K > maxClusters) {
+		return fmt.Errorf("k는 %d~%d 사이여야 합니다", minClusters, maxClusters)
+	}
+	return nil
+}
+
+// proposeClusters는 opts.Engine으로 aiRequest의 카드를 묶은 제안을 만들고 X-Cluster-Engine 헤더를 붙입니다.
+// 카드가 없거나 AI 서버 오류로 묶지 못하면 오류 응답을 쓰고 ok가 false입니다.
+func proposeClusters(w http.ResponseWriter, r *http.Request, aiRequest ClusterAIRequest, opts ClusterOptions) (proposal ClusterProposal, ok bool) {
+	if len(aiRequest.Cards) == 0 {
+		httpError(w, r, "클러스터링할 카드가 없습니다.", http.StatusBadRequest)
+		return proposal, false
+	}
+	if opts.K > len(aiRequest.Cards) {
+		httpError(w, r, fmt.Sprintf("k(%d)가 대상 카드 수(%d)보다 많습니다", opts.K, len(aiRequest.Cards)), http.StatusBadRequest)
+		return proposal, false
+	}
+	aiRequest.NumClusters = opts.K
+
+	proposal = ClusterProposal{CardIDs: make([]int64, len(aiRequest.Cards)), Engine: clusterEngineAI}
+	for i, card := range aiRequest.Cards {
+		proposal.CardIDs[i] = card.ID
+	}
+	if opts.Engine == clusterEngineLocal {
+		proposal.Clusters, proposal.Engine = localClusters(aiRequest.Cards, opts.K), clusterEngineLocal
+	} else {
+		attachEmbeddings(r.Context(), aiRequest.Cards)
+		var aiResponse ClusterAIResponse
+		if err := aiPost(r.Context(), "/cards/cluster", aiRequest, &aiResponse); err != nil {
+			if opts.Engine == clusterEngineAI || r.Context().Err() != nil {
+				writeAIError(w, r, "카드 클러스터링", err)
+				return proposal, false
+			}
+			slog.Warn("AI 클러스터링 실패, 로컬 엔진으로 묶습니다", "request_id", requestIDFrom(r.Context()), "error", err)
+			w.Header().Set("X-AI-Degraded", "cluster")
+			proposal.Clusters, proposal.Engine = localClusters(aiRequest.Cards, opts.K), clusterEngineLocal
+		} else {
+			proposal.Clusters = aiResponse.Clusters
+		}
+	}
+	w.Header().Set("X-Cluster-Engine", proposal.Engine)
+	return proposal, true
+}
+
+// clusterCandidates는 opts의 범위와 태그 조건에 맞는 프로젝트 카드를 AI 요청 형식으로 모읍니다.
+func clusterCandidates(ctx context.Context, projectID, userID int64, opts ClusterOptions) (ClusterAIRequest, error) {
+	query := "SELECT id, cardtext, COALESCE(cardtags, '') FROM cards WHERE project_id = ? AND user_id = ?"
+	args := []interface{}{projectID, userID}
+	if opts.Scope == clusterScopeUncategorized {
+		query += " AND (category IS NULL OR category = '' OR category = ?)"
+		args = append(args, uncategorizedCategory)
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return ClusterAIRequest{}, err
+	}
 	defer rows.Close()
 
+	wanted := make(map[string]bool, len(opts.Tags))
+	for _, tag := range opts.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			wanted[tag] = true
+		}
+	}
+
 	var aiRequest ClusterAIRequest
 	for rows.Next() {
 		var card ClusterCard
-		if err := rows.Scan(&card.ID, &card.Content); err != nil {
-			http.Error(w, "DB 스캔 실패: "+err.Error(), http.StatusInternalServerError)
-			return
+		var tags string
+		if err := rows.Scan(&card.ID, &card.Content, &tags); err != nil {
+			return ClusterAIRequest{}, err
+		}
+		card.Tags = splitTags(tags)
+		if len(wanted) > 0 && !hasAnyTag(card.Tags, wanted) {
+			continue
 		}
 		aiRequest.Cards = append(aiRequest.Cards, card)
 	}
+	return aiRequest, rows.Err()
+}
 
-	if len(aiRequest.Cards) == 0 {
-		http.Error(w, "클러스터링할 카드가 없습니다.", http.StatusBadRequest)
+// attachEmbeddings는 카드에 저장된(없으면 새로 받은) 임베딩을 붙입니다.
+// 임베딩을 받지 못하면 AI 서버가 직접 임베딩하도록 비워 둡니다.
+func attachEmbeddings(ctx context.Context, cards []ClusterCard) {
+	texts := make([]string, len(cards))
+	for i, card := range cards {
+		texts[i] = card.Content
+	}
+	vecs, err := embedTexts(ctx, texts)
+	if err != nil {
+		slog.Warn("클러스터링용 임베딩 조회 실패, AI 서버가 임베딩합니다", "request_id", requestIDFrom(ctx), "error", err)
 		return
 	}
+	for i := range cards {
+		cards[i].Embedding = vecs[i]
+	}
+}
+
+func validClusterEngine(engine string) bool {
+	return engine == clusterEngineAuto || engine == clusterEngineAI || engine == clusterEngineLocal
+}
+
+// splitTags는 쉼표로 구분된 cardtags를 공백을 정리한 태그 목록으로 나눕니다.
+func splitTags(tags string) []string {
+	var result []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+func hasAnyTag(tags []string, wanted map[string]bool) bool {
+	for _, tag := range tags {
+		if wanted[tag] {
+			return true
+		}
+	}
+	return false
+}
 
-	reqBytes, err := json.Marshal(aiRequest)
+// applyClusters는 scope 카드를 '미분류'로 되돌린 뒤 클러스터마다 카테고리를 저장하고 실행 기록의 ID를 반환합니다.
+// scope가 nil이면 프로젝트의 모든 카드를 되돌리고 카테고리 계층도 지웁니다. 바뀌는 카드의 이전 카테고리와
+// 실행 직전 계층은 cluster_run_cards, cluster_run_category_parents에 남깁니다.
+// parent가 있으면 scope 카드를 '미분류' 대신 parent로 되돌리고, 클러스터를 parent의 하위 카테고리로 저장합니다.
+func applyClusters(ctx context.Context, projectID, userID int64, source, parent string, scope []int64, clusters []ClusterInfo) (int64, error) {
+	clustersJSON, err := json.Marshal(clusters)
 	if err != nil {
-		http.Error(w, "AI 요청 JSON 직렬화 실패: "+err.Error(), http.StatusInternalServerError)
-		return
+		return 0, err
+	}
+
+	// 트랜잭션을 사용하여 여러 업데이트를 원자적으로 처리합니다.
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("DB 트랜잭션 시작 실패: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		"INSERT INTO cluster_runs (project_id, user_id, source, clusters, parent) VALUES (?, ?, ?, ?, NULLIF(?, ''))",
+		projectID, userID, source, string(clustersJSON), parent,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("클러스터링 기록 저장 실패: %w", err)
+	}
+	runID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	// 바뀔 수 있는 카드(대상 카드와 클러스터에 든 카드)의 현재 카테고리와 자동 분류 결과를 남깁니다.
+	snapshot := "INSERT OR IGNORE INTO cluster_run_cards (run_id, card_id, previous_category, previous_confidence, previous_suggested) SELECT ?, id, category, category_confidence, suggested_category FROM cards WHERE project_id = ?"
+	args := []interface{}{runID, projectID}
+	if scope != nil {
+		touched := append([]int64(nil), scope...)
+		for _, cluster := range clusters {
+			touched = append(touched, cluster.CardIDs...)
+		}
+		if len(touched) == 0 {
+			touched = []int64{0} // 빈 목록이면 아무 카드도 고르지 않습니다 (id 0인 카드는 없음)
+		}
+		snapshot += " AND id IN (?" + strings.Repeat(",?", len(touched)-1) + ")"
+		args = idArgs(args, touched)
+	}
+	result, err = tx.ExecContext(ctx, snapshot, args...)
+	if err != nil {
+		return 0, fmt.Errorf("이전 카테고리 저장 실패: %w", err)
+	}
+	snapshotted, _ := result.RowsAffected()
+	if _, err := tx.ExecContext(ctx, "UPDATE cluster_runs SET card_count = ? WHERE id = ?", snapshotted, runID); err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO cluster_run_category_parents (run_id, name, parent) SELECT ?, name, parent FROM category_parents WHERE project_id = ?",
+		runID, projectID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("이전 카테고리 계층 저장 실패: %w", err)
+	}
+
+	resetTo := uncategorizedCategory
+	if parent != "" {
+		resetTo = parent
+	}
+	if scope == nil {
+		_, err = tx.ExecContext(ctx, "UPDATE cards SET category = ?, "+clearClassification+" WHERE project_id = ?", resetTo, projectID)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, "DELETE FROM category_parents WHERE project_id = ?", projectID)
+		}
+	} else if len(scope) > 0 {
+		_, err = tx.ExecContext(ctx,
+			"UPDATE cards SET category = ?, "+clearClassification+" WHERE project_id = ? AND id IN (?"+strings.Repeat(",?", len(scope)-1)+")",
+			idArgs([]interface{}{resetTo, projectID}, scope)...,
+		)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("카테고리 초기화 실패: %w", err)
+	}
+
+	for _, cluster := range clusters {
+		if len(cluster.CardIDs) == 0 {
+			continue
+		}
+		query := "UPDATE cards SET category = ?, " + clearClassification + " WHERE project_id = ? AND id IN (?" + strings.Repeat(",?", len(cluster.CardIDs)-1) + ")"
+		if _, err := tx.ExecContext(ctx, query, idArgs([]interface{}{cluster.CategoryName, projectID}, cluster.CardIDs)...); err != nil {
+			return 0, err
+		}
+		if parent == "" || cluster.CategoryName == parent || cluster.CategoryName == uncategorizedCategory {
+			continue
+		}
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO category_parents (project_id, name, parent) VALUES (?, ?, ?) ON CONFLICT (project_id, name) DO UPDATE SET parent = excluded.parent",
+			projectID, cluster.CategoryName, parent,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("카테고리 계층 저장 실패: %w", err)
+		}
 	}
 
-	resp, err := http.Post("http://127.0.0.1:8000/cards/cluster", "application/json", bytes.NewBuffer(reqBytes))
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("DB 트랜잭션 커밋 실패: %w", err)
+	}
+	return runID, nil
+}
+
+func idArgs(prefix []interface{}, ids []int64) []interface{} {
+	args := make([]interface{}, 0, len(prefix)+len(ids))
+	args = append(args, prefix...)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return args
+}
+
+// handleClusterApply는 POST /api/projects/{id}/cluster/apply 요청을 처리합니다.
+// dry_run으로 받은 제안(필요하면 사용자가 이름이나 카드를 고친 것)을 그대로 저장합니다.
+func handleClusterApply(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+	projectID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
 	if err != nil {
-		http.Error(w, "AI 서버 호출 실패: "+err.Error(), http.StatusInternalServerError)
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		http.Error(w, fmt.Sprintf("AI 서버가 오류를 반환했습니다 (상태 코드: %d)", resp.StatusCode), http.StatusInternalServerError)
+	var proposal ClusterProposal
+	if err := json.NewDecoder(r.Body).Decode(&proposal); err != nil {
+		httpError(w, r, "잘못된 JSON 형식", http.StatusBadRequest)
 		return
 	}
 
-	var aiResponse ClusterAIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&aiResponse); err != nil {
-		http.Error(w, "AI 응답 JSON 디코딩 실패: "+err.Error(), http.StatusInternalServerError)
+	var owner int64
+	err = db.QueryRowContext(r.Context(), "SELECT user_id FROM projects WHERE id = ?", projectID).Scan(&owner)
+	if err != nil || owner != userID {
+		httpError(w, r, "프로젝트를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
 		return
 	}
 
-	// 트랜잭션을 사용하여 여러 업데이트를 원자적으로 처리합니다.
-	tx, err := db.Begin()
-	if err != nil {
-		http.Error(w, "DB 트랜잭잭션 시작 실패: "+err.Error(), http.StatusInternalServerError)
+	if err := validateClusterProposal(r.Context(), projectID, userID, &proposal); err != nil {
+		if errors.Is(err, errInvalidClusters) {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+		} else {
+			httpError(w, r, "카드 목록 조회 실패: "+err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
-	// 먼저 모든 카드를 '미분류'로 초기화
-	_, err = tx.Exec("UPDATE cards SET category = '미분류' WHERE project_id = ?", projectID)
+	runID, err := applyClusters(r.Context(), projectID, userID, clusterRunSourceApply, proposal.Parent, proposal.CardIDs, proposal.Clusters)
 	if err != nil {
-		tx.Rollback()
-		http.Error(w, "카테고리 초기화 실패: "+err.Error(), http.StatusInternalServerError)
+		httpError(w, r, "카테고리 업데이트 실패: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	publishProjectEvent(r.Context(), projectID, eventCardsClustered, proposal.Clusters)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		ClusterProposal
+		RunID int64 `json:"run_id"`
+	}{proposal, runID})
+}
 
-	for _, cluster := range aiResponse.Clusters {
+// validateClusterProposal은 제안의 카드가 모두 프로젝트 카드이고 한 클러스터에만 속하는지 확인합니다.
+// card_ids를 비우면 클러스터에 들어 있는 카드만 대상으로 봅니다. 빈 클러스터는 버리고 이름의 공백을 정리합니다.
+func validateClusterProposal(ctx context.Context, projectID, userID int64, p *ClusterProposal) error {
+	projectCards, err := getAllCardsForProject(ctx, projectID, userID)
+	if err != nil {
+		return err
+	}
+	owned := projectCardSet(projectCards)
+
+	inScope := make(map[int64]bool, len(p.CardIDs))
+	for _, id := range p.CardIDs {
+		if !owned[id] {
+			return fmt.Errorf("%w: 프로젝트에 없는 카드입니다 (%d)", errInvalidClusters, id)
+		}
+		inScope[id] = true
+	}
+
+	assigned := make(map[int64]bool)
+	clusters := make([]ClusterInfo, 0, len(p.Clusters))
+	for _, cluster := range p.Clusters {
+		cluster.CategoryName = strings.TrimSpace(cluster.CategoryName)
 		if len(cluster.CardIDs) == 0 {
 			continue
 		}
-		args := make([]interface{}, len(cluster.CardIDs)+2)
-		args[0] = cluster.CategoryName
-		args[1] = projectID
-		for i, id := range cluster.CardIDs {
-			args[i+2] = id
+		if cluster.CategoryName == "" || len([]rune(cluster.CategoryName)) > maxCategoryNameLen {
+			return fmt.Errorf("%w: category_name은 1~%d자여야 합니다", errInvalidClusters, maxCategoryNameLen)
 		}
+		for _, id := range cluster.CardIDs {
+			if !owned[id] {
+				return fmt.Errorf("%w: 프로젝트에 없는 카드입니다 (%d)", errInvalidClusters, id)
+			}
+			if len(p.CardIDs) > 0 && !inScope[id] {
+				return fmt.Errorf("%w: card_ids에 없는 카드입니다 (%d)", errInvalidClusters, id)
+			}
+			if assigned[id] {
+				return fmt.Errorf("%w: 카드가 여러 클러스터에 들어 있습니다 (%d)", errInvalidClusters, id)
+			}
+			assigned[id] = true
+		}
+		clusters = append(clusters, cluster)
+	}
+	if len(clusters) == 0 {
+		return fmt.Errorf("%w: 적용할 클러스터가 없습니다", errInvalidClusters)
+	}
 
-		query := "UPDATE cards SET category = ? WHERE project_id = ? AND id IN (?" + strings.Repeat(",?", len(cluster.CardIDs)-1) + ")"
-
-		stmt, err := tx.Prepare(query)
+	if p.Parent = strings.TrimSpace(p.Parent); p.Parent != "" {
+		names, parents, err := projectCategories(ctx, projectID, userID)
 		if err != nil {
-			tx.Rollback()
-			http.Error(w, "DB 구문 준비 실패: "+err.Error(), http.StatusInternalServerError)
-			return
+			return err
 		}
-		defer stmt.Close()
-
-		if _, err := stmt.Exec(args...); err != nil {
-			tx.Rollback()
-			http.Error(w, "카테고리 업데이트 실패: "+err.Error(), http.StatusInternalServerError)
-			return
+		if !names[p.Parent] || p.Parent == uncategorizedCategory {
+			return fmt.Errorf("%w: 프로젝트에 상위 카테고리 %q가 없습니다", errInvalidClusters, p.Parent)
+		}
+		for _, cluster := range clusters {
+			if subcategoryConflict(names, parents, p.Parent, cluster.CategoryName) {
+				return fmt.Errorf("%w: %q는 %q의 조상이거나 다른 가지에 있는 카테고리입니다", errInvalidClusters, cluster.CategoryName, p.Parent)
+			}
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		http.Error(w, "DB 트랜잭션 커밋 실패: "+err.Error(), http.StatusInternalServerError)
-		return
+	if len(p.CardIDs) == 0 {
+		for _, cluster := range clusters {
+			p.CardIDs = append(p.CardIDs, cluster.CardIDs...)
+		}
 	}
-
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprint(w, "카드 클러스터링 및 업데이트가 성공적으로 완료되었습니다.")
+	p.Clusters = clusters
+	return nil
 }
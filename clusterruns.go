@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 클러스터링 실행 기록의 source 값
+const (
+	clusterRunSourceCluster    = "cluster"
+	clusterRunSourceApply      = "apply"
+	clusterRunSourceSubcluster = "subcluster" // 한 카테고리를 하위 카테고리로 나눔 (categories.go)
+)
+
+var (
+	errClusterRunNotFound   = errors.New("클러스터링 기록을 찾을 수 없습니다")
+	errClusterRunReverted   = errors.New("이미 되돌린 클러스터링입니다")
+	errClusterRunSuperseded = errors.New("이후에 실행한 클러스터링이 있습니다. 최근 실행부터 차례로 되돌리세요")
+)
+
+// ClusterRun은 클러스터링 한 번의 실행 기록입니다. CardCount는 카테고리가 바뀔 수 있었던(이전 값을 남긴) 카드 수입니다.
+type ClusterRun struct {
+	ID         int64         `json:"id"`
+	ProjectID  int64         `json:"project_id"`
+	Source     string        `json:"source"`
+	Clusters   []ClusterInfo `json:"clusters"`
+	CardCount  int           `json:"card_count"`
+	CreatedAt  time.Time     `json:"created_at"`
+	RevertedAt *time.Time    `json:"reverted_at"`
+	// 한 카테고리를 하위 카테고리로 나눈 실행이면 그 카테고리
+	Parent string `json:"parent,omitempty"`
+}
+
+// handleClusterRuns는 GET /api/projects/{id}/cluster-runs 요청을 처리합니다. 최근 실행부터 반환합니다.
+func handleClusterRuns(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+	projectID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
+		return
+	}
+
+	var projectOwnerID int64
+	err = db.QueryRowContext(r.Context(), "SELECT user_id FROM projects WHERE id = ?", projectID).Scan(&projectOwnerID)
+	if err != nil || projectOwnerID != userID {
+		httpError(w, r, "프로젝트를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(),
+		"SELECT id, project_id, source, COALESCE(parent, ''), clusters, card_count, created_at, reverted_at FROM cluster_runs WHERE project_id = ? ORDER BY id DESC",
+		projectID,
+	)
+	if err != nil {
+		httpError(w, r, "클러스터링 기록 조회 실패", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	runs := []ClusterRun{}
+	for rows.Next() {
+		run, err := scanClusterRun(rows)
+		if err != nil {
+			httpError(w, r, "DB 스캔 실패", http.StatusInternalServerError)
+			return
+		}
+		runs = append(runs, run)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
+
+// handleClusterRunRevert는 POST /api/projects/{id}/cluster-runs/{run}/revert 요청을 처리합니다.
+// 실행 직전에 남긴 카테고리로 카드를 되돌립니다. 그 사이 손으로 바꾼 카테고리도 실행 직전 값으로 돌아갑니다.
+// 여러 번 실행했다면 되돌리지 않은 가장 최근 실행부터 하나씩 되돌릴 수 있습니다.
+func handleClusterRunRevert(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+	projectID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
+		return
+	}
+	runID, err := strconv.ParseInt(r.PathValue("run"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 run 경로", http.StatusBadRequest)
+		return
+	}
+
+	run, err := revertClusterRun(r.Context(), projectID, userID, runID)
+	if err != nil {
+		switch {
+		case errors.Is(err, errClusterRunNotFound):
+			httpError(w, r, err.Error(), http.StatusNotFound)
+		case errors.Is(err, errClusterRunReverted), errors.Is(err, errClusterRunSuperseded):
+			httpError(w, r, err.Error(), http.StatusConflict)
+		default:
+			httpError(w, r, "클러스터링 되돌리기 실패: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	publishProjectEvent(r.Context(), projectID, eventClusterReverted, run)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// revertClusterRun은 한 트랜잭션에서 실행 기록을 확인하고 카드 카테고리를 복원한 뒤 기록에 되돌린 시각을 남깁니다.
+func revertClusterRun(ctx context.Context, projectID, userID, runID int64) (ClusterRun, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return ClusterRun{}, err
+	}
+	defer tx.Rollback()
+
+	const selectRun = "SELECT id, project_id, source, COALESCE(parent, ''), clusters, card_count, created_at, reverted_at FROM cluster_runs WHERE id = ? AND project_id = ? AND user_id = ?"
+	run, err := scanClusterRun(tx.QueryRowContext(ctx, selectRun, runID, projectID, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ClusterRun{}, errClusterRunNotFound
+		}
+		return ClusterRun{}, err
+	}
+	if run.RevertedAt != nil {
+		return ClusterRun{}, errClusterRunReverted
+	}
+	var later int
+	err = tx.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM cluster_runs WHERE project_id = ? AND id > ? AND reverted_at IS NULL",
+		projectID, runID,
+	).Scan(&later)
+	if err != nil {
+		return ClusterRun{}, err
+	}
+	if later > 0 {
+		return ClusterRun{}, errClusterRunSuperseded
+	}
+
+	// 카테고리와 자동 분류 결과(category_confidence, suggested_category)를 실행 직전으로 되돌립니다.
+	// 실행 뒤에 삭제된 카드는 건너뜁니다.
+	_, err = tx.ExecContext(ctx, `
+		UPDATE cards SET (category, category_confidence, suggested_category) = (
+			SELECT previous_category, previous_confidence, previous_suggested FROM cluster_run_cards WHERE run_id = ? AND card_id = cards.id
+		)
+		WHERE project_id = ? AND id IN (SELECT card_id FROM cluster_run_cards WHERE run_id = ?)`,
+		runID, projectID, runID,
+	)
+	if err != nil {
+		return ClusterRun{}, err
+	}
+	// 카테고리 계층도 실행 직전으로 되돌립니다.
+	if _, err := tx.ExecContext(ctx, "DELETE FROM category_parents WHERE project_id = ?", projectID); err != nil {
+		return ClusterRun{}, err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO category_parents (project_id, name, parent) SELECT ?, name, parent FROM cluster_run_category_parents WHERE run_id = ?",
+		projectID, runID,
+	)
+	if err != nil {
+		return ClusterRun{}, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE cluster_runs SET reverted_at = CURRENT_TIMESTAMP WHERE id = ?", runID); err != nil {
+		return ClusterRun{}, err
+	}
+	if run, err = scanClusterRun(tx.QueryRowContext(ctx, selectRun, runID, projectID, userID)); err != nil {
+		return ClusterRun{}, err
+	}
+	return run, tx.Commit()
+}
+
+// scanClusterRun은 cluster_runs 한 행(id, project_id, source, parent, clusters, card_count, created_at, reverted_at)을 읽습니다.
+func scanClusterRun(row interface{ Scan(...interface{}) error }) (ClusterRun, error) {
+	var run ClusterRun
+	var clusters string
+	var revertedAt sql.NullTime
+	if err := row.Scan(&run.ID, &run.ProjectID, &run.Source, &run.Parent, &clusters, &run.CardCount, &run.CreatedAt, &revertedAt); err != nil {
+		return ClusterRun{}, err
+	}
+	if err := json.Unmarshal([]byte(clusters), &run.Clusters); err != nil {
+		return ClusterRun{}, err
+	}
+	if revertedAt.Valid {
+		run.RevertedAt = &revertedAt.Time
+	}
+	return run, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+// cardCategoryRow는 카드의 카테고리와 자동 분류 결과를 읽습니다.
+func cardCategoryRow(t *testing.T, cardID int64) (string, sql.NullFloat64, sql.NullString) {
+	t.Helper()
+	var category string
+	var confidence sql.NullFloat64
+	var suggested sql.NullString
+	err := db.QueryRow("SELECT category, category_confidence, suggested_category FROM cards WHERE id = ?", cardID).Scan(&category, &confidence, &suggested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return category, confidence, suggested
+}
+
+func TestRevertClusterRunRestoresClassification(t *testing.T) {
+	setupTestDB(t)
+	for _, q := range []string{
+		"INSERT INTO users (id, username) VALUES (1, 'tester')",
+		"INSERT INTO projects (id, projectname, user_id) VALUES (1, 'p', 1)",
+		"INSERT INTO cards (id, cardtext, category, category_confidence, suggested_category, project_id, user_id) VALUES (1, 'a', 'Go', 0.82, NULL, 1, 1)",
+		"INSERT INTO cards (id, cardtext, category, category_confidence, suggested_category, project_id, user_id) VALUES (2, 'b', '미분류', 0.41, 'Rust', 1, 1)",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	runID, err := applyClusters(ctx, 1, 1, "cluster", "", nil, []ClusterInfo{{CategoryName: "언어", CardIDs: []int64{1, 2}}})
+	if err != nil {
+		t.Fatalf("클러스터 적용 실패: %v", err)
+	}
+	if category, confidence, suggested := cardCategoryRow(t, 2); category != "언어" || confidence.Valid || suggested.Valid {
+		t.Fatalf("적용 뒤 카드 2 = %s, %v, %v, want 언어와 빈 자동 분류", category, confidence, suggested)
+	}
+
+	if _, err := revertClusterRun(ctx, 1, 1, runID); err != nil {
+		t.Fatalf("되돌리기 실패: %v", err)
+	}
+	tests := []struct {
+		cardID     int64
+		category   string
+		confidence sql.NullFloat64
+		suggested  sql.NullString
+	}{
+		{1, "Go", sql.NullFloat64{Float64: 0.82, Valid: true}, sql.NullString{}},
+		{2, "미분류", sql.NullFloat64{Float64: 0.41, Valid: true}, sql.NullString{String: "Rust", Valid: true}},
+	}
+	for _, tt := range tests {
+		category, confidence, suggested := cardCategoryRow(t, tt.cardID)
+		if category != tt.category || confidence != tt.confidence || suggested != tt.suggested {
+			t.Errorf("되돌린 뒤 카드 %d = %s, %v, %v, want %s, %v, %v",
+				tt.cardID, category, confidence, suggested, tt.category, tt.confidence, tt.suggested)
+		}
+	}
+}
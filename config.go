@@ -3,12 +3,13 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"log/slog"
 	"os"
+	"strings"
 
 	"github.com/joho/godotenv"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/github"
-	_ "github.com/mattn/go-sqlite3"
 )
 
 var (
@@ -18,31 +19,48 @@ var (
 
 func loadConfig() error {
 	if err := godotenv.Load(); err != nil {
-		fmt.Println("경고: .env 파일을 찾을 수 없습니다.")
+		slog.Warn(".env 파일을 찾을 수 없습니다.")
 	}
 
+	var err error
+	cfg, err = parseConfig(os.Args[1:])
+	if err != nil {
+		return fmt.Errorf("설정 검증 실패: %w", err)
+	}
+	if err = setupLogger(cfg.Log); err != nil {
+		return err
+	}
+
+	settings := make([]any, 0, len(cfg.redactedLines()))
+	for _, line := range cfg.redactedLines() {
+		key, value, _ := strings.Cut(line, "=")
+		settings = append(settings, slog.String(key, value))
+	}
+	slog.Info("설정 로드", settings...)
+
 	githubOauthConfig = &oauth2.Config{
-		ClientID:     os.Getenv("GITHUB_CLIENT_ID"),
-		ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
+		ClientID:     cfg.GitHub.ClientID,
+		ClientSecret: cfg.GitHub.ClientSecret,
 		Endpoint:     github.Endpoint,
-		RedirectURL:  "https://oli.tailda0655.ts.net/auth/github/callback",
+		RedirectURL:  cfg.GitHub.RedirectURL,
 		Scopes:       []string{"read:user"},
 	}
 	if githubOauthConfig.ClientID == "" {
-		fmt.Println("경고: GITHUB_CLIENT_ID가 설정되지 않았습니다.")
+		slog.Warn("GITHUB_CLIENT_ID가 설정되지 않았습니다.")
 	}
 
-	var err error
-	db, err = sql.Open("sqlite3", "./main.db")
+	jwtKeys, err = loadKeyManager(cfg.JWT)
 	if err != nil {
-		return fmt.Errorf("DB 열기 실패: %w", err)
+		return fmt.Errorf("JWT 키 로드 실패: %w", err)
 	}
 
+	db = openDB(cfg.DB.Path)
+
 	if err = setupDatabase(); err != nil {
 		return fmt.Errorf("DB 테이블 생성 실패: %w", err)
 	}
 
-	fmt.Println("DB 및 설정 로드 완료.")
+	slog.Info("DB 및 설정 로드 완료.", "db_path", cfg.DB.Path)
 	return nil
 }
 
@@ -84,11 +102,6 @@ func setupDatabase() error {
 		return err
 	}
 
-	// documents 테이블에 대한 스키마 마이그레이션 (기존 코드와 동일한 패턴)
-	if err := migrateDocumentsTable(); err != nil {
-		return err
-	}
-
 	// cards 테이블에 category 컬럼이 없는 구버전 스키마를 위한 마이그레이션
 	rows, err := db.Query("PRAGMA table_info(cards)")
 	if err != nil {
@@ -115,13 +128,21 @@ func setupDatabase() error {
 	rows.Close()
 
 	if !categoryColumnExists {
-		fmt.Println("기존 cards 테이블에 'category' 컬럼이 없어 추가합니다...")
+		slog.Info("기존 cards 테이블에 'category' 컬럼이 없어 추가합니다...")
 		_, err := db.Exec("ALTER TABLE cards ADD COLUMN category TEXT")
 		if err != nil {
 			return err
 		}
 	}
 
+	// 자동 분류 결과: category_confidence(기존 카테고리와의 유사도), suggested_category(유사도가 낮아 검토가 필요한 카드의 후보)
+	if err := addColumnIfMissing("cards", "category_confidence", "REAL"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("cards", "suggested_category", "TEXT"); err != nil {
+		return err
+	}
+
 	createDocumentsTableSQL := `
 	CREATE TABLE IF NOT EXISTS documents (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -138,13 +159,211 @@ func setupDatabase() error {
 		return err
 	}
 
+	// documents 테이블에 대한 스키마 마이그레이션 (기존 코드와 동일한 패턴)
+	if err := migrateDocumentsTable(); err != nil {
+		return err
+	}
+
+	// 문서가 출처로 사용한 카드. ordinal은 본문 인용 번호이며, 검색만 하고 인용하지 않은 카드는 NULL입니다.
+	createDocumentCitationsTableSQL := `
+	CREATE TABLE IF NOT EXISTS document_citations (
+		document_id INTEGER NOT NULL,
+		card_id INTEGER NOT NULL,
+		ordinal INTEGER,
+		PRIMARY KEY (document_id, card_id),
+		FOREIGN KEY (document_id) REFERENCES documents (id),
+		FOREIGN KEY (card_id) REFERENCES cards (id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_document_citations_card ON document_citations (card_id);`
+	if _, err := db.Exec(createDocumentCitationsTableSQL); err != nil {
+		return err
+	}
+
+	// 프로젝트별 보고서 템플릿. sections는 섹션 제목의 JSON 배열입니다.
+	createReportTemplatesTableSQL := `
+	CREATE TABLE IF NOT EXISTS report_templates (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		sections TEXT NOT NULL DEFAULT '[]',
+		tone TEXT NOT NULL DEFAULT '',
+		length TEXT NOT NULL DEFAULT '',
+		language TEXT NOT NULL DEFAULT '',
+		audience TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (project_id) REFERENCES projects (id),
+		FOREIGN KEY (user_id) REFERENCES users (id)
+	);`
+	if _, err := db.Exec(createReportTemplatesTableSQL); err != nil {
+		return err
+	}
+
+	// 문서 리비전. 섹션 재생성이나 문서 확장처럼 AI가 문서를 바꿀 때 바뀌기 전과 후의 내용을 version별로 남깁니다.
+	// source: 'snapshot'(변경 직전 내용), 'regenerate', 'expand'(섹션), 'document_expand'(문서 전체 확장)
+	createDocumentRevisionsTableSQL := `
+	CREATE TABLE IF NOT EXISTS document_revisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		document_id INTEGER NOT NULL,
+		version INTEGER NOT NULL,
+		content TEXT NOT NULL,
+		source TEXT NOT NULL,
+		section_title TEXT NOT NULL DEFAULT '',
+		instruction TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (document_id, version),
+		FOREIGN KEY (document_id) REFERENCES documents (id)
+	);`
+	if _, err := db.Exec(createDocumentRevisionsTableSQL); err != nil {
+		return err
+	}
+
+	// 클러스터링 실행 기록. cluster_run_cards에 실행 직전 카드별 카테고리를 남겨 되돌릴 수 있게 합니다.
+	// source: 'cluster'(AI 결과를 바로 저장), 'apply'(미리보기 제안을 적용), 'subcluster'(한 카테고리를 하위 카테고리로 나눔), reverted_at: 되돌린 시각
+	createClusterRunsTableSQL := `
+	CREATE TABLE IF NOT EXISTS cluster_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		source TEXT NOT NULL,
+		clusters TEXT NOT NULL DEFAULT '[]',
+		card_count INTEGER NOT NULL DEFAULT 0,
+		reverted_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (project_id) REFERENCES projects (id),
+		FOREIGN KEY (user_id) REFERENCES users (id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_cluster_runs_project ON cluster_runs (project_id, id);
+	CREATE TABLE IF NOT EXISTS cluster_run_cards (
+		run_id INTEGER NOT NULL,
+		card_id INTEGER NOT NULL,
+		previous_category TEXT,
+		PRIMARY KEY (run_id, card_id),
+		FOREIGN KEY (run_id) REFERENCES cluster_runs (id)
+	);`
+	if _, err := db.Exec(createClusterRunsTableSQL); err != nil {
+		return err
+	}
+	// parent: 한 카테고리를 하위 카테고리로 나눈 실행이면 그 카테고리 이름
+	if err := addColumnIfMissing("cluster_runs", "parent", "TEXT"); err != nil {
+		return err
+	}
+	// previous_confidence, previous_suggested: 실행 직전 카드의 자동 분류 결과 (되돌릴 때 함께 복원)
+	if err := addColumnIfMissing("cluster_run_cards", "previous_confidence", "REAL"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("cluster_run_cards", "previous_suggested", "TEXT"); err != nil {
+		return err
+	}
+
+	// 카테고리 계층. 카드는 카테고리를 이름으로 가리키므로 하위 카테고리 이름 → 상위 카테고리 이름만 저장하며,
+	// 여기에 없는 카테고리는 최상위입니다. cluster_run_category_parents에는 실행 직전 계층을 남깁니다.
+	createCategoryParentsTableSQL := `
+	CREATE TABLE IF NOT EXISTS category_parents (
+		project_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		parent TEXT NOT NULL,
+		PRIMARY KEY (project_id, name),
+		FOREIGN KEY (project_id) REFERENCES projects (id)
+	);
+	CREATE TABLE IF NOT EXISTS cluster_run_category_parents (
+		run_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		parent TEXT NOT NULL,
+		PRIMARY KEY (run_id, name),
+		FOREIGN KEY (run_id) REFERENCES cluster_runs (id)
+	);`
+	if _, err := db.Exec(createCategoryParentsTableSQL); err != nil {
+		return err
+	}
+
+	// 카드 내용 임베딩. 같은 내용의 카드는 벡터를 공유하며, vector는 dims개의 little-endian float32입니다.
+	createCardEmbeddingsTableSQL := `
+	CREATE TABLE IF NOT EXISTS card_embeddings (
+		content_hash TEXT NOT NULL,
+		model TEXT NOT NULL,
+		dims INTEGER NOT NULL,
+		vector BLOB NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (content_hash, model)
+	);`
+	if _, err := db.Exec(createCardEmbeddingsTableSQL); err != nil {
+		return err
+	}
+
+	// AI 서버 호출 기록. 일일 한도 검사와 GET /api/me/usage에 쓰입니다.
+	// project_id는 백그라운드 작업처럼 프로젝트가 없는 호출이면 NULL, status는 'ok' 또는 'error'입니다.
+	createAIUsageTableSQL := `
+	CREATE TABLE IF NOT EXISTS ai_usage (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		project_id INTEGER,
+		endpoint TEXT NOT NULL,
+		input_bytes INTEGER NOT NULL DEFAULT 0,
+		duration_ms INTEGER NOT NULL DEFAULT 0,
+		input_tokens INTEGER NOT NULL DEFAULT 0,
+		output_tokens INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_ai_usage_user ON ai_usage (user_id, created_at);`
+	if _, err := db.Exec(createAIUsageTableSQL); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 // migrateDocumentsTable는 documents 테이블의 스키마를 최신 상태로 유지합니다.
 func migrateDocumentsTable() error {
-	// 예시: 만약 나중에 documents 테이블에 'status' 컬럼이 추가된다면,
-	// 아래와 같은 마이그레이션 로직을 추가할 수 있습니다.
-	// 현재는 특별한 변경사항이 없으므로 비워둡니다.
-	return nil
+	// status: 'complete'(정상 생성) 또는 'draft'(스트리밍 생성이 중간에 끊겨 저장된 초안)
+	if err := addColumnIfMissing("documents", "status", "TEXT NOT NULL DEFAULT 'complete'"); err != nil {
+		return err
+	}
+	// version: 내용이 바뀔 때마다 1씩 오르는 낙관적 동시성 제어용 번호 (ETag)
+	if err := addColumnIfMissing("documents", "version", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	// generation_options: 문서를 만들 때 적용한 템플릿·생성 옵션(JSON). 직접 작성했거나 옵션 없이 만든 문서는 NULL
+	if err := addColumnIfMissing("documents", "generation_options", "TEXT"); err != nil {
+		return err
+	}
+	// mode: 'ai'(AI 생성) 또는 'manual'(직접 작성), doc_type: 'notes', 'outline', 'report'
+	if err := addColumnIfMissing("documents", "mode", "TEXT NOT NULL DEFAULT 'ai'"); err != nil {
+		return err
+	}
+	return addColumnIfMissing("documents", "doc_type", "TEXT NOT NULL DEFAULT 'report'")
+}
+
+// addColumnIfMissing은 table에 column이 없을 때만 ALTER TABLE로 추가합니다.
+func addColumnIfMissing(table, column, definition string) error {
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid int
+		var name string
+		var type_ string
+		var notnull bool
+		var dflt_value interface{}
+		var pk int
+		if err := rows.Scan(&cid, &name, &type_, &notnull, &dflt_value, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	slog.Info("스키마 마이그레이션: 컬럼 추가", "table", table, "column", column)
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
 }
\ No newline at end of file
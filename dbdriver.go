@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// openDB는 모든 쿼리의 실행 시간을 기록하는 SQLite 연결을 엽니다.
+// 핸들러 코드는 그대로 db.Query/db.Exec를 사용하면 되고,
+// QueryContext/ExecContext에 요청 컨텍스트를 넘기면 쿼리가 요청 트레이스의 자식 스팬으로 기록됩니다.
+func openDB(dsn string) *sql.DB {
+	return sql.OpenDB(&instrumentedConnector{dsn: dsn, driver: &sqlite3.SQLiteDriver{}})
+}
+
+type instrumentedConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c *instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn}, nil
+}
+
+func (c *instrumentedConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// instrumentedConn은 sqlite3 연결을 감싸 쿼리마다 observeQuery를 호출합니다.
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startQuerySpan(ctx, query)
+	start := time.Now()
+	res, err := execer.ExecContext(ctx, query, args)
+	observeQuery(query, start, err)
+	endSpan(span, err)
+	return res, err
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startQuerySpan(ctx, query)
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	observeQuery(query, start, err)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, query: query}, nil
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+type instrumentedStmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := s.Stmt.(driver.StmtExecContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startQuerySpan(ctx, s.query)
+	start := time.Now()
+	res, err := execer.ExecContext(ctx, args)
+	observeQuery(s.query, start, err)
+	endSpan(span, err)
+	return res, err
+}
+
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := s.Stmt.(driver.StmtQueryContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startQuerySpan(ctx, s.query)
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, args)
+	observeQuery(s.query, start, err)
+	endSpan(span, err)
+	return rows, err
+}
+
+// queryOperation은 쿼리의 첫 단어(select, insert 등)를 메트릭 라벨로 사용합니다.
+func queryOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "other"
+	}
+	switch op := strings.ToLower(fields[0]); op {
+	case "select", "insert", "update", "delete", "pragma", "create", "alter", "with":
+		return op
+	default:
+		return "other"
+	}
+}
+
+func startQuerySpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	op := queryOperation(query)
+	return startChildSpan(ctx, "sqlite "+op,
+		semconv.DBSystemSqlite,
+		semconv.DBOperationName(op),
+		semconv.DBQueryText(query),
+	)
+}
+
+func observeQuery(query string, start time.Time, err error) {
+	op := queryOperation(query)
+	dbQueryDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	if err != nil {
+		dbQueryErrorsTotal.WithLabelValues(op).Inc()
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// errDocumentChanged는 AI가 문서를 확장하는 동안 다른 곳에서 문서가 수정되었을 때 반환됩니다.
+var errDocumentChanged = errors.New("문서를 확장하는 동안 다른 곳에서 문서가 수정되었습니다. 문서를 다시 불러온 뒤 시도하세요")
+
+// AgentExpandRequest는 AI 서버 /agent/expand 엔드포인트에 보낼 요청 본문입니다.
+// 기존 문서(메모, 개요 등)를 바탕으로 DocType 종류의 문서를 프로젝트 카드로 보강해 새로 씁니다.
+type AgentExpandRequest struct {
+	AgentInvokeRequest
+	Format      string `json:"format"`
+	Document    string `json:"document"`
+	SourceType  string `json:"source_type"`
+	Instruction string `json:"instruction"`
+}
+
+// handleDocumentExpand는 POST /api/documents/{id}/expand 요청을 처리합니다.
+// 본문 {"doc_type": "report", "instruction": "...", "generation_options": {...}}로
+// 직접 작성한 메모나 개요를 AI가 프로젝트 카드를 검색해 doc_type(기본 report) 문서로 확장합니다.
+// 바뀌기 전과 후의 내용은 리비전으로 남고, If-Match 헤더를 지원합니다.
+func handleDocumentExpand(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+	docID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		DocType           string             `json:"doc_type"`
+		Instruction       string             `json:"instruction"`
+		GenerationOptions *GenerationOptions `json:"generation_options"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "잘못된 JSON 형식", http.StatusBadRequest)
+		return
+	}
+	if req.DocType == "" {
+		req.DocType = docTypeReport
+	}
+	if !validDocTypes[req.DocType] {
+		httpError(w, r, "잘못된 doc_type 값 (notes, outline, report)", http.StatusBadRequest)
+		return
+	}
+	req.Instruction = strings.TrimSpace(req.Instruction)
+	if len([]rune(req.Instruction)) > maxSectionInstructionLen {
+		httpError(w, r, fmt.Sprintf("instruction은 %d자 이하여야 합니다", maxSectionInstructionLen), http.StatusBadRequest)
+		return
+	}
+
+	docSessions.save(docID)
+
+	var doc Document
+	var options sql.NullString
+	err = db.QueryRowContext(r.Context(),
+		"SELECT title, content, project_id, version, mode, doc_type, generation_options FROM documents WHERE id = ? AND user_id = ?",
+		docID, userID,
+	).Scan(&doc.Title, &doc.Content, &doc.ProjectID, &doc.Version, &doc.Mode, &doc.DocType, &options)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			httpError(w, r, "문서를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		} else {
+			httpError(w, r, "문서 조회 실패", http.StatusInternalServerError)
+		}
+		return
+	}
+	doc.ID, doc.UserID = docID, userID
+	doc.GenerationOptions = parseGenerationOptions(options)
+	setUsageProject(r.Context(), doc.ProjectID)
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etagMatches(ifMatch, doc.Version) {
+		writeVersionConflict(w, r, doc.Version)
+		return
+	}
+
+	// 요청에 생성 옵션을 보내면 그 옵션으로 확장하고 문서에 저장합니다. 없으면 문서에 저장된 옵션을 씁니다.
+	if req.GenerationOptions != nil {
+		opts, err := resolveGenerationOptions(r.Context(), doc.ProjectID, userID, req.GenerationOptions)
+		if err != nil {
+			if errors.Is(err, errInvalidOptions) {
+				httpError(w, r, err.Error(), http.StatusBadRequest)
+			} else {
+				httpError(w, r, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		doc.GenerationOptions = opts
+	}
+
+	var agentReq AgentInvokeRequest
+	if req.GenerationOptions != nil {
+		// 사용자가 방금 고른 카드가 없으면 전체 카드로 바꾸지 않고 400을 반환합니다.
+		agentReq, err = buildAgentRequest(r.Context(), doc.Title, doc.ProjectID, userID, doc.GenerationOptions)
+		if errors.Is(err, errInvalidOptions) {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		agentReq, err = buildDocumentAgentRequest(r.Context(), &doc)
+	}
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	agentReq.DocType = req.DocType
+
+	var aiResponse AgentInvokeResponse
+	err = aiPost(r.Context(), "/agent/expand", AgentExpandRequest{
+		AgentInvokeRequest: agentReq,
+		Format:             detectDocumentFormat(doc.Content),
+		Document:           doc.Content,
+		SourceType:         doc.DocType,
+		Instruction:        req.Instruction,
+	}, &aiResponse)
+	if err != nil {
+		writeAIError(w, r, "AI 문서 확장", err)
+		return
+	}
+
+	doc.DocType = req.DocType
+	err = saveExpandedDocument(r.Context(), &doc, req.Instruction, aiResponse, projectCardSet(agentReq.AllCards))
+	if err != nil {
+		if errors.Is(err, errDocumentChanged) {
+			httpError(w, r, err.Error(), http.StatusConflict)
+		} else {
+			httpError(w, r, "확장한 문서 저장 실패: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	docSessions.replace(docID, doc.Content, doc.Version)
+	publishProjectEvent(r.Context(), doc.ProjectID, eventDocumentUpdated, documentEventData(doc))
+
+	w.Header().Set("ETag", documentETag(doc.Version))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+// saveExpandedDocument는 AI가 확장한 내용으로 문서를 바꾸고 리비전과 인용 정보를 저장합니다.
+// 문서 전체를 바꾸므로 AI 호출 중에 문서가 수정되었으면 errDocumentChanged를 반환합니다.
+// 성공하면 doc의 Content, Version, Status, 생성·수정 시각을 새 값으로 채웁니다.
+func saveExpandedDocument(ctx context.Context, doc *Document, instruction string, ai AgentInvokeResponse, projectCards map[int64]bool) error {
+	existing, err := documentCitationOrdinals(ctx, doc.ID)
+	if err != nil {
+		return fmt.Errorf("인용 정보 조회 실패: %w", err)
+	}
+	content, citations := applyCitationsFrom(ai.Report, projectCards, ai.CardIDs, existing)
+
+	var options interface{}
+	if doc.GenerationOptions != nil {
+		b, err := json.Marshal(doc.GenerationOptions)
+		if err != nil {
+			return err
+		}
+		options = string(b)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 바뀌기 직전 내용을 남깁니다. 문서가 그 사이 수정되었다면 아래 UPDATE가 실패해 함께 취소됩니다.
+	_, err = tx.ExecContext(ctx,
+		"INSERT OR IGNORE INTO document_revisions (document_id, version, content, source) VALUES (?, ?, ?, ?)",
+		doc.ID, doc.Version, doc.Content, revisionSourceSnapshot,
+	)
+	if err != nil {
+		return fmt.Errorf("리비전 저장 실패: %w", err)
+	}
+	result, err := tx.ExecContext(ctx,
+		"UPDATE documents SET content = ?, doc_type = ?, generation_options = ?, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND version = ?",
+		content, doc.DocType, options, doc.ID, doc.Version,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errDocumentChanged
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO document_revisions (document_id, version, content, source, instruction) VALUES (?, ?, ?, ?, ?)",
+		doc.ID, doc.Version+1, content, revisionSourceDocumentExpand, instruction,
+	)
+	if err != nil {
+		return fmt.Errorf("리비전 저장 실패: %w", err)
+	}
+	if err := insertCitations(ctx, tx, doc.ID, citations); err != nil {
+		return err
+	}
+	if err := tx.QueryRowContext(ctx, "SELECT status, created_at, updated_at FROM documents WHERE id = ?", doc.ID).Scan(&doc.Status, &doc.CreatedAt, &doc.UpdatedAt); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	doc.Content, doc.Version = content, doc.Version+1
+	return nil
+}
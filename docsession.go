@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 실시간 문서 편집 세션
+//
+// 같은 문서를 여러 창에서 열면 서버가 문서별 세션 하나를 메모리에 두고,
+// 클라이언트가 보낸 편집 연산(textOp)을 동시에 들어온 다른 연산에 맞게 변환(OT)해 적용한 뒤
+// 모든 참여자에게 중계합니다. 내용은 마지막 편집 후 sessionSaveDelay가 지나면 DB에 저장되며
+// 그때마다 문서 version이 올라갑니다.
+//
+//   - GET  /api/documents/{id}/session: SSE. 처음에 snapshot, 이후 op, saved, deleted 이벤트
+//   - POST /api/documents/{id}/ops: {"client_id": "...", "rev": 기준 리비전, "ops": [...]}
+//
+// 클라이언트는 자신이 보낸 연산이 op 이벤트(같은 client_id)로 돌아오기 전까지 다음 연산을 보내지 않고,
+// 그 사이 받은 다른 참여자의 연산은 transformOps(내 연산, 받은 연산)으로 변환해 적용합니다 (ot.js와 같은 방식).
+const (
+	sessionSaveDelay    = 2 * time.Second
+	sessionHistoryLimit = 1000
+	sessionBufferSize   = 64
+	maxDocumentRunes    = 1 << 20
+	maxOpsBodyBytes     = 1 << 20
+)
+
+var (
+	errSessionClosed   = errors.New("편집 세션이 종료되었습니다")
+	errStaleRevision   = errors.New("편집 세션의 리비전이 맞지 않습니다. 문서를 다시 불러오세요")
+	errDocumentTooLong = errors.New("문서가 너무 깁니다")
+)
+
+type sessionEvent struct {
+	Type string
+	Data interface{}
+}
+
+// docSession은 편집 중인 문서 하나의 상태입니다.
+// rev는 세션이 시작된 뒤 적용된 연산 수이고, history[i]는 리비전 historyStart+i에서 적용된 연산입니다.
+type docSession struct {
+	mu           sync.Mutex
+	docID        int64
+	projectID    int64
+	userID       int64
+	content      []rune
+	rev          int
+	historyStart int
+	history      []textOp
+	version      int64 // DB에 마지막으로 저장된 version
+	dirty        bool
+	saveTimer    *time.Timer
+	subs         map[chan sessionEvent]struct{}
+	closed       bool
+}
+
+type sessionSnapshot struct {
+	Rev     int    `json:"rev"`
+	Content string `json:"content"`
+	Version int64  `json:"version"`
+}
+
+// sessionManager는 문서 ID별 편집 세션을 관리합니다. 잠금 순서는 sessionManager.mu → docSession.mu입니다.
+type sessionManager struct {
+	mu       sync.Mutex
+	sessions map[int64]*docSession
+}
+
+var docSessions *sessionManager
+
+func newSessionManager() *sessionManager {
+	return &sessionManager{sessions: make(map[int64]*docSession)}
+}
+
+// get은 userID가 소유한 문서의 세션을 반환하고, 없으면 DB에서 불러와 새로 만듭니다.
+func (m *sessionManager) get(ctx context.Context, docID, userID int64) (*docSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.sessions[docID]; ok {
+		if s.userID != userID {
+			return nil, sql.ErrNoRows
+		}
+		return s, nil
+	}
+
+	s := &docSession{docID: docID, userID: userID, subs: make(map[chan sessionEvent]struct{})}
+	var content string
+	err := db.QueryRowContext(ctx, "SELECT content, version, project_id FROM documents WHERE id = ? AND user_id = ?", docID, userID).
+		Scan(&content, &s.version, &s.projectID)
+	if err != nil {
+		return nil, err
+	}
+	s.content = []rune(content)
+	m.sessions[docID] = s
+	return s, nil
+}
+
+// subscribe는 세션 이벤트를 받을 채널과 현재 상태를 반환합니다.
+func (s *docSession) subscribe() (chan sessionEvent, sessionSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, sessionSnapshot{}, errSessionClosed
+	}
+	ch := make(chan sessionEvent, sessionBufferSize)
+	s.subs[ch] = struct{}{}
+	return ch, s.snapshotLocked(), nil
+}
+
+func (s *docSession) snapshotLocked() sessionSnapshot {
+	return sessionSnapshot{Rev: s.rev, Content: string(s.content), Version: s.version}
+}
+
+// leave는 구독을 끝냅니다. 마지막 참여자가 나가면 저장하지 않은 내용을 저장하고 세션을 정리합니다.
+func (m *sessionManager) leave(s *docSession, ch chan sessionEvent) {
+	s.mu.Lock()
+	if _, ok := s.subs[ch]; ok {
+		delete(s.subs, ch)
+		close(ch)
+	}
+	if len(s.subs) == 0 && s.dirty {
+		s.flushLocked()
+	}
+	s.mu.Unlock()
+	m.releaseIfIdle(s)
+}
+
+// releaseIfIdle은 참여자도, 저장할 내용도 없는 세션을 메모리에서 지웁니다.
+func (m *sessionManager) releaseIfIdle(s *docSession) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || len(s.subs) > 0 || s.dirty || s.saveTimer != nil {
+		return
+	}
+	s.closed = true
+	if m.sessions[s.docID] == s {
+		delete(m.sessions, s.docID)
+	}
+}
+
+// applyOp는 리비전 baseRev를 기준으로 만든 연산을 그 뒤에 적용된 연산들에 맞게 변환해 적용합니다.
+// 적용된 리비전과 변환된 연산을 반환합니다.
+func (m *sessionManager) applyOp(s *docSession, clientID string, baseRev int, op textOp) (int, textOp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, nil, errSessionClosed
+	}
+	if baseRev > s.rev || baseRev < s.historyStart {
+		return 0, nil, errStaleRevision
+	}
+	for _, concurrent := range s.history[baseRev-s.historyStart:] {
+		var err error
+		if op, _, err = transformOps(op, concurrent); err != nil {
+			return 0, nil, err
+		}
+	}
+	if op.targetLen() > maxDocumentRunes {
+		return 0, nil, errDocumentTooLong
+	}
+	content, err := op.apply(s.content)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	s.content = content
+	s.history = append(s.history, op)
+	if len(s.history) > sessionHistoryLimit {
+		s.history = s.history[1:]
+		s.historyStart++
+	}
+	s.rev++
+	s.dirty = true
+	if s.saveTimer == nil {
+		s.saveTimer = time.AfterFunc(sessionSaveDelay, func() { m.flush(s) })
+	}
+
+	s.broadcastLocked(sessionEvent{Type: "op", Data: map[string]interface{}{
+		"rev":       s.rev,
+		"ops":       op,
+		"client_id": clientID,
+	}})
+	return s.rev, op, nil
+}
+
+// flush는 저장 타이머가 호출합니다.
+func (m *sessionManager) flush(s *docSession) {
+	s.mu.Lock()
+	s.saveTimer = nil
+	if s.dirty && !s.closed {
+		s.flushLocked()
+	}
+	s.mu.Unlock()
+	m.releaseIfIdle(s)
+}
+
+// flushLocked는 세션 내용을 DB에 저장합니다. 저장은 짧으므로 잠금을 잡은 채 실행해
+// 저장 도중 들어온 연산이 같은 version으로 다시 저장되지 않게 합니다.
+func (s *docSession) flushLocked() {
+	if s.saveTimer != nil {
+		s.saveTimer.Stop()
+		s.saveTimer = nil
+	}
+
+	ctx := context.Background()
+	result, err := db.ExecContext(ctx,
+		"UPDATE documents SET content = ?, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND version = ?",
+		string(s.content), s.docID, s.version,
+	)
+	if err != nil {
+		slog.Error("편집 세션 저장 실패", "document_id", s.docID, "error", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// 그 사이 PUT 등으로 DB의 문서가 바뀌었습니다. DB 내용을 기준으로 세션을 다시 시작합니다.
+		slog.Warn("편집 세션 저장 충돌, DB의 문서로 다시 시작합니다", "document_id", s.docID, "version", s.version)
+		var content string
+		if err := db.QueryRowContext(ctx, "SELECT content, version FROM documents WHERE id = ?", s.docID).Scan(&content, &s.version); err != nil {
+			slog.Error("편집 세션 다시 불러오기 실패", "document_id", s.docID, "error", err)
+			return
+		}
+		s.resetLocked([]rune(content))
+		return
+	}
+
+	s.version++
+	s.dirty = false
+	s.broadcastLocked(sessionEvent{Type: "saved", Data: map[string]int64{"version": s.version}})
+	publishProjectEvent(ctx, s.projectID, eventDocumentUpdated, map[string]interface{}{"id": s.docID, "version": s.version})
+}
+
+// save는 문서의 편집 세션에 아직 저장하지 않은 편집이 있으면 바로 저장합니다.
+// 세션 밖에서 DB의 내용을 기준으로 문서를 고치기 전에 호출합니다.
+func (m *sessionManager) save(docID int64) {
+	m.mu.Lock()
+	s, ok := m.sessions[docID]
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dirty && !s.closed {
+		s.flushLocked()
+	}
+}
+
+// resetLocked는 내용을 바꾸고 이전 리비전 기준의 연산을 더 받지 않도록 기록을 비웁니다.
+func (s *docSession) resetLocked(content []rune) {
+	s.content = content
+	s.rev++
+	s.historyStart = s.rev
+	s.history = nil
+	s.dirty = false
+	s.broadcastLocked(sessionEvent{Type: "snapshot", Data: s.snapshotLocked()})
+}
+
+// replace는 PUT으로 문서가 통째로 바뀌었을 때 진행 중인 세션을 새 내용으로 다시 시작합니다.
+func (m *sessionManager) replace(docID int64, content string, version int64) {
+	m.mu.Lock()
+	s, ok := m.sessions[docID]
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if s.saveTimer != nil {
+		s.saveTimer.Stop()
+		s.saveTimer = nil
+	}
+	s.version = version
+	s.resetLocked([]rune(content))
+}
+
+// remove는 문서가 삭제되었을 때 세션을 닫습니다.
+func (m *sessionManager) remove(docID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[docID]
+	if !ok {
+		return
+	}
+	delete(m.sessions, docID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saveTimer != nil {
+		s.saveTimer.Stop()
+		s.saveTimer = nil
+	}
+	s.dirty = false
+	s.broadcastLocked(sessionEvent{Type: "deleted", Data: map[string]int64{"id": docID}})
+	s.closeLocked()
+}
+
+// close는 서버 종료 시 저장하지 않은 내용을 모두 저장하고 참여자 연결을 끊습니다.
+func (m *sessionManager) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for docID, s := range m.sessions {
+		s.mu.Lock()
+		if s.dirty {
+			s.flushLocked()
+		}
+		s.closeLocked()
+		s.mu.Unlock()
+		delete(m.sessions, docID)
+	}
+}
+
+func (s *docSession) closeLocked() {
+	s.closed = true
+	for ch := range s.subs {
+		delete(s.subs, ch)
+		close(ch)
+	}
+}
+
+// broadcastLocked는 모든 참여자에게 이벤트를 보냅니다. 버퍼가 가득 찬 참여자는 연결을 끊어
+// 다시 연결하면서 snapshot부터 받도록 합니다.
+func (s *docSession) broadcastLocked(ev sessionEvent) {
+	for ch := range s.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(s.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (m *sessionManager) sessionCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+// handleDocumentSession은 GET /api/documents/{id}/session 요청을 처리합니다.
+func handleDocumentSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+	docID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
+		return
+	}
+
+	var s *docSession
+	var ch chan sessionEvent
+	var snapshot sessionSnapshot
+	for {
+		s, err = docSessions.get(r.Context(), docID, userID)
+		if err != nil {
+			writeSessionLookupError(w, r, err)
+			return
+		}
+		// 세션이 막 정리된 경우에는 새 세션을 만들어 다시 시도합니다.
+		if ch, snapshot, err = s.subscribe(); err == nil {
+			break
+		}
+	}
+	defer docSessions.leave(s, ch)
+
+	sse, err := newSSEWriter(w)
+	if err != nil {
+		httpError(w, r, "스트리밍 응답을 시작할 수 없습니다: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := sse.send("snapshot", snapshot); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(eventKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := sse.send(ev.Type, ev.Data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := sse.comment("keepalive"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handleDocumentOps는 POST /api/documents/{id}/ops 요청을 처리합니다.
+func handleDocumentOps(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+	docID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		ClientID string `json:"client_id"`
+		Rev      int    `json:"rev"`
+		Ops      textOp `json:"ops"`
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxOpsBodyBytes)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "잘못된 JSON 형식: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.ClientID == "" {
+		httpError(w, r, "client_id가 필요합니다", http.StatusBadRequest)
+		return
+	}
+
+	var rev int
+	var applied textOp
+	for {
+		s, err := docSessions.get(r.Context(), docID, userID)
+		if err != nil {
+			writeSessionLookupError(w, r, err)
+			return
+		}
+		rev, applied, err = docSessions.applyOp(s, req.ClientID, req.Rev, req.Ops)
+		if errors.Is(err, errSessionClosed) {
+			continue
+		}
+		switch {
+		case errors.Is(err, errStaleRevision):
+			httpError(w, r, err.Error(), http.StatusConflict)
+			return
+		case errors.Is(err, errDocumentTooLong):
+			httpError(w, r, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		case err != nil:
+			httpError(w, r, "편집 연산을 적용할 수 없습니다: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		break
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"rev": rev, "ops": applied})
+}
+
+func writeSessionLookupError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		httpError(w, r, "문서를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		return
+	}
+	httpError(w, r, "문서 조회 실패", http.StatusInternalServerError)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// setupTestDB는 테스트 동안 db와 projectEvents를 임시 DB와 새 허브로 바꿉니다.
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	prevDB, prevEvents := db, projectEvents
+	db = openDB(filepath.Join(t.TempDir(), "test.db"))
+	projectEvents = newProjectHub()
+	t.Cleanup(func() {
+		db.Close()
+		db, projectEvents = prevDB, prevEvents
+	})
+	if err := setupDatabase(); err != nil {
+		t.Fatalf("DB 테이블 생성 실패: %v", err)
+	}
+}
+
+// setupSessionTest는 임시 DB에 문서 하나를 만들고 그 문서의 편집 세션을 엽니다.
+func setupSessionTest(t *testing.T, content string) (*sessionManager, *docSession, int64) {
+	t.Helper()
+	setupTestDB(t)
+
+	if _, err := db.Exec("INSERT INTO users (id, username) VALUES (1, 'tester')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO projects (id, projectname, user_id) VALUES (1, 'p', 1)"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := db.Exec("INSERT INTO documents (title, content, project_id, user_id) VALUES ('doc', ?, 1, 1)", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docID, _ := result.LastInsertId()
+
+	m := newSessionManager()
+	s, err := m.get(context.Background(), docID, 1)
+	if err != nil {
+		t.Fatalf("세션 열기 실패: %v", err)
+	}
+	return m, s, docID
+}
+
+func documentRow(t *testing.T, docID int64) (string, int64) {
+	t.Helper()
+	var content string
+	var version int64
+	if err := db.QueryRow("SELECT content, version FROM documents WHERE id = ?", docID).Scan(&content, &version); err != nil {
+		t.Fatal(err)
+	}
+	return content, version
+}
+
+func TestSessionResetsOnStaleVersion(t *testing.T) {
+	m, s, docID := setupSessionTest(t, "hello")
+	ch, snap, err := s.subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := m.applyOp(s, "c1", snap.Rev, mustOp(t, `[5, " world"]`)); err != nil {
+		t.Fatalf("연산 적용 실패: %v", err)
+	}
+	<-ch // op
+
+	// 세션 밖에서 DB의 문서가 바뀌면 세션이 알고 있는 version은 낡은 값이 됩니다.
+	if _, err := db.Exec("UPDATE documents SET content = 'replaced', version = version + 1 WHERE id = ?", docID); err != nil {
+		t.Fatal(err)
+	}
+	m.flush(s)
+
+	ev := <-ch
+	if ev.Type != "snapshot" {
+		t.Fatalf("이벤트 = %s, want snapshot", ev.Type)
+	}
+	reset := ev.Data.(sessionSnapshot)
+	content, version := documentRow(t, docID)
+	if reset.Content != "replaced" || content != "replaced" {
+		t.Errorf("세션 내용 = %q, DB 내용 = %q, want %q", reset.Content, content, "replaced")
+	}
+	if reset.Version != version {
+		t.Errorf("세션 version = %d, want DB version %d", reset.Version, version)
+	}
+
+	// 다시 시작하기 전 리비전을 기준으로 만든 연산은 받지 않습니다.
+	if _, _, err := m.applyOp(s, "c1", snap.Rev, mustOp(t, `[5, "!"]`)); !errors.Is(err, errStaleRevision) {
+		t.Errorf("낡은 리비전의 연산 오류 = %v, want errStaleRevision", err)
+	}
+	if _, _, err := m.applyOp(s, "c1", reset.Rev, mustOp(t, `[8, "!"]`)); err != nil {
+		t.Errorf("새 리비전의 연산 적용 실패: %v", err)
+	}
+	m.leave(s, ch)
+}
+
+func TestSessionFlushesOnClose(t *testing.T) {
+	m, s, docID := setupSessionTest(t, "abc")
+	ch, snap, err := s.subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.applyOp(s, "c1", snap.Rev, mustOp(t, `[3, "d"]`)); err != nil {
+		t.Fatalf("연산 적용 실패: %v", err)
+	}
+
+	m.close()
+
+	content, version := documentRow(t, docID)
+	if content != "abcd" {
+		t.Errorf("종료 후 DB 내용 = %q, want %q", content, "abcd")
+	}
+	if version != snap.Version+1 {
+		t.Errorf("종료 후 version = %d, want %d", version, snap.Version+1)
+	}
+	for range ch {
+		// op, saved 이벤트를 받은 뒤 채널이 닫혀야 합니다.
+	}
+	if m.sessionCount() != 0 {
+		t.Errorf("종료 후 세션 수 = %d, want 0", m.sessionCount())
+	}
+	if _, _, err := m.applyOp(s, "c1", snap.Rev+1, mustOp(t, `[4, "e"]`)); !errors.Is(err, errSessionClosed) {
+		t.Errorf("종료 후 연산 오류 = %v, want errSessionClosed", err)
+	}
+}
+
+// putDocument는 updateDocument로 PUT /api/documents/{id} 요청을 보냅니다.
+func putDocument(t *testing.T, docID int64, ifMatch, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	body := strings.NewReader(`{"title": "doc", "content": ` + strconv.Quote(content) + `}`)
+	r := httptest.NewRequest(http.MethodPut, "/api/documents/"+strconv.FormatInt(docID, 10), body)
+	if ifMatch != "" {
+		r.Header.Set("If-Match", ifMatch)
+	}
+	w := httptest.NewRecorder()
+	updateDocument(w, r, 1, strconv.FormatInt(docID, 10))
+	return w
+}
+
+func TestPutDoesNotClobberUnsavedSessionEdits(t *testing.T) {
+	m, s, docID := setupSessionTest(t, "abc")
+	prevSessions := docSessions
+	docSessions = m
+	t.Cleanup(func() { docSessions = prevSessions })
+
+	ch, snap, err := s.subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 다른 참여자가 편집했지만 저장 타이머가 아직 돌지 않았습니다.
+	if _, _, err := m.applyOp(s, "c1", snap.Rev, mustOp(t, `[3, "d"]`)); err != nil {
+		t.Fatalf("연산 적용 실패: %v", err)
+	}
+
+	// 편집 전에 문서를 불러온 클라이언트의 PUT은 거부되어야 합니다.
+	w := putDocument(t, docID, documentETag(snap.Version), "overwritten")
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("PUT 상태 = %d, want 412", w.Code)
+	}
+	content, version := documentRow(t, docID)
+	if content != "abcd" {
+		t.Errorf("DB 내용 = %q, want 세션 편집이 저장된 %q", content, "abcd")
+	}
+	if got := w.Header().Get("ETag"); got != documentETag(version) {
+		t.Errorf("ETag = %s, want %s", got, documentETag(version))
+	}
+
+	// 최신 ETag로 다시 보내면 수정되고 세션도 새 내용으로 다시 시작합니다.
+	if w := putDocument(t, docID, documentETag(version), "fresh"); w.Code != http.StatusOK {
+		t.Fatalf("최신 ETag로 보낸 PUT 상태 = %d, want 200", w.Code)
+	}
+	s.mu.Lock()
+	sessionContent := string(s.content)
+	s.mu.Unlock()
+	if sessionContent != "fresh" {
+		t.Errorf("세션 내용 = %q, want %q", sessionContent, "fresh")
+	}
+	m.leave(s, ch)
+}
+
+func TestPutRequiresIfMatch(t *testing.T) {
+	_, _, docID := setupSessionTest(t, "abc")
+
+	if w := putDocument(t, docID, "", "x"); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("If-Match 없는 PUT 상태 = %d, want 428", w.Code)
+	}
+	if w := putDocument(t, docID, "*", strings.Repeat("가", maxDocumentRunes+1)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("너무 긴 PUT 상태 = %d, want 413", w.Code)
+	}
+	if content, _ := documentRow(t, docID); content != "abc" {
+		t.Errorf("거부된 PUT 뒤 DB 내용 = %q, want %q", content, "abc")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// streamDocumentWithAI는 createDocumentWithAI의 스트리밍 버전입니다 (POST /api/documents/stream).
+// 요청 본문과 검사는 createDocument가 처리하며, 응답은 Server-Sent Events입니다.
+//
+// 브라우저로 보내는 이벤트:
+//   - progress: AI 에이전트 진행 상황 {"stage": "thinking"|"searching"|"writing", "categories": [...], "found": n, "card_ids": [...]}
+//   - token: 생성 중인 보고서 조각 {"text": "..."}
+//   - reset: 지금까지 받은 token을 버려야 함 (도구 호출 전 중간 응답이었음)
+//   - done: 저장된 문서 {"document": Document}
+//   - error: {"message": "...", "request_id": "...", "document": Document(초안이 저장된 경우)}
+//
+// 생성이 끝나기 전에 브라우저 연결이 끊기거나 AI 서버가 실패하면,
+// 그때까지 받은 내용을 status가 "draft"인 문서로 저장합니다.
+func streamDocumentWithAI(w http.ResponseWriter, r *http.Request, doc *Document) {
+	aiRequestData, ok := prepareAgentRequest(w, r, doc)
+	if !ok {
+		return
+	}
+
+	// AI 서버가 스트림을 열어준 뒤에 브라우저 응답을 시작해야
+	// 회로 차단기나 연결 실패를 일반 오류 응답(503, 502)으로 돌려줄 수 있습니다.
+	stream, err := aiOpenStream(r.Context(), "/agent/stream", aiRequestData)
+	if err != nil {
+		writeAIError(w, r, "AI 문서 생성", err)
+		return
+	}
+
+	sse, err := newSSEWriter(w)
+	if err != nil {
+		stream.close(err)
+		httpError(w, r, "스트리밍 응답을 시작할 수 없습니다: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var report strings.Builder
+	var retrieved []int64
+	var final *AgentInvokeResponse
+	var aiErrDetail string
+	streamErr := stream.each(func(event, data string) error {
+		switch event {
+		case "token":
+			var t struct {
+				Text string `json:"text"`
+			}
+			if err := json.Unmarshal([]byte(data), &t); err != nil {
+				return err
+			}
+			report.WriteString(t.Text)
+		case "reset":
+			report.Reset()
+		case "done":
+			final = &AgentInvokeResponse{}
+			return json.Unmarshal([]byte(data), final)
+		case "error":
+			var e struct {
+				Detail string `json:"detail"`
+			}
+			json.Unmarshal([]byte(data), &e)
+			aiErrDetail = e.Detail
+			return nil
+		case "progress":
+			var p struct {
+				CardIDs []int64 `json:"card_ids"`
+			}
+			if json.Unmarshal([]byte(data), &p) == nil {
+				retrieved = append(retrieved, p.CardIDs...)
+			}
+		default:
+			return nil
+		}
+		return sse.send(event, json.RawMessage(data))
+	})
+	if streamErr == nil && final == nil {
+		streamErr = errors.New("AI 서버 스트림이 완료되지 않고 끝났습니다")
+		if aiErrDetail != "" {
+			streamErr = errors.New(aiErrDetail)
+		}
+	}
+	stream.close(streamErr)
+
+	// 브라우저가 연결을 끊어도 문서는 저장해야 하므로 요청 컨텍스트의 취소를 따르지 않습니다.
+	saveCtx := context.WithoutCancel(r.Context())
+	requestID := requestIDFrom(r.Context())
+
+	projectCards := projectCardSet(aiRequestData.AllCards)
+	if streamErr == nil {
+		content, citations := applyCitations(final.Report, projectCards, final.CardIDs)
+		doc.Content = content
+		doc.Status = documentStatusComplete
+		if err := insertDocument(saveCtx, doc, citations); err != nil {
+			slog.Error("스트리밍 문서 저장 실패", "request_id", requestID, "error", err)
+			sse.send("error", map[string]string{"message": "문서 생성 실패: " + err.Error(), "request_id": requestID})
+			return
+		}
+		publishProjectEvent(saveCtx, doc.ProjectID, eventDocumentCreated, documentEventData(*doc))
+		sse.send("done", map[string]interface{}{"document": doc})
+		return
+	}
+
+	disconnected := r.Context().Err() != nil
+	slog.Warn("스트리밍 문서 생성 중단", "request_id", requestID, "client_disconnected", disconnected, "error", streamErr)
+
+	payload := map[string]interface{}{
+		"message":    "AI 문서 생성이 중간에 중단되었습니다: " + streamErr.Error(),
+		"request_id": requestID,
+	}
+	if report.Len() > 0 {
+		content, citations := applyCitations(report.String(), projectCards, retrieved)
+		doc.Content = content
+		doc.Status = documentStatusDraft
+		if err := insertDocument(saveCtx, doc, citations); err != nil {
+			slog.Error("초안 저장 실패", "request_id", requestID, "error", err)
+		} else {
+			slog.Info("중단된 스트리밍 생성의 초안 저장", "request_id", requestID, "document_id", doc.ID, "length", report.Len())
+			payload["document"] = doc
+			publishProjectEvent(saveCtx, doc.ProjectID, eventDocumentCreated, documentEventData(*doc))
+		}
+	}
+	if !disconnected {
+		sse.send("error", payload)
+	}
+}
@@ -1,15 +1,16 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // AgentInvokeRequest는 AI 서버 /agent/invoke 엔드포인트에 보낼 요청 본문입니다.
@@ -18,6 +19,10 @@ type AgentInvokeRequest struct {
 	AllTags       []string       `json:"all_tags"`
 	AllCategories []CategoryInfo `json:"all_categories"`
 	AllCards      []CardForAI    `json:"all_cards"`
+	// Options는 보고서 형식(섹션, 어조, 분량, 언어, 독자)입니다. 없으면 AI 서버 기본 형식을 씁니다.
+	Options *AgentReportOptions `json:"options,omitempty"`
+	// DocType은 만들 문서 종류(notes, outline, report)입니다.
+	DocType string `json:"doc_type,omitempty"`
 }
 
 // CardForAI는 AI 서버에 카드 정보를 전달하기 위한 구조체입니다.
@@ -27,14 +32,61 @@ type CardForAI struct {
 }
 
 // CategoryInfo는 AI 서버에 카테고리 정보를 전달하기 위한 구조체입니다.
+// CardIDs는 이 카테고리에 직접 속한 카드이며, 하위 카테고리의 카드는 Children에 있습니다.
 type CategoryInfo struct {
-	CategoryName string  `json:"category_name"`
-	CardIDs      []int64 `json:"card_ids"`
+	CategoryName string         `json:"category_name"`
+	CardIDs      []int64        `json:"card_ids"`
+	Children     []CategoryInfo `json:"children,omitempty"`
 }
 
 // AgentInvokeResponse는 AI 서버로부터 받을 응답 본문입니다.
 type AgentInvokeResponse struct {
 	Report string `json:"report"`
+	// CardIDs는 에이전트가 검색해 읽은 카드 ID입니다. 본문에는 [card:ID] 형식으로 인용됩니다.
+	CardIDs []int64 `json:"card_ids"`
+}
+
+// 문서 상태: 스트리밍 생성이 끝나기 전에 연결이 끊기면 그때까지의 내용을 초안으로 저장합니다.
+const (
+	documentStatusComplete = "complete"
+	documentStatusDraft    = "draft"
+)
+
+// 문서를 만든 방식: AI가 생성했거나(ai) 사용자가 직접 작성했습니다(manual).
+const (
+	documentModeAI     = "ai"
+	documentModeManual = "manual"
+)
+
+// 문서 종류: 메모(notes), 개요(outline), 보고서(report)
+const (
+	docTypeNotes   = "notes"
+	docTypeOutline = "outline"
+	docTypeReport  = "report"
+)
+
+var validDocTypes = map[string]bool{docTypeNotes: true, docTypeOutline: true, docTypeReport: true}
+
+// normalizeDocumentKind는 생성 요청의 mode와 doc_type을 검사하고 기본값을 채웁니다.
+// mode를 생략하면 ai이고, doc_type을 생략하면 AI 문서는 report, 직접 작성한 문서는 notes입니다.
+func normalizeDocumentKind(doc *Document) error {
+	switch doc.Mode {
+	case "":
+		doc.Mode = documentModeAI
+	case documentModeAI, documentModeManual:
+	default:
+		return errors.New("잘못된 mode 값 (ai, manual)")
+	}
+	if doc.DocType == "" {
+		doc.DocType = docTypeReport
+		if doc.Mode == documentModeManual {
+			doc.DocType = docTypeNotes
+		}
+	}
+	if !validDocTypes[doc.DocType] {
+		return errors.New("잘못된 doc_type 값 (notes, outline, report)")
+	}
+	return nil
 }
 
 type Document struct {
@@ -43,14 +95,23 @@ type Document struct {
 	Content   string    `json:"content"`
 	ProjectID int64     `json:"project_id"`
 	UserID    int64     `json:"user_id,omitempty"`
+	Status    string    `json:"status"`
+	// Version은 내용이 바뀔 때마다 1씩 오르며, ETag 헤더로도 전달됩니다.
+	Version   int64     `json:"version"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// Mode는 문서를 만든 방식(ai, manual), DocType은 문서 종류(notes, outline, report)입니다.
+	Mode    string `json:"mode"`
+	DocType string `json:"doc_type"`
+	// GenerationOptions는 생성 요청에서는 템플릿과 옵션을, 응답에서는 실제로 적용된 값을 담습니다.
+	GenerationOptions *GenerationOptions `json:"generation_options,omitempty"`
 }
 
 func handleDocuments(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(userContextKey).(int64)
 	if !ok {
-		http.Error(w, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
 		return
 	}
 
@@ -59,7 +120,7 @@ func handleDocuments(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case "POST":
-		createDocumentWithAI(w, r, userID)
+		createDocument(w, r, userID, idFromPath == "stream")
 	case "GET":
 		if idFromPath != "" {
 			getDocument(w, r, userID, idFromPath)
@@ -71,13 +132,13 @@ func handleDocuments(w http.ResponseWriter, r *http.Request) {
 	case "DELETE":
 		deleteDocument(w, r, userID, idFromPath)
 	default:
-		http.Error(w, "지원하지 않는 메소드", http.StatusMethodNotAllowed)
+		httpError(w, r, "지원하지 않는 메소드", http.StatusMethodNotAllowed)
 	}
 }
 
-func getAllCardsForProject(projectID int64, userID int64) ([]CardForAI, error) {
+func getAllCardsForProject(ctx context.Context, projectID int64, userID int64) ([]CardForAI, error) {
 	query := `SELECT id, cardtext FROM cards WHERE project_id = ? AND user_id = ?`
-	rows, err := db.Query(query, projectID, userID)
+	rows, err := db.QueryContext(ctx, query, projectID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -94,9 +155,10 @@ func getAllCardsForProject(projectID int64, userID int64) ([]CardForAI, error) {
 	return cards, nil
 }
 
-func getAllTagsForProject(projectID int64, userID int64) ([]string, error) {
-	query := `SELECT cardtags FROM cards WHERE project_id = ? AND user_id = ?`
-	rows, err := db.Query(query, projectID, userID)
+// getAllTagsForProject는 프로젝트 카드의 태그를 중복 없이 모읍니다. selected가 nil이 아니면 그 카드의 태그만 모읍니다.
+func getAllTagsForProject(ctx context.Context, projectID int64, userID int64, selected map[int64]bool) ([]string, error) {
+	query := `SELECT id, cardtags FROM cards WHERE project_id = ? AND user_id = ?`
+	rows, err := db.QueryContext(ctx, query, projectID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -104,10 +166,14 @@ func getAllTagsForProject(projectID int64, userID int64) ([]string, error) {
 
 	tagSet := make(map[string]struct{})
 	for rows.Next() {
+		var cardID int64
 		var tagsStr string
-		if err := rows.Scan(&tagsStr); err != nil {
+		if err := rows.Scan(&cardID, &tagsStr); err != nil {
 			return nil, err
 		}
+		if selected != nil && !selected[cardID] {
+			continue
+		}
 		tags := strings.Split(tagsStr, ",")
 		for _, tag := range tags {
 			trimmedTag := strings.TrimSpace(tag)
@@ -125,116 +191,186 @@ func getAllTagsForProject(projectID int64, userID int64) ([]string, error) {
 	return uniqueTags, nil
 }
 
-func getAllCategoriesForProject(projectID int64, userID int64) ([]CategoryInfo, error) {
-	query := `SELECT category, GROUP_CONCAT(id) FROM cards WHERE project_id = ? AND user_id = ? AND category IS NOT NULL AND category != '' GROUP BY category`
-	rows, err := db.Query(query, projectID, userID)
+// getAllCategoriesForProject는 프로젝트의 카테고리를 트리로 반환합니다 (categories.go 참고).
+func getAllCategoriesForProject(ctx context.Context, projectID int64, userID int64) ([]CategoryInfo, error) {
+	direct, err := categoryCardIDs(ctx, projectID, userID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var categories []CategoryInfo
-	for rows.Next() {
-		var ci CategoryInfo
-		var cardIDsStr string
-		if err := rows.Scan(&ci.CategoryName, &cardIDsStr); err != nil {
-			return nil, err
-		}
-
-		ids := strings.Split(cardIDsStr, ",")
-		for _, idStr := range ids {
-			id, _ := strconv.ParseInt(idStr, 10, 64)
-			ci.CardIDs = append(ci.CardIDs, id)
-		}
-		categories = append(categories, ci)
+	parents, err := loadCategoryParents(ctx, projectID)
+	if err != nil {
+		return nil, err
 	}
-	return categories, nil
+	return buildCategoryTree(direct, parents), nil
 }
 
-func createDocumentWithAI(w http.ResponseWriter, r *http.Request, userID int64) {
-	var doc Document
-	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
-		http.Error(w, "잘못된 JSON 형식", http.StatusBadRequest)
-		return
+// buildAgentRequest는 프로젝트의 카드, 태그, 카테고리를 모아 보고서 생성 요청을 만듭니다.
+// opts에 카테고리나 카드를 선택했으면 선택한 카드와 그 태그, 카테고리만 포함합니다.
+func buildAgentRequest(ctx context.Context, topic string, projectID int64, userID int64, opts *GenerationOptions) (AgentInvokeRequest, error) {
+	allCards, err := getAllCardsForProject(ctx, projectID, userID)
+	if err != nil {
+		return AgentInvokeRequest{}, fmt.Errorf("카드 정보 조회 실패: %w", err)
 	}
-	doc.UserID = userID
-
-	var projectOwnerID int64
-	err := db.QueryRow("SELECT user_id FROM projects WHERE id = ?", doc.ProjectID).Scan(&projectOwnerID)
-	if err != nil || projectOwnerID != userID {
-		http.Error(w, "프로젝트를 찾을 수 없거나 권한이 없습니다", http.StatusForbidden)
-		return
+	allCategories, err := getAllCategoriesForProject(ctx, projectID, userID)
+	if err != nil {
+		return AgentInvokeRequest{}, fmt.Errorf("카테고리 정보 조회 실패: %w", err)
 	}
 
-	allCards, err := getAllCardsForProject(doc.ProjectID, userID)
+	selected, err := opts.cardSelection(allCards, allCategories)
 	if err != nil {
-		http.Error(w, "카드 정보 조회 실패: "+err.Error(), http.StatusInternalServerError)
-		return
+		return AgentInvokeRequest{}, err
 	}
-	allTags, err := getAllTagsForProject(doc.ProjectID, userID)
-	if err != nil {
-		http.Error(w, "태그 정보 조회 실패: "+err.Error(), http.StatusInternalServerError)
-		return
+	if selected != nil {
+		allCards, allCategories = filterSelectedCards(allCards, allCategories, selected)
 	}
-	allCategories, err := getAllCategoriesForProject(doc.ProjectID, userID)
+
+	allTags, err := getAllTagsForProject(ctx, projectID, userID, selected)
 	if err != nil {
-		http.Error(w, "카테고리 정보 조회 실패: "+err.Error(), http.StatusInternalServerError)
-		return
+		return AgentInvokeRequest{}, fmt.Errorf("태그 정보 조회 실패: %w", err)
 	}
 
-	aiRequestData := AgentInvokeRequest{
-		Topic:         doc.Title,
+	return AgentInvokeRequest{
+		Topic:         topic,
 		AllTags:       allTags,
 		AllCategories: allCategories,
 		AllCards:      allCards,
+		Options:       opts.agentOptions(),
+	}, nil
+}
+
+// insertDocument는 doc과 인용 목록을 한 트랜잭션으로 저장하고 ID, version, 생성·수정 시각을 채웁니다.
+func insertDocument(ctx context.Context, doc *Document, citations []documentCitation) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var options interface{}
+	if doc.GenerationOptions != nil {
+		b, err := json.Marshal(doc.GenerationOptions)
+		if err != nil {
+			return err
+		}
+		options = string(b)
 	}
-	jsonData, err := json.Marshal(aiRequestData)
+
+	query := "INSERT INTO documents (title, content, project_id, user_id, status, mode, doc_type, generation_options) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	result, err := tx.ExecContext(ctx, query, doc.Title, doc.Content, doc.ProjectID, doc.UserID, doc.Status, doc.Mode, doc.DocType, options)
 	if err != nil {
-		http.Error(w, "AI 요청 데이터 생성 실패", http.StatusInternalServerError)
-		return
+		return err
+	}
+
+	docID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("문서 ID 가져오기 실패: %w", err)
+	}
+
+	if err := insertCitations(ctx, tx, docID, citations); err != nil {
+		return err
 	}
 
-	aiServerURL := "http://127.0.0.1:8000/agent/invoke"
-	resp, err := http.Post(aiServerURL, "application/json", bytes.NewBuffer(jsonData))
+	err = tx.QueryRowContext(ctx, "SELECT version, created_at, updated_at FROM documents WHERE id = ?", docID).Scan(&doc.Version, &doc.CreatedAt, &doc.UpdatedAt)
 	if err != nil {
-		http.Error(w, "AI 서버 호출 실패: "+err.Error(), http.StatusServiceUnavailable)
+		return fmt.Errorf("생성된 문서 정보 조회 실패: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	doc.ID = docID
+	return nil
+}
+
+// documentEventData는 프로젝트 이벤트에 담을 문서 정보입니다. 본문은 크므로 제외합니다.
+func documentEventData(doc Document) map[string]interface{} {
+	return map[string]interface{}{"id": doc.ID, "title": doc.Title, "status": doc.Status, "version": doc.Version, "mode": doc.Mode, "doc_type": doc.DocType}
+}
+
+// documentProjectID는 userID가 소유한 문서가 속한 프로젝트 ID를 반환합니다.
+func documentProjectID(ctx context.Context, docID int64, userID int64) (int64, error) {
+	var projectID int64
+	err := db.QueryRowContext(ctx, "SELECT project_id FROM documents WHERE id = ? AND user_id = ?", docID, userID).Scan(&projectID)
+	return projectID, err
+}
+
+// createDocument는 POST /api/documents/ (stream이면 /api/documents/stream) 요청을 처리합니다.
+// mode가 manual이면 AI 서버를 호출하지 않고 요청의 제목과 내용으로 문서를 만듭니다.
+func createDocument(w http.ResponseWriter, r *http.Request, userID int64, stream bool) {
+	var doc Document
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		httpError(w, r, "잘못된 JSON 형식", http.StatusBadRequest)
+		return
+	}
+	doc.UserID = userID
+	if err := normalizeDocumentKind(&doc); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		errorMsg := fmt.Sprintf("AI 서버 오류 (상태 코드: %d): %s", resp.StatusCode, string(bodyBytes))
-		http.Error(w, errorMsg, http.StatusInternalServerError)
+	var projectOwnerID int64
+	err := db.QueryRowContext(r.Context(), "SELECT user_id FROM projects WHERE id = ?", doc.ProjectID).Scan(&projectOwnerID)
+	if err != nil || projectOwnerID != userID {
+		httpError(w, r, "프로젝트를 찾을 수 없거나 권한이 없습니다", http.StatusForbidden)
 		return
 	}
+	setUsageProject(r.Context(), doc.ProjectID)
 
-	var aiResponse AgentInvokeResponse
-	if err := json.NewDecoder(resp.Body).Decode(&aiResponse); err != nil {
-		http.Error(w, "AI 서버 응답 파싱 실패", http.StatusInternalServerError)
+	switch {
+	case doc.Mode == documentModeManual && stream:
+		httpError(w, r, "직접 작성하는 문서(mode: manual)는 스트리밍 생성을 사용할 수 없습니다", http.StatusBadRequest)
+	case doc.Mode == documentModeManual:
+		createManualDocument(w, r, &doc)
+	case stream:
+		streamDocumentWithAI(w, r, &doc)
+	default:
+		createDocumentWithAI(w, r, &doc)
+	}
+}
+
+// createManualDocument는 AI 없이 빈 문서나 사용자가 붙여 넣은 초안을 저장합니다.
+func createManualDocument(w http.ResponseWriter, r *http.Request, doc *Document) {
+	if strings.TrimSpace(doc.Title) == "" {
+		httpError(w, r, "문서 제목이 필요합니다", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(doc.Content) > maxDocumentRunes {
+		httpError(w, r, errDocumentTooLong.Error(), http.StatusRequestEntityTooLarge)
 		return
 	}
-	doc.Content = aiResponse.Report
+	// 생성 옵션은 AI가 문서를 만들 때 적용한 값이므로 직접 작성한 문서에는 저장하지 않습니다.
+	doc.GenerationOptions = nil
+	doc.Status = documentStatusComplete
 
-	query := "INSERT INTO documents (title, content, project_id, user_id) VALUES (?, ?, ?, ?)"
-	result, err := db.Exec(query, doc.Title, doc.Content, doc.ProjectID, doc.UserID)
-	if err != nil {
-		http.Error(w, "문서 생성 실패: "+err.Error(), http.StatusInternalServerError)
+	if err := insertDocument(r.Context(), doc, nil); err != nil {
+		httpError(w, r, "문서 생성 실패: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	publishProjectEvent(r.Context(), doc.ProjectID, eventDocumentCreated, documentEventData(*doc))
 
-	docID, err := result.LastInsertId()
-	if err != nil {
-		http.Error(w, "문서 ID 가져오기 실패", http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(doc)
+}
+
+func createDocumentWithAI(w http.ResponseWriter, r *http.Request, doc *Document) {
+	aiRequestData, ok := prepareAgentRequest(w, r, doc)
+	if !ok {
 		return
 	}
-	doc.ID = docID
+	var aiResponse AgentInvokeResponse
+	if err := aiPost(r.Context(), "/agent/invoke", aiRequestData, &aiResponse); err != nil {
+		writeAIError(w, r, "AI 문서 생성", err)
+		return
+	}
+	content, citations := applyCitations(aiResponse.Report, projectCardSet(aiRequestData.AllCards), aiResponse.CardIDs)
+	doc.Content = content
+	doc.Status = documentStatusComplete
 
-	err = db.QueryRow("SELECT created_at, updated_at FROM documents WHERE id = ?", docID).Scan(&doc.CreatedAt, &doc.UpdatedAt)
-	if err != nil {
-		http.Error(w, "생성된 문서 정보 조회 실패", http.StatusInternalServerError)
+	if err := insertDocument(r.Context(), doc, citations); err != nil {
+		httpError(w, r, "문서 생성 실패: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	publishProjectEvent(r.Context(), doc.ProjectID, eventDocumentCreated, documentEventData(*doc))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -244,25 +380,25 @@ func createDocumentWithAI(w http.ResponseWriter, r *http.Request, userID int64)
 func getDocumentsByProject(w http.ResponseWriter, r *http.Request, userID int64) {
 	projectIDStr := r.URL.Query().Get("project_id")
 	if projectIDStr == "" {
-		http.Error(w, "project_id 쿼리 파라미터가 필요합니다", http.StatusBadRequest)
+		httpError(w, r, "project_id 쿼리 파라미터가 필요합니다", http.StatusBadRequest)
 		return
 	}
 	projectID, err := strconv.ParseInt(projectIDStr, 10, 64)
 	if err != nil {
-		http.Error(w, "잘못된 project_id", http.StatusBadRequest)
+		httpError(w, r, "잘못된 project_id", http.StatusBadRequest)
 		return
 	}
 
 	var projectOwnerID int64
-	err = db.QueryRow("SELECT user_id FROM projects WHERE id = ?", projectID).Scan(&projectOwnerID)
+	err = db.QueryRowContext(r.Context(), "SELECT user_id FROM projects WHERE id = ?", projectID).Scan(&projectOwnerID)
 	if err != nil || projectOwnerID != userID {
-		http.Error(w, "프로젝트에 대한 권한이 없습니다", http.StatusForbidden)
+		httpError(w, r, "프로젝트에 대한 권한이 없습니다", http.StatusForbidden)
 		return
 	}
 
-	rows, err := db.Query("SELECT id, title, content, project_id, user_id, created_at, updated_at FROM documents WHERE project_id = ? AND user_id = ? ORDER BY created_at DESC", projectID, userID)
+	rows, err := db.QueryContext(r.Context(), "SELECT id, title, content, project_id, user_id, status, version, mode, doc_type, generation_options, created_at, updated_at FROM documents WHERE project_id = ? AND user_id = ? ORDER BY created_at DESC", projectID, userID)
 	if err != nil {
-		http.Error(w, "문서 목록 조회 실패", http.StatusInternalServerError)
+		httpError(w, r, "문서 목록 조회 실패", http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close()
@@ -270,10 +406,12 @@ func getDocumentsByProject(w http.ResponseWriter, r *http.Request, userID int64)
 	var documents []Document
 	for rows.Next() {
 		var d Document
-		if err := rows.Scan(&d.ID, &d.Title, &d.Content, &d.ProjectID, &d.UserID, &d.CreatedAt, &d.UpdatedAt); err != nil {
-			http.Error(w, "DB 스캔 실패", http.StatusInternalServerError)
+		var options sql.NullString
+		if err := rows.Scan(&d.ID, &d.Title, &d.Content, &d.ProjectID, &d.UserID, &d.Status, &d.Version, &d.Mode, &d.DocType, &options, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			httpError(w, r, "DB 스캔 실패", http.StatusInternalServerError)
 			return
 		}
+		d.GenerationOptions = parseGenerationOptions(options)
 		documents = append(documents, d)
 	}
 
@@ -284,73 +422,187 @@ func getDocumentsByProject(w http.ResponseWriter, r *http.Request, userID int64)
 func getDocument(w http.ResponseWriter, r *http.Request, userID int64, idFromPath string) {
 	docID, err := strconv.ParseInt(idFromPath, 10, 64)
 	if err != nil {
-		http.Error(w, "잘못된 id 경로", http.StatusBadRequest)
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
 		return
 	}
 
 	var doc Document
-	query := "SELECT id, title, content, project_id, user_id, created_at, updated_at FROM documents WHERE id = ? AND user_id = ?"
-	err = db.QueryRow(query, docID, userID).Scan(&doc.ID, &doc.Title, &doc.Content, &doc.ProjectID, &doc.UserID, &doc.CreatedAt, &doc.UpdatedAt)
+	var options sql.NullString
+	query := "SELECT id, title, content, project_id, user_id, status, version, mode, doc_type, generation_options, created_at, updated_at FROM documents WHERE id = ? AND user_id = ?"
+	err = db.QueryRowContext(r.Context(), query, docID, userID).Scan(&doc.ID, &doc.Title, &doc.Content, &doc.ProjectID, &doc.UserID, &doc.Status, &doc.Version, &doc.Mode, &doc.DocType, &options, &doc.CreatedAt, &doc.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			http.Error(w, "문서를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+			httpError(w, r, "문서를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
 		} else {
-			http.Error(w, "문서 조회 실패", http.StatusInternalServerError)
+			httpError(w, r, "문서 조회 실패", http.StatusInternalServerError)
 		}
 		return
 	}
+	doc.GenerationOptions = parseGenerationOptions(options)
+
+	etag := documentETag(doc.Version)
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, doc.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(doc)
+	json.NewEncoder(w).Encode(newRenderedDocument(r.Context(), doc))
+}
+
+// documentETag는 문서 version을 ETag 값으로 만듭니다.
+func documentETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// etagMatches는 If-Match/If-None-Match 헤더 값(쉼표로 구분된 ETag 목록 또는 "*")이 version과 맞는지 확인합니다.
+func etagMatches(header string, version int64) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == documentETag(version) {
+			return true
+		}
+	}
+	return false
 }
 
 func updateDocument(w http.ResponseWriter, r *http.Request, userID int64, idFromPath string) {
 	docID, err := strconv.ParseInt(idFromPath, 10, 64)
 	if err != nil {
-		http.Error(w, "잘못된 id 경로", http.StatusBadRequest)
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
 		return
 	}
 
 	var doc Document
 	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
-		http.Error(w, "잘못된 JSON 형식", http.StatusBadRequest)
+		httpError(w, r, "잘못된 JSON 형식", http.StatusBadRequest)
 		return
 	}
 
-	query := "UPDATE documents SET title = ?, content = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ?"
-	result, err := db.Exec(query, doc.Title, doc.Content, docID, userID)
+	// status를 생략하면 기존 값을 유지합니다. 초안을 다듬은 뒤 "complete"로 바꿀 수 있습니다.
+	if doc.Status != "" && doc.Status != documentStatusComplete && doc.Status != documentStatusDraft {
+		httpError(w, r, "잘못된 status 값 (complete, draft)", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(doc.Content) > maxDocumentRunes {
+		httpError(w, r, errDocumentTooLong.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// 클라이언트가 마지막으로 본 version을 If-Match로 보내야 합니다. 덮어쓰려면 If-Match: *를 보냅니다.
+	ifMatch := r.Header.Get("If-Match")
+	if strings.TrimSpace(ifMatch) == "" {
+		httpError(w, r, "If-Match 헤더가 필요합니다. 문서를 불러올 때 받은 ETag를 보내세요", http.StatusPreconditionRequired)
+		return
+	}
+
+	projectID, err := documentProjectID(r.Context(), docID, userID)
+	if err != nil {
+		httpError(w, r, "문서를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		return
+	}
+
+	// 편집 세션에 저장하지 않은 편집이 있으면 먼저 저장해 version을 올립니다.
+	// 그래야 그 편집을 보지 못한 클라이언트의 If-Match가 412로 거부되고, 아래 replace가 편집을 버리지 않습니다.
+	docSessions.save(docID)
+
+	// 비교와 수정을 한 UPDATE 문에서 처리해 두 요청이 같은 version을 동시에 덮어쓰지 않게 합니다.
+	query := "UPDATE documents SET title = ?, content = ?, status = COALESCE(NULLIF(?, ''), status), version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ?"
+	args := []interface{}{doc.Title, doc.Content, doc.Status, docID, userID}
+	if strings.TrimSpace(ifMatch) != "*" {
+		var current int64
+		if err := db.QueryRowContext(r.Context(), "SELECT version FROM documents WHERE id = ?", docID).Scan(&current); err != nil {
+			httpError(w, r, "문서 조회 실패", http.StatusInternalServerError)
+			return
+		}
+		if !etagMatches(ifMatch, current) {
+			writeVersionConflict(w, r, current)
+			return
+		}
+		query += " AND version = ?"
+		args = append(args, current)
+	}
+
+	result, err := db.ExecContext(r.Context(), query, args...)
 	if err != nil {
-		http.Error(w, "문서 수정 실패", http.StatusInternalServerError)
+		httpError(w, r, "문서 수정 실패", http.StatusInternalServerError)
 		return
 	}
 
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		http.Error(w, "문서를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		var current int64
+		if err := db.QueryRowContext(r.Context(), "SELECT version FROM documents WHERE id = ? AND user_id = ?", docID, userID).Scan(&current); err == nil {
+			writeVersionConflict(w, r, current)
+			return
+		}
+		httpError(w, r, "문서를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
 		return
 	}
 
+	if err := db.QueryRowContext(r.Context(), "SELECT content, status, version FROM documents WHERE id = ?", docID).Scan(&doc.Content, &doc.Status, &doc.Version); err != nil {
+		httpError(w, r, "수정된 문서 조회 실패", http.StatusInternalServerError)
+		return
+	}
+	doc.ID = docID
+	docSessions.replace(docID, doc.Content, doc.Version)
+	publishProjectEvent(r.Context(), projectID, eventDocumentUpdated, documentEventData(doc))
+
+	w.Header().Set("ETag", documentETag(doc.Version))
 	w.WriteHeader(http.StatusOK)
 }
 
+// writeVersionConflict는 If-Match가 현재 version과 다를 때 412와 현재 ETag를 반환합니다.
+func writeVersionConflict(w http.ResponseWriter, r *http.Request, current int64) {
+	w.Header().Set("ETag", documentETag(current))
+	httpError(w, r, "다른 곳에서 문서가 먼저 수정되었습니다. 최신 내용을 불러온 뒤 다시 시도하세요", http.StatusPreconditionFailed)
+}
+
 func deleteDocument(w http.ResponseWriter, r *http.Request, userID int64, idFromPath string) {
 	docID, err := strconv.ParseInt(idFromPath, 10, 64)
 	if err != nil {
-		http.Error(w, "잘못된 id 경로", http.StatusBadRequest)
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
 		return
 	}
 
-	result, err := db.Exec("DELETE FROM documents WHERE id = ? AND user_id = ?", docID, userID)
+	projectID, err := documentProjectID(r.Context(), docID, userID)
 	if err != nil {
-		http.Error(w, "문서 삭제 실패", http.StatusInternalServerError)
+		httpError(w, r, "문서를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "문서를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+	// 문서와 인용 정보, 리비전은 함께 지워지거나 함께 남아야 합니다.
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		httpError(w, r, "문서 삭제 실패", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(r.Context(), "DELETE FROM documents WHERE id = ? AND user_id = ?", docID, userID)
+	if err != nil {
+		httpError(w, r, "문서 삭제 실패", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		httpError(w, r, "문서를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), "DELETE FROM document_citations WHERE document_id = ?", docID); err != nil {
+		httpError(w, r, "문서 인용 정보 삭제 실패", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), "DELETE FROM document_revisions WHERE document_id = ?", docID); err != nil {
+		httpError(w, r, "문서 리비전 삭제 실패", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		httpError(w, r, "문서 삭제 실패", http.StatusInternalServerError)
 		return
 	}
+	docSessions.remove(docID)
+	publishProjectEvent(r.Context(), projectID, eventDocumentDeleted, map[string]int64{"id": docID})
 
 	w.WriteHeader(http.StatusNoContent)
 }
\ No newline at end of file
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 카드 임베딩 저장소
+//
+// 카드 내용의 임베딩을 (내용 해시, 모델) 키로 SQLite card_embeddings 테이블에 float32 BLOB으로 저장하고,
+// 자주 쓰는 벡터는 메모리에도 보관합니다. 내용이 바뀐 카드만 AI 서버 /embeddings에 요청하므로
+// 자동 분류, 클러스터링, 관련 카드 검색이 같은 카드를 다시 임베딩하지 않습니다.
+// 모델(ai.embedding_model)을 바꾸면 새 모델의 벡터를 다시 받고, 이전 모델의 벡터는 정리 작업이 지웁니다.
+
+// EmbedAIRequest는 AI 서버 /embeddings 엔드포인트에 보낼 요청 본문입니다.
+type EmbedAIRequest struct {
+	Texts []string `json:"texts"`
+	Model string   `json:"model"`
+}
+
+// EmbedAIResponse는 /embeddings 응답입니다. Embeddings[i]는 Texts[i]의 벡터입니다.
+type EmbedAIResponse struct {
+	Model      string      `json:"model"`
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// embeddingCache는 최근에 쓴 임베딩을 "모델:내용 해시" 키로 메모리에 보관합니다.
+// 가득 차면 임의의 항목을 지웁니다 (map 순회 순서). 원본은 SQLite에 있으므로 지워도 AI 서버를 다시 부르지 않습니다.
+type embeddingCache struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string][]float32
+
+	hits, misses uint64
+}
+
+// embeddings는 카드 임베딩 메모리 캐시입니다. main에서 설정값으로 초기화합니다.
+var embeddings *embeddingCache
+
+func newEmbeddingCache(max int) *embeddingCache {
+	return &embeddingCache{max: max, entries: make(map[string][]float32)}
+}
+
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *embeddingCache) get(key string) ([]float32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vec, ok := c.entries[key]
+	if ok {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	return vec, ok
+}
+
+func (c *embeddingCache) put(key string, vec []float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.max {
+		for old := range c.entries {
+			delete(c.entries, old)
+			break
+		}
+	}
+	c.entries[key] = vec
+}
+
+func (c *embeddingCache) size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func (c *embeddingCache) stats() (hits, misses uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// embedTexts는 texts의 임베딩을 반환합니다. 메모리, SQLite 순으로 찾고 둘 다 없는 내용만 AI 서버에 요청해 저장합니다.
+func embedTexts(ctx context.Context, texts []string) ([][]float32, error) {
+	model := cfg.AI.EmbeddingModel
+	vecs := make([][]float32, len(texts))
+
+	// 같은 내용은 한 번만 찾습니다.
+	positions := make(map[string][]int)
+	var hashes []string
+	for i, text := range texts {
+		hash := contentHash(text)
+		if vec, ok := embeddings.get(model + ":" + hash); ok {
+			vecs[i] = vec
+			continue
+		}
+		if _, seen := positions[hash]; !seen {
+			hashes = append(hashes, hash)
+		}
+		positions[hash] = append(positions[hash], i)
+	}
+	if len(hashes) == 0 {
+		return vecs, nil
+	}
+
+	stored, err := loadEmbeddings(ctx, model, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("임베딩 조회 실패: %w", err)
+	}
+	var missing []string
+	var missingHashes []string
+	for _, hash := range hashes {
+		if vec, ok := stored[hash]; ok {
+			embeddings.put(model+":"+hash, vec)
+			for _, i := range positions[hash] {
+				vecs[i] = vec
+			}
+			continue
+		}
+		missing = append(missing, texts[positions[hash][0]])
+		missingHashes = append(missingHashes, hash)
+	}
+	if len(missing) == 0 {
+		return vecs, nil
+	}
+
+	var resp EmbedAIResponse
+	if err := aiPost(ctx, "/embeddings", EmbedAIRequest{Texts: missing, Model: model}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) != len(missing) {
+		return nil, fmt.Errorf("AI 서버가 임베딩 %d개를 요청받고 %d개를 반환했습니다", len(missing), len(resp.Embeddings))
+	}
+	if resp.Model != model {
+		// 다른 모델의 벡터는 저장된 벡터와 비교할 수 없으므로 이번 요청에만 쓰고 저장하지 않습니다.
+		slog.Warn("AI 서버가 다른 임베딩 모델로 응답했습니다", "request_id", requestIDFrom(ctx), "want", model, "got", resp.Model)
+	} else if err := storeEmbeddings(ctx, model, missingHashes, resp.Embeddings); err != nil {
+		slog.Warn("임베딩 저장 실패", "request_id", requestIDFrom(ctx), "error", err)
+	}
+	for k, hash := range missingHashes {
+		if resp.Model == model {
+			embeddings.put(model+":"+hash, resp.Embeddings[k])
+		}
+		for _, i := range positions[hash] {
+			vecs[i] = resp.Embeddings[k]
+		}
+	}
+	return vecs, nil
+}
+
+// loadEmbeddings는 저장된 임베딩을 내용 해시별로 읽습니다. SQLite 변수 개수 제한을 넘지 않도록 나눠 조회합니다.
+func loadEmbeddings(ctx context.Context, model string, hashes []string) (map[string][]float32, error) {
+	const batch = 500
+	found := make(map[string][]float32, len(hashes))
+	for start := 0; start < len(hashes); start += batch {
+		part := hashes[start:min(start+batch, len(hashes))]
+		args := make([]interface{}, 0, len(part)+1)
+		args = append(args, model)
+		for _, hash := range part {
+			args = append(args, hash)
+		}
+		rows, err := db.QueryContext(ctx,
+			"SELECT content_hash, vector FROM card_embeddings WHERE model = ? AND content_hash IN (?"+strings.Repeat(",?", len(part)-1)+")",
+			args...,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var hash string
+			var blob []byte
+			if err := rows.Scan(&hash, &blob); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			found[hash] = decodeVector(blob)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
+
+func storeEmbeddings(ctx context.Context, model string, hashes []string, vecs [][]float32) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i, hash := range hashes {
+		_, err := tx.ExecContext(ctx,
+			"INSERT OR REPLACE INTO card_embeddings (content_hash, model, dims, vector) VALUES (?, ?, ?, ?)",
+			hash, model, len(vecs[i]), encodeVector(vecs[i]),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// encodeVector는 벡터를 little-endian float32 바이트열로 바꿉니다.
+func encodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(x))
+	}
+	return buf
+}
+
+func decodeVector(b []byte) []float32 {
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v
+}
+
+// pruneEmbeddings는 현재 모델이 아니거나 어떤 카드 내용과도 맞지 않는 임베딩을 지웁니다.
+func pruneEmbeddings(ctx context.Context) (int64, error) {
+	rows, err := db.QueryContext(ctx, "SELECT DISTINCT cardtext FROM cards WHERE cardtext IS NOT NULL")
+	if err != nil {
+		return 0, err
+	}
+	live := make(map[string]bool)
+	for rows.Next() {
+		var text string
+		if err := rows.Scan(&text); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		live[contentHash(text)] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	rows, err = db.QueryContext(ctx, "SELECT content_hash FROM card_embeddings WHERE model = ?", cfg.AI.EmbeddingModel)
+	if err != nil {
+		return 0, err
+	}
+	var stale []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if !live[hash] {
+			stale = append(stale, hash)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	result, err := db.ExecContext(ctx, "DELETE FROM card_embeddings WHERE model != ?", cfg.AI.EmbeddingModel)
+	if err != nil {
+		return 0, err
+	}
+	removed, _ := result.RowsAffected()
+	for _, hash := range stale {
+		result, err := db.ExecContext(ctx, "DELETE FROM card_embeddings WHERE content_hash = ? AND model = ?", hash, cfg.AI.EmbeddingModel)
+		if err != nil {
+			return removed, err
+		}
+		n, _ := result.RowsAffected()
+		removed += n
+	}
+	return removed, nil
+}
+
+// runEmbeddingPrune은 ctx가 취소될 때까지 주기적으로 쓰지 않는 임베딩을 정리합니다.
+func runEmbeddingPrune(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		removed, err := pruneEmbeddings(ctx)
+		if err != nil {
+			slog.Error("임베딩 정리 실패", "error", err)
+			continue
+		}
+		if removed > 0 {
+			slog.Info("쓰지 않는 임베딩을 정리했습니다", "removed", removed)
+		}
+	}
+}
+
+// cardEmbedding은 카드 하나와 그 내용의 임베딩입니다.
+type cardEmbedding struct {
+	CardID int64
+	Vector []float32
+}
+
+// scoredCard는 유사도 검색 결과입니다.
+type scoredCard struct {
+	CardID int64   `json:"id"`
+	Score  float64 `json:"score"`
+}
+
+// cardEmbeddings는 이미 읽어 둔 카드들의 임베딩을 반환합니다. 내용이 빈 카드는 제외합니다.
+func cardEmbeddings(ctx context.Context, cards []Card) ([]cardEmbedding, error) {
+	var ids []int64
+	var texts []string
+	for _, c := range cards {
+		if strings.TrimSpace(c.Text) == "" {
+			continue
+		}
+		ids = append(ids, c.CardID)
+		texts = append(texts, c.Text)
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	vecs, err := embedTexts(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]cardEmbedding, len(ids))
+	for i, id := range ids {
+		result[i] = cardEmbedding{CardID: id, Vector: vecs[i]}
+	}
+	return result, nil
+}
+
+// searchSimilar는 query와 코사인 유사도가 높은 카드부터 최대 limit개를 반환합니다. exclude 카드는 건너뜁니다.
+func searchSimilar(query []float32, candidates []cardEmbedding, limit int, exclude int64) []scoredCard {
+	results := make([]scoredCard, 0, len(candidates))
+	for _, c := range candidates {
+		if c.CardID == exclude {
+			continue
+		}
+		results = append(results, scoredCard{CardID: c.CardID, Score: cosineSimilarity(query, c.Vector)})
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// cosineSimilarity는 두 벡터의 코사인 유사도를 반환합니다. 길이가 다르거나 영벡터면 0입니다.
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// vectorNorm은 벡터의 길이(L2 노름)를 반환합니다.
+func vectorNorm(v []float32) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	return math.Sqrt(sum)
+}
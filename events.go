@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 프로젝트 변경 이벤트 종류. SSE 이벤트 이름으로도 사용됩니다.
+const (
+	eventCardCreated     = "card.created"
+	eventCardUpdated     = "card.updated"
+	eventCardDeleted     = "card.deleted"
+	eventCardsClustered  = "cards.clustered"
+	eventClusterReverted = "cards.cluster_reverted"
+	eventCategoryMoved   = "category.moved"
+	eventDocumentCreated = "document.created"
+	eventDocumentUpdated = "document.updated"
+	eventDocumentDeleted = "document.deleted"
+)
+
+const (
+	// 구독자별 버퍼. 가득 차면 느린 구독자로 보고 연결을 끊습니다 (브라우저가 다시 연결하며 새로 불러옴).
+	eventBufferSize = 32
+	// 프록시가 유휴 SSE 연결을 끊지 않도록 주기적으로 주석 줄을 보냅니다.
+	eventKeepAlive = 25 * time.Second
+)
+
+// projectEvent는 프로젝트의 카드, 문서, 카테고리가 바뀌었음을 알리는 이벤트입니다.
+type projectEvent struct {
+	Type      string `json:"type"`
+	ProjectID int64  `json:"project_id"`
+	// 변경을 일으킨 요청의 ID. 클라이언트는 자신이 보낸 요청의 X-Request-ID와 비교해 중복 반영을 피할 수 있습니다.
+	RequestID string      `json:"request_id,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// projectHub는 프로젝트별 이벤트 구독자 목록을 관리하는 pub/sub 허브입니다.
+// 서버 프로세스 안에서만 동작하므로 여러 인스턴스로 실행하면 같은 인스턴스의 구독자에게만 전달됩니다.
+type projectHub struct {
+	mu     sync.Mutex
+	subs   map[int64]map[chan projectEvent]struct{}
+	closed bool
+}
+
+var projectEvents *projectHub
+
+func newProjectHub() *projectHub {
+	return &projectHub{subs: make(map[int64]map[chan projectEvent]struct{})}
+}
+
+// subscribe는 projectID의 이벤트를 받을 채널을 등록합니다.
+// 채널은 unsubscribe, 허브 종료, 또는 버퍼가 넘칠 때 닫힙니다.
+func (h *projectHub) subscribe(projectID int64) chan projectEvent {
+	ch := make(chan projectEvent, eventBufferSize)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return ch
+	}
+	if h.subs[projectID] == nil {
+		h.subs[projectID] = make(map[chan projectEvent]struct{})
+	}
+	h.subs[projectID][ch] = struct{}{}
+	return ch
+}
+
+func (h *projectHub) unsubscribe(projectID int64, ch chan projectEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(projectID, ch)
+}
+
+func (h *projectHub) removeLocked(projectID int64, ch chan projectEvent) {
+	if _, ok := h.subs[projectID][ch]; !ok {
+		return
+	}
+	delete(h.subs[projectID], ch)
+	if len(h.subs[projectID]) == 0 {
+		delete(h.subs, projectID)
+	}
+	close(ch)
+}
+
+// publish는 이벤트를 프로젝트의 모든 구독자에게 보냅니다. 구독자를 기다리지 않습니다.
+func (h *projectHub) publish(ev projectEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[ev.ProjectID] {
+		select {
+		case ch <- ev:
+		default:
+			slog.Warn("이벤트 구독자가 느려 연결을 끊습니다", "project_id", ev.ProjectID, "event", ev.Type)
+			h.removeLocked(ev.ProjectID, ch)
+		}
+	}
+}
+
+// close는 모든 구독을 끝냅니다. 서버 종료 시 열려 있는 SSE 연결이 Shutdown을 막지 않도록 호출합니다.
+func (h *projectHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for projectID, chans := range h.subs {
+		for ch := range chans {
+			h.removeLocked(projectID, ch)
+		}
+	}
+}
+
+func (h *projectHub) subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, chans := range h.subs {
+		n += len(chans)
+	}
+	return n
+}
+
+// publishProjectEvent는 ctx의 요청 ID를 붙여 프로젝트 이벤트를 발행합니다.
+// 쓰기가 성공(커밋)한 뒤에 호출해야 합니다.
+func publishProjectEvent(ctx context.Context, projectID int64, eventType string, data interface{}) {
+	projectEvents.publish(projectEvent{
+		Type:      eventType,
+		ProjectID: projectID,
+		RequestID: requestIDFrom(ctx),
+		Data:      data,
+	})
+}
+
+// handleProjectEvents는 GET /api/projects/{id}/events 요청을 처리합니다.
+// 프로젝트 소유자만 구독할 수 있으며, 응답은 Server-Sent Events입니다.
+func handleProjectEvents(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+
+	projectID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 프로젝트 ID", http.StatusBadRequest)
+		return
+	}
+
+	var projectOwnerID int64
+	err = db.QueryRowContext(r.Context(), "SELECT user_id FROM projects WHERE id = ?", projectID).Scan(&projectOwnerID)
+	if err != nil || projectOwnerID != userID {
+		httpError(w, r, "프로젝트를 찾을 수 없거나 권한이 없습니다", http.StatusForbidden)
+		return
+	}
+
+	ch := projectEvents.subscribe(projectID)
+	defer projectEvents.unsubscribe(projectID, ch)
+
+	sse, err := newSSEWriter(w)
+	if err != nil {
+		httpError(w, r, "스트리밍 응답을 시작할 수 없습니다: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ticker := time.NewTicker(eventKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := sse.send(ev.Type, ev); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := sse.comment("keepalive"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// aiHealthState는 백그라운드 프로브가 마지막으로 확인한 AI 서버 상태입니다.
+// /readyz가 요청마다 AI 서버를 호출하지 않도록 결과를 캐시합니다.
+type aiHealthState struct {
+	mu        sync.RWMutex
+	ok        bool
+	err       string
+	checkedAt time.Time
+}
+
+var aiHealth = &aiHealthState{err: "아직 확인되지 않음"}
+
+func (s *aiHealthState) set(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ok = err == nil
+	s.err = ""
+	if err != nil {
+		s.err = err.Error()
+	}
+	s.checkedAt = time.Now()
+}
+
+func (s *aiHealthState) get() (bool, string, time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ok, s.err, s.checkedAt
+}
+
+func checkAIServer(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", cfg.AI.ServerURL+"/healthz", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("AI 서버 상태 코드 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// runAIHealthProbe는 ctx가 취소될 때까지 주기적으로 AI 서버 상태를 확인합니다.
+func runAIHealthProbe(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		aiHealth.set(checkAIServer(ctx))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GET /healthz - 프로세스가 살아 있는지만 확인합니다.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// GET /readyz - SQLite에 접근 가능한 경우에만 200을 반환합니다.
+// AI 서버 상태는 본문에 함께 알려 주지만, AI 서버가 없어도 로컬 엔진과 회로 차단기로 대부분의 요청을
+// 처리할 수 있으므로 준비 상태에는 반영하지 않습니다. AI 서버 장애로 모든 인스턴스가 빠지는 것을 막습니다.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	type check struct {
+		OK        bool       `json:"ok"`
+		Error     string     `json:"error,omitempty"`
+		CheckedAt *time.Time `json:"checked_at,omitempty"`
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	dbCheck := check{OK: true}
+	if err := db.PingContext(ctx); err != nil {
+		dbCheck = check{OK: false, Error: err.Error()}
+	}
+
+	aiOK, aiErr, checkedAt := aiHealth.get()
+	aiCheck := check{OK: aiOK, Error: aiErr}
+	if !checkedAt.IsZero() {
+		aiCheck.CheckedAt = &checkedAt
+	}
+
+	status := http.StatusOK
+	if !dbCheck.OK {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]check{
+		"database":  dbCheck,
+		"ai_server": aiCheck,
+	})
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// job은 요청 처리와 분리되어 백그라운드에서 실행되는 작업입니다.
+// name은 작업 종류("card-tags" 등)로, 로그와 메트릭 라벨에 사용됩니다.
+type job struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// jobQueue는 고정 개수의 워커가 처리하는 버퍼 큐입니다.
+// shutdown이 호출되면 새 작업을 받지 않고, 남은 작업을 제한 시간 안에 모두 처리합니다.
+type jobQueue struct {
+	ch     chan job
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	closed bool
+}
+
+var jobs *jobQueue
+
+func newJobQueue(size int) *jobQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &jobQueue{
+		ch:     make(chan job, size),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (q *jobQueue) start(workers int) {
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for j := range q.ch {
+				if err := j.run(q.ctx); err != nil {
+					slog.Error("백그라운드 작업 실패", "job", j.name, "error", err)
+					jobsProcessedTotal.WithLabelValues(j.name, "error").Inc()
+				} else {
+					jobsProcessedTotal.WithLabelValues(j.name, "success").Inc()
+				}
+			}
+		}()
+	}
+}
+
+// enqueue는 작업을 큐에 넣습니다. 큐가 가득 찼거나 종료 중이면 false를 반환합니다.
+func (q *jobQueue) enqueue(name string, run func(ctx context.Context) error) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	select {
+	case q.ch <- job{name: name, run: run}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *jobQueue) depth() int {
+	return len(q.ch)
+}
+
+// shutdown은 큐를 닫고 워커가 남은 작업을 끝낼 때까지 기다립니다.
+// ctx가 먼저 만료되면 실행 중인 작업의 컨텍스트를 취소합니다.
+func (q *jobQueue) shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.ch)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+		return fmt.Errorf("남은 작업 %d개를 처리하지 못했습니다: %w", q.depth(), ctx.Err())
+	}
+}
+
+// retryCardTagsJob은 카드 생성 시 AI 태그 생성에 실패한 경우 나중에 다시 시도하는 작업입니다.
+// 그 사이 사용자가 직접 태그를 입력했다면 덮어쓰지 않습니다.
+// info는 원래 카드 생성 요청의 정보로, AI 서버 로그와 연결하고 AI 사용량을 그 사용자에게 기록하는 데 사용됩니다.
+func retryCardTagsJob(cardID int64, projectID int64, text string, info requestInfo) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		ctx = context.WithValue(ctx, requestInfoKey, &info)
+		backoff := 5 * time.Second
+		var lastErr error
+		for attempt := 0; attempt < 3; attempt++ {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			backoff *= 2
+
+			tags, err := generateTags(ctx, text)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			cardTags := strings.Join(tags, ",")
+			result, err := db.ExecContext(ctx,
+				"UPDATE cards SET cardtags = ? WHERE id = ? AND (cardtags IS NULL OR cardtags = '')",
+				cardTags, cardID,
+			)
+			if err != nil {
+				return err
+			}
+			if n, _ := result.RowsAffected(); n > 0 {
+				publishProjectEvent(ctx, projectID, eventCardUpdated, map[string]interface{}{"id": cardID, "cardtags": cardTags})
+			}
+			return nil
+		}
+		return fmt.Errorf("카드 %d 태그 재생성 실패: %w", cardID, lastErr)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtKey는 kid 하나에 대응하는 서명/검증 키입니다.
+// 검증 전용 키(로테이션 이전 키)는 signKey가 nil입니다.
+type jwtKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// keyManager는 현재 서명 키와 검증 가능한 모든 키, 그리고 발급자/대상 정보를 보관합니다.
+// 서버 시작 시 한 번 로드되며 요청마다 환경 변수를 다시 읽지 않습니다.
+type keyManager struct {
+	signing  *jwtKey
+	legacy   *jwtKey // kid가 없는 예전 토큰을 검증할 키
+	keys     map[string]*jwtKey
+	issuer   string
+	audience string
+	// legacyUntil 이후에는 kid·iss·aud가 없는 예전 형식 토큰을 받지 않습니다. 0이면 토큰 만료(exp)까지 받습니다.
+	legacyUntil time.Time
+}
+
+var jwtKeys *keyManager
+
+// loadKeyManager는 JWT 설정으로 keyManager를 만듭니다.
+//
+//	signing_alg       HS256(기본값), EdDSA, RS256
+//	key_id            현재 서명 키의 kid
+//	secret_key        HS256 서명 키
+//	private_key_file  EdDSA/RS256 개인키 PEM 파일 경로
+//	verify_keys       검증 전용 키 목록, "kid=hs256:비밀키,kid=file:공개키.pem" 형식
+//	legacy_until      kid·iss·aud가 없는 예전 형식 토큰을 받는 마지막 시각 (RFC 3339)
+//	legacy_key_id     kid가 없는 예전 토큰을 검증할 키의 kid (비어 있으면 현재 서명 키)
+func loadKeyManager(c JWTConfig) (*keyManager, error) {
+	km := &keyManager{
+		keys:     make(map[string]*jwtKey),
+		issuer:   c.Issuer,
+		audience: c.Audience,
+	}
+	if c.LegacyUntil != "" {
+		until, err := time.Parse(time.RFC3339, c.LegacyUntil)
+		if err != nil {
+			return nil, fmt.Errorf("잘못된 JWT_LEGACY_UNTIL (RFC 3339 형식이어야 합니다): %w", err)
+		}
+		km.legacyUntil = until
+	}
+
+	signing, err := loadSigningKey(c)
+	if err != nil {
+		return nil, err
+	}
+	km.signing = signing
+	km.keys[c.KeyID] = signing
+
+	for _, entry := range strings.Split(c.VerifyKeys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, err := parseVerifyKey(entry)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := km.keys[key.id]; exists {
+			return nil, fmt.Errorf("중복된 JWT kid: %s", key.id)
+		}
+		km.keys[key.id] = key
+	}
+
+	km.legacy = km.signing
+	if c.LegacyKeyID != "" {
+		key, ok := km.keys[c.LegacyKeyID]
+		if !ok {
+			return nil, fmt.Errorf("JWT_LEGACY_KEY_ID의 kid를 찾을 수 없습니다: %s", c.LegacyKeyID)
+		}
+		km.legacy = key
+	}
+
+	return km, nil
+}
+
+func loadSigningKey(c JWTConfig) (*jwtKey, error) {
+	kid, alg := c.KeyID, c.SigningAlg
+	switch strings.ToUpper(alg) {
+	case "HS256":
+		secret := c.SecretKey
+		if secret == "" {
+			return nil, errors.New("JWT_SECRET_KEY가 설정되지 않았습니다")
+		}
+		return &jwtKey{id: kid, method: jwt.SigningMethodHS256, signKey: []byte(secret), verifyKey: []byte(secret)}, nil
+	case "EDDSA", "RS256":
+		path := c.PrivateKeyFile
+		if path == "" {
+			return nil, fmt.Errorf("%s 서명에는 JWT_PRIVATE_KEY_FILE이 필요합니다", alg)
+		}
+		block, err := readPEM(path)
+		if err != nil {
+			return nil, err
+		}
+		priv, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, fmt.Errorf("개인키 파싱 실패 (%s): %w", path, err)
+		}
+		switch k := priv.(type) {
+		case ed25519.PrivateKey:
+			return &jwtKey{id: kid, method: jwt.SigningMethodEdDSA, signKey: k, verifyKey: k.Public()}, nil
+		case *rsa.PrivateKey:
+			return &jwtKey{id: kid, method: jwt.SigningMethodRS256, signKey: k, verifyKey: &k.PublicKey}, nil
+		default:
+			return nil, fmt.Errorf("지원하지 않는 개인키 형식: %T", priv)
+		}
+	default:
+		return nil, fmt.Errorf("지원하지 않는 JWT_SIGNING_ALG: %s", alg)
+	}
+}
+
+// parseVerifyKey는 "kid=hs256:비밀키" 또는 "kid=file:경로" 형식의 항목을 해석합니다.
+func parseVerifyKey(entry string) (*jwtKey, error) {
+	kid, spec, ok := strings.Cut(entry, "=")
+	if !ok || kid == "" {
+		return nil, fmt.Errorf("잘못된 JWT_VERIFY_KEYS 항목: %q", entry)
+	}
+	kind, value, ok := strings.Cut(spec, ":")
+	if !ok || value == "" {
+		return nil, fmt.Errorf("잘못된 JWT_VERIFY_KEYS 항목: %q", entry)
+	}
+
+	switch strings.ToLower(kind) {
+	case "hs256":
+		return &jwtKey{id: kid, method: jwt.SigningMethodHS256, verifyKey: []byte(value)}, nil
+	case "file":
+		block, err := readPEM(value)
+		if err != nil {
+			return nil, err
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("공개키 파싱 실패 (%s): %w", value, err)
+		}
+		switch k := pub.(type) {
+		case ed25519.PublicKey:
+			return &jwtKey{id: kid, method: jwt.SigningMethodEdDSA, verifyKey: k}, nil
+		case *rsa.PublicKey:
+			return &jwtKey{id: kid, method: jwt.SigningMethodRS256, verifyKey: k}, nil
+		default:
+			return nil, fmt.Errorf("지원하지 않는 공개키 형식: %T", pub)
+		}
+	default:
+		return nil, fmt.Errorf("알 수 없는 키 종류 %q (kid: %s)", kind, kid)
+	}
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("키 파일 읽기 실패: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("PEM 블록을 찾을 수 없습니다: %s", path)
+	}
+	return block, nil
+}
+
+func parsePrivateKey(block *pem.Block) (interface{}, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// sign은 현재 서명 키로 토큰을 서명하고 헤더에 kid를 기록합니다.
+func (km *keyManager) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(km.signing.method, claims)
+	token.Header["kid"] = km.signing.id
+	return token.SignedString(km.signing.signKey)
+}
+
+// parse는 kid에 맞는 키로 서명을 검증하고 클레임을 채웁니다.
+func (km *keyManager) parse(tokenString string, claims *jwtClaims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, km.keyFunc, jwt.WithExpirationRequired())
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return errors.New("유효하지 않은 토큰")
+	}
+	return nil
+}
+
+func (km *keyManager) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := km.keys[kid]
+	if kid == "" {
+		// 키 로테이션 이전에 발급된 토큰에는 kid가 없으므로 legacy_key_id의 키(기본은 현재 서명 키)로 검증합니다.
+		key, ok = km.legacy, true
+		if claims, isClaims := token.Claims.(*jwtClaims); isClaims {
+			claims.legacy = true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("알 수 없는 kid: %q", kid)
+	}
+	// 키마다 허용된 알고리즘만 받아들여 알고리즘 혼동 공격을 막습니다.
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("예상치 못한 서명 알고리즘: %v", token.Header["alg"])
+	}
+	return key.verifyKey, nil
+}
+
+// acceptsLegacy는 지금 예전 형식(kid·iss·aud 없음) 토큰을 받을 수 있는지 반환합니다.
+func (km *keyManager) acceptsLegacy(now time.Time) bool {
+	return km.legacyUntil.IsZero() || now.Before(km.legacyUntil)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeEd25519Key는 임시 디렉터리에 Ed25519 개인키 PEM 파일을 만듭니다.
+func writeEd25519Key(t *testing.T) string {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwt_ed25519.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// legacyHS256Token은 키 로테이션 이전처럼 kid·iss·aud 없이 HS256으로 서명한 토큰입니다.
+func legacyHS256Token(t *testing.T, secret string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": 7,
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	})
+	s, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func useKeyManager(t *testing.T, c JWTConfig) *keyManager {
+	t.Helper()
+	km, err := loadKeyManager(c)
+	if err != nil {
+		t.Fatalf("keyManager 로드 실패: %v", err)
+	}
+	prev := jwtKeys
+	jwtKeys = km
+	t.Cleanup(func() { jwtKeys = prev })
+	return km
+}
+
+func TestLegacyTokenAfterSwitchToEdDSA(t *testing.T) {
+	keyFile := writeEd25519Key(t)
+	base := JWTConfig{
+		SigningAlg:     "EdDSA",
+		KeyID:          "2026-01",
+		PrivateKeyFile: keyFile,
+		VerifyKeys:     "primary=hs256:old_secret",
+		Issuer:         "acornhub",
+		Audience:       "acornhub",
+	}
+
+	tests := []struct {
+		name        string
+		legacyKeyID string
+		legacyUntil string
+		secret      string
+		wantOK      bool
+	}{
+		{"예전 키를 지정하면 받음", "primary", "", "old_secret", true},
+		{"지정하지 않으면 현재 서명 키와 알고리즘이 달라 거부", "", "", "old_secret", false},
+		{"다른 비밀키로 서명한 토큰은 거부", "primary", "", "forged", false},
+		{"legacy_until이 지나면 거부", "primary", "2020-01-01T00:00:00Z", "old_secret", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := base
+			c.LegacyKeyID, c.LegacyUntil = tt.legacyKeyID, tt.legacyUntil
+			km := useKeyManager(t, c)
+
+			claims := &jwtClaims{}
+			err := km.parse(legacyHS256Token(t, tt.secret), claims)
+			if tt.wantOK && err != nil {
+				t.Fatalf("예전 토큰 검증 실패: %v", err)
+			}
+			if !tt.wantOK && err == nil {
+				t.Fatal("예전 토큰이 검증을 통과했습니다")
+			}
+			if tt.wantOK && (claims.UserID != 7 || !claims.legacy) {
+				t.Errorf("클레임 = user_id %d, legacy %v", claims.UserID, claims.legacy)
+			}
+		})
+	}
+}
+
+func TestNewTokenAfterSwitchToEdDSA(t *testing.T) {
+	km := useKeyManager(t, JWTConfig{
+		SigningAlg:     "EdDSA",
+		KeyID:          "2026-01",
+		PrivateKeyFile: writeEd25519Key(t),
+		VerifyKeys:     "primary=hs256:old_secret",
+		Issuer:         "acornhub",
+		Audience:       "acornhub",
+		LegacyKeyID:    "primary",
+	})
+
+	token, err := createJWT(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := &jwtClaims{}
+	if err := km.parse(token, claims); err != nil {
+		t.Fatalf("새 토큰 검증 실패: %v", err)
+	}
+	if claims.legacy {
+		t.Error("kid가 있는 토큰이 예전 토큰으로 처리되었습니다")
+	}
+}
+
+func TestLegacyKeyIDMustExist(t *testing.T) {
+	_, err := loadKeyManager(JWTConfig{SigningAlg: "HS256", KeyID: "primary", SecretKey: "x", LegacyKeyID: "missing"})
+	if err == nil {
+		t.Error("없는 legacy_key_id에 오류가 없습니다")
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// 로컬 클러스터링 엔진
+//
+// AI 서버 없이 Go 안에서 카드를 묶습니다. 카드 내용을 검색과 같은 토큰(영문 단어, 한글 음절 bigram)의
+// TF-IDF 벡터로 바꾸고, 길이를 1로 맞춘 뒤 코사인 거리로 k-means(k-means++ 초기화, 고정 시드)를 돌립니다.
+// 카테고리 이름은 클러스터에 유독 많이 붙은 카드 태그로 짓고, 태그가 없으면 TF-IDF 가중치가 큰 단어로 짓습니다.
+// 결과는 AI 서버 /cards/cluster와 같은 ClusterInfo 목록이라 이후 저장 과정은 같습니다.
+
+const (
+	localClusterSeed       = 42
+	localClusterIterations = 50
+	localClusterNameTerms  = 2
+)
+
+// defaultClusterCount는 AI 서버와 같은 규칙으로 클러스터 개수를 정합니다 (카드 수의 절반, 2~5개).
+func defaultClusterCount(cards int) int {
+	k := min(cards/2, 5)
+	if k < 2 {
+		k = 2
+	}
+	return k
+}
+
+// localClusters는 cards를 k개(0이면 자동)로 묶습니다. 카드가 2개 미만이면 모두 '미분류'로 둡니다.
+func localClusters(cards []ClusterCard, k int) []ClusterInfo {
+	if len(cards) < 2 {
+		ids := make([]int64, len(cards))
+		for i, c := range cards {
+			ids[i] = c.ID
+		}
+		return []ClusterInfo{{CategoryName: uncategorizedCategory, CardIDs: ids}}
+	}
+	if k == 0 {
+		k = defaultClusterCount(len(cards))
+	}
+	k = min(k, len(cards))
+
+	vectors, vocab := tfidfVectors(cards)
+	labels := sphericalKMeans(vectors, len(vocab), k)
+
+	groups := make([][]int, k)
+	for i, label := range labels {
+		groups[label] = append(groups[label], i)
+	}
+
+	var clusters []ClusterInfo
+	used := make(map[string]int)
+	for _, members := range groups {
+		if len(members) == 0 {
+			continue
+		}
+		name := clusterName(cards, vectors, vocab, members)
+		if name == "" {
+			name = fmt.Sprintf("카테고리 %d", len(clusters)+1)
+		}
+		used[name]++
+		if used[name] > 1 {
+			name = fmt.Sprintf("%s (%d)", name, used[name])
+		}
+		ids := make([]int64, len(members))
+		for i, m := range members {
+			ids[i] = cards[m].ID
+		}
+		clusters = append(clusters, ClusterInfo{CategoryName: name, CardIDs: ids})
+	}
+	return clusters
+}
+
+// sparseVector는 단어 번호별 가중치입니다.
+type sparseVector map[int]float64
+
+// tfidfVectors는 카드마다 길이가 1인 TF-IDF 벡터와 단어 목록을 만듭니다.
+func tfidfVectors(cards []ClusterCard) ([]sparseVector, []string) {
+	index := make(map[string]int)
+	var vocab []string
+	counts := make([]map[int]int, len(cards))
+	df := make(map[int]int)
+	for i, c := range cards {
+		counts[i] = make(map[int]int)
+		for _, t := range searchTokens(c.Content) {
+			id, ok := index[t]
+			if !ok {
+				id = len(vocab)
+				index[t] = id
+				vocab = append(vocab, t)
+			}
+			if counts[i][id] == 0 {
+				df[id]++
+			}
+			counts[i][id]++
+		}
+	}
+
+	n := float64(len(cards))
+	vectors := make([]sparseVector, len(cards))
+	for i, tf := range counts {
+		v := make(sparseVector, len(tf))
+		var norm float64
+		for id, count := range tf {
+			w := (1 + math.Log(float64(count))) * math.Log((1+n)/(1+float64(df[id]))+1)
+			v[id] = w
+			norm += w * w
+		}
+		if norm > 0 {
+			norm = math.Sqrt(norm)
+			for id := range v {
+				v[id] /= norm
+			}
+		}
+		vectors[i] = v
+	}
+	return vectors, vocab
+}
+
+// sphericalKMeans는 길이가 1인 벡터를 코사인 유사도 기준 k개로 묶어 벡터별 클러스터 번호를 반환합니다.
+func sphericalKMeans(vectors []sparseVector, dims, k int) []int {
+	rng := rand.New(rand.NewSource(localClusterSeed))
+	centroids := kMeansPlusPlus(vectors, dims, k, rng)
+	labels := make([]int, len(vectors))
+	for i := range labels {
+		labels[i] = -1
+	}
+
+	for iter := 0; iter < localClusterIterations; iter++ {
+		changed := false
+		for i, v := range vectors {
+			best, bestScore := 0, math.Inf(-1)
+			for c, centroid := range centroids {
+				if s := sparseDot(v, centroid); s > bestScore {
+					best, bestScore = c, s
+				}
+			}
+			if labels[i] != best {
+				labels[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		sizes := make([]int, k)
+		for c := range centroids {
+			centroids[c] = make([]float64, dims)
+		}
+		for i, v := range vectors {
+			sizes[labels[i]]++
+			for id, w := range v {
+				centroids[labels[i]][id] += w
+			}
+		}
+		for c, centroid := range centroids {
+			if sizes[c] == 0 {
+				// 빈 클러스터는 아무 카드나 새 중심으로 삼아 다음 반복에서 다시 채웁니다.
+				centroids[c] = densify(vectors[rng.Intn(len(vectors))], dims)
+				continue
+			}
+			normalize(centroid)
+		}
+	}
+	return labels
+}
+
+// kMeansPlusPlus는 이미 고른 중심과 먼 벡터일수록 잘 뽑히도록 초기 중심 k개를 고릅니다.
+func kMeansPlusPlus(vectors []sparseVector, dims, k int, rng *rand.Rand) [][]float64 {
+	centroids := [][]float64{densify(vectors[rng.Intn(len(vectors))], dims)}
+	distances := make([]float64, len(vectors))
+	for len(centroids) < k {
+		var total float64
+		for i, v := range vectors {
+			closest := math.Inf(1)
+			for _, c := range centroids {
+				closest = math.Min(closest, 1-sparseDot(v, c))
+			}
+			distances[i] = math.Max(closest, 0)
+			total += distances[i]
+		}
+		next := rng.Intn(len(vectors))
+		if total > 0 {
+			target := rng.Float64() * total
+			for i, d := range distances {
+				if target -= d; target <= 0 {
+					next = i
+					break
+				}
+			}
+		}
+		centroids = append(centroids, densify(vectors[next], dims))
+	}
+	return centroids
+}
+
+func sparseDot(v sparseVector, dense []float64) float64 {
+	var sum float64
+	for id, w := range v {
+		sum += w * dense[id]
+	}
+	return sum
+}
+
+func densify(v sparseVector, dims int) []float64 {
+	dense := make([]float64, dims)
+	for id, w := range v {
+		dense[id] = w
+	}
+	return dense
+}
+
+func normalize(v []float64) {
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm == 0 {
+		return
+	}
+	norm = math.Sqrt(norm)
+	for i := range v {
+		v[i] /= norm
+	}
+}
+
+// clusterName은 클러스터 카드의 태그 중 전체보다 이 클러스터에 많이 붙은 태그로 이름을 짓습니다.
+// 태그가 없으면 클러스터 TF-IDF 가중치가 큰 단어를 씁니다.
+func clusterName(cards []ClusterCard, vectors []sparseVector, vocab []string, members []int) string {
+	overall := make(map[string]int)
+	for _, c := range cards {
+		for _, tag := range c.Tags {
+			overall[tag]++
+		}
+	}
+	inCluster := make(map[string]int)
+	for _, m := range members {
+		for _, tag := range cards[m].Tags {
+			inCluster[tag]++
+		}
+	}
+	tagScores := make(map[string]float64, len(inCluster))
+	for tag, count := range inCluster {
+		// 클러스터 안 빈도 × 클러스터 집중도
+		tagScores[tag] = float64(count) * float64(count) / float64(overall[tag])
+	}
+	if names := topTerms(tagScores); len(names) > 0 {
+		return strings.Join(names, " · ")
+	}
+
+	termScores := make(map[string]float64)
+	for _, m := range members {
+		for id, w := range vectors[m] {
+			termScores[vocab[id]] += w
+		}
+	}
+	return strings.Join(topTerms(termScores), " · ")
+}
+
+// topTerms는 점수가 큰 순서(같으면 이름순)로 최대 localClusterNameTerms개를 고릅니다.
+func topTerms(scores map[string]float64) []string {
+	terms := make([]string, 0, len(scores))
+	for term := range scores {
+		if term != "" {
+			terms = append(terms, term)
+		}
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if scores[terms[i]] != scores[terms[j]] {
+			return scores[terms[i]] > scores[terms[j]]
+		}
+		return terms[i] < terms[j]
+	})
+	return terms[:min(localClusterNameTerms, len(terms))]
+}
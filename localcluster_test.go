@@ -0,0 +1,109 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// clusterTestCards는 Go 글 세 장과 요리 글 세 장입니다.
+func clusterTestCards() []ClusterCard {
+	return []ClusterCard{
+		{ID: 1, Content: "Go 언어의 고루틴과 채널로 동시성 프로그래밍", Tags: []string{"Go", "동시성"}},
+		{ID: 2, Content: "Go 고루틴 스케줄러와 채널 동작 원리", Tags: []string{"Go", "고루틴"}},
+		{ID: 3, Content: "Go 채널 select 패턴과 고루틴 누수", Tags: []string{"Go"}},
+		{ID: 4, Content: "김치찌개 레시피: 돼지고기와 묵은지 김치", Tags: []string{"요리", "김치"}},
+		{ID: 5, Content: "된장찌개 레시피와 두부 손질", Tags: []string{"요리"}},
+		{ID: 6, Content: "김치볶음밥 레시피 김치 요리", Tags: []string{"요리", "김치"}},
+	}
+}
+
+func TestLocalClustersIsDeterministic(t *testing.T) {
+	tests := []struct {
+		name   string
+		k      int
+		noTags bool
+	}{
+		{"자동 K", 0, false},
+		{"K 지정", 2, false},
+		{"태그 없는 카드", 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cards := clusterTestCards()
+			if tt.noTags {
+				for i := range cards {
+					cards[i].Tags = nil
+				}
+			}
+			want := localClusters(cards, tt.k)
+			if tt.k > 0 && len(want) != tt.k {
+				t.Fatalf("클러스터 수 = %d, want %d", len(want), tt.k)
+			}
+			for i := 0; i < 20; i++ {
+				if got := localClusters(cards, tt.k); !reflect.DeepEqual(got, want) {
+					t.Fatalf("%d번째 실행 결과가 다릅니다: %+v, want %+v", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalClustersGroupsByContent(t *testing.T) {
+	tests := []struct {
+		name   string
+		noTags bool
+		names  []string
+	}{
+		{"태그로 이름 짓기", false, []string{"요리 · 김치", "Go · 고루틴"}},
+		{"태그가 없으면 단어로 이름 짓기", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cards := clusterTestCards()
+			if tt.noTags {
+				for i := range cards {
+					cards[i].Tags = nil
+				}
+			}
+			clusters := localClusters(cards, 2)
+			groups := make(map[string][]int64)
+			for _, c := range clusters {
+				if c.CategoryName == "" {
+					t.Errorf("이름 없는 클러스터: %v", c.CardIDs)
+				}
+				ids := slices.Clone(c.CardIDs)
+				slices.Sort(ids)
+				groups[c.CategoryName] = ids
+			}
+			if len(groups) != 2 {
+				t.Fatalf("클러스터 = %+v, want 이름이 다른 2개", clusters)
+			}
+			for _, ids := range groups {
+				if !slices.Equal(ids, []int64{1, 2, 3}) && !slices.Equal(ids, []int64{4, 5, 6}) {
+					t.Errorf("Go 글과 요리 글이 섞였습니다: %+v", clusters)
+				}
+			}
+			for _, name := range tt.names {
+				if _, ok := groups[name]; !ok {
+					t.Errorf("클러스터 이름에 %q가 없습니다: %+v", name, clusters)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalClustersTooFewCards(t *testing.T) {
+	clusters := localClusters(clusterTestCards()[:1], 0)
+	if len(clusters) != 1 || clusters[0].CategoryName != uncategorizedCategory || !slices.Equal(clusters[0].CardIDs, []int64{1}) {
+		t.Errorf("카드 1장 결과 = %+v, want 미분류 하나", clusters)
+	}
+}
+
+func TestDefaultClusterCount(t *testing.T) {
+	for cards, want := range map[int]int{0: 2, 3: 2, 7: 3, 10: 5, 30: 5} {
+		if got := defaultClusterCount(cards); got != want {
+			t.Errorf("defaultClusterCount(%d) = %d, want %d", cards, got, want)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 로컬 태그 추출기
+//
+// AI 서버 없이 Go 안에서 카드 태그를 만듭니다. 후보는 세 가지입니다.
+//   - 사용자 사전(tags.dictionary_path)에 있는 단어 중 카드 내용에 나오는 것
+//   - 카드 URL의 도메인 (github.com → GitHub, blog.example.co.kr → example)
+//   - 내용에서 자주 나오는 단어와 두 단어 묶음(bigram). 한국어 조사를 떼고 불용어는 뺍니다.
+// 사전 단어, 도메인, 빈도 순으로 tags.max_tags개까지 고릅니다.
+
+const (
+	tagEngineAuto  = "auto"
+	tagEngineAI    = "ai"
+	tagEngineLocal = "local"
+)
+
+// tagDictionary는 시작할 때 tags.dictionary_path에서 읽은 사용자 사전입니다.
+var tagDictionary []string
+
+// koreanStopwords는 태그 후보에서 뺄 흔한 한국어 단어입니다 (조사를 뗀 형태).
+var koreanStopwords = map[string]bool{
+	"그리고": true, "그러나": true, "하지만": true, "그래서": true, "또는": true, "또한": true, "그런데": true,
+	"이것": true, "그것": true, "저것": true, "여기": true, "거기": true, "우리": true, "저희": true,
+	"이런": true, "그런": true, "저런": true, "어떤": true, "모든": true, "다른": true, "같은": true,
+	"위해": true, "통해": true, "대한": true, "대해": true, "관련": true, "때문": true, "경우": true, "정도": true,
+	"가장": true, "매우": true, "아주": true, "정말": true, "너무": true, "조금": true, "많이": true, "다시": true,
+	"있다": true, "없다": true, "한다": true, "된다": true, "이다": true, "하는": true, "있는": true, "없는": true,
+	"되는": true, "했다": true, "것이": true, "수도": true, "이후": true, "이전": true, "현재": true, "지금": true,
+}
+
+// englishTagStopwords는 태그 후보에서 뺄 흔한 영어 단어입니다 (소문자).
+// 검색용 englishStopwords보다 넓게 대명사, 조동사, 부사까지 뺍니다.
+var englishTagStopwords = map[string]bool{
+	"a": true, "an": true, "the": true, "and": true, "or": true, "but": true, "if": true, "then": true, "so": true,
+	"of": true, "in": true, "on": true, "at": true, "by": true, "for": true, "from": true, "to": true, "with": true,
+	"about": true, "into": true, "over": true, "after": true, "before": true, "between": true, "through": true,
+	"i": true, "me": true, "my": true, "we": true, "us": true, "our": true, "you": true, "your": true,
+	"he": true, "him": true, "his": true, "she": true, "her": true, "it": true, "its": true, "they": true, "them": true, "their": true,
+	"this": true, "that": true, "these": true, "those": true, "what": true, "which": true, "who": true, "whom": true,
+	"when": true, "where": true, "why": true, "how": true, "there": true, "here": true,
+	"is": true, "are": true, "was": true, "were": true, "be": true, "been": true, "being": true, "am": true,
+	"do": true, "does": true, "did": true, "done": true, "have": true, "has": true, "had": true, "having": true,
+	"will": true, "would": true, "shall": true, "should": true, "can": true, "could": true, "may": true, "might": true, "must": true,
+	"not": true, "no": true, "nor": true, "yes": true, "as": true, "than": true, "too": true, "very": true, "just": true,
+	"also": true, "only": true, "more": true, "most": true, "some": true, "any": true, "all": true, "each": true,
+	"other": true, "such": true, "same": true, "own": true, "both": true, "few": true, "many": true, "much": true,
+	"get": true, "got": true, "make": true, "made": true, "use": true, "used": true, "using": true,
+	"one": true, "like": true, "now": true, "out": true, "up": true, "down": true, "off": true, "again": true,
+}
+
+// koreanParticles는 단어 끝에서 뗄 조사입니다. 긴 것부터 검사합니다.
+var koreanParticles = []string{
+	"에서는", "으로는", "에게서", "이라는", "에서", "으로", "에게", "까지", "부터", "처럼", "보다", "라는", "이나",
+	"과의", "와의", "은", "는", "이", "가", "을", "를", "의", "에", "로", "와", "과", "도", "만", "나",
+}
+
+// koreanPredicateEndings로 끝나는 단어는 서술어로 보고 후보에서 뺍니다.
+var koreanPredicateEndings = []string{"니다", "었다", "였다", "했다", "한다", "된다", "하다", "되다", "하고", "하며", "해서", "하여", "되어", "하는", "되는", "했던", "있다", "없다"}
+
+// domainTags는 잘 알려진 도메인의 태그 표기입니다.
+var domainTags = map[string]string{
+	"github.com":    "GitHub",
+	"gitlab.com":    "GitLab",
+	"arxiv.org":     "arXiv",
+	"youtube.com":   "YouTube",
+	"youtu.be":      "YouTube",
+	"medium.com":    "Medium",
+	"wikipedia.org": "Wikipedia",
+	"notion.so":     "Notion",
+	"velog.io":      "velog",
+	"tistory.com":   "Tistory",
+	"naver.com":     "Naver",
+}
+
+// loadTagDictionary는 한 줄에 태그 하나씩 적힌 사전 파일을 읽습니다. 빈 줄과 #으로 시작하는 줄은 건너뜁니다.
+func loadTagDictionary(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var terms []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		term := strings.TrimSpace(scanner.Text())
+		if term == "" || strings.HasPrefix(term, "#") || seen[strings.ToLower(term)] {
+			continue
+		}
+		seen[strings.ToLower(term)] = true
+		terms = append(terms, term)
+	}
+	return terms, scanner.Err()
+}
+
+// localTags는 카드 내용과 URL에서 태그를 최대 maxTags개 뽑습니다.
+func localTags(text, cardURL string, maxTags int) []string {
+	var tags []string
+	add := func(tag string) bool {
+		if len(tags) >= maxTags {
+			return false
+		}
+		lower := strings.ToLower(tag)
+		for _, t := range tags {
+			// 이미 고른 태그와 겹치는 후보("자연어", "자연어 처리")는 건너뜁니다.
+			if tl := strings.ToLower(t); strings.Contains(tl, lower) || strings.Contains(lower, tl) {
+				return true
+			}
+		}
+		tags = append(tags, tag)
+		return true
+	}
+
+	words := tagTokens(strings.ToLower(text))
+	for _, term := range tagDictionary {
+		if containsTerm(words, tagTokens(strings.ToLower(term))) && !add(term) {
+			return tags
+		}
+	}
+	if tag := urlTag(cardURL); tag != "" && !add(tag) {
+		return tags
+	}
+	for _, term := range frequentTerms(text) {
+		if !add(term) {
+			break
+		}
+	}
+	return tags
+}
+
+// urlTag는 카드 URL의 도메인으로 태그를 만듭니다. URL이 없거나 잘못되었으면 빈 문자열입니다.
+func urlTag(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	labels := strings.Split(host, ".")
+	for i := range labels {
+		if tag, ok := domainTags[strings.Join(labels[i:], ".")]; ok {
+			return tag
+		}
+	}
+	// co.kr, ac.kr처럼 두 단계 최상위 도메인은 한 단계 더 앞의 이름을 씁니다.
+	if len(labels) >= 3 && len(labels[len(labels)-2]) <= 3 && len(labels[len(labels)-1]) == 2 {
+		return labels[len(labels)-3]
+	}
+	if len(labels) >= 2 {
+		return labels[len(labels)-2]
+	}
+	return ""
+}
+
+// frequentTerms는 내용의 단어와 연속된 두 단어를 빈도 순으로 정렬해 반환합니다.
+// 두 단어 묶음은 두 번 이상 나온 것만 후보로 삼고, 같은 빈도면 단어 하나보다 앞에 둡니다.
+func frequentTerms(text string) []string {
+	counts := make(map[string]int)
+	display := make(map[string]string)
+	first := make(map[string]int)
+	count := func(term string) {
+		key := strings.ToLower(term)
+		if _, ok := display[key]; !ok {
+			display[key] = term
+			first[key] = len(first)
+		}
+		counts[key]++
+	}
+
+	prev := ""
+	for _, word := range tagTokens(text) {
+		word = tagWord(word)
+		if word == "" {
+			prev = ""
+			continue
+		}
+		count(word)
+		if prev != "" {
+			count(prev + " " + word)
+		}
+		prev = word
+	}
+
+	terms := make([]string, 0, len(counts))
+	for key, n := range counts {
+		if strings.Contains(key, " ") && n < 2 {
+			continue
+		}
+		terms = append(terms, key)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		a, b := terms[i], terms[j]
+		if counts[a] != counts[b] {
+			return counts[a] > counts[b]
+		}
+		if ab, bb := strings.Contains(a, " "), strings.Contains(b, " "); ab != bb {
+			return ab
+		}
+		return first[a] < first[b]
+	})
+	for i, key := range terms {
+		terms[i] = display[key]
+	}
+	return terms
+}
+
+// tagTokens는 text를 단어로 나눕니다. 글자, 숫자와 C++, C#, real-time에 쓰이는 +, #, -만 단어에 남깁니다.
+func tagTokens(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '+' && r != '#'
+	})
+}
+
+// containsTerm은 words에 term의 단어들이 이어서 나오는지 봅니다 ("Go"는 "good"과 맞지 않습니다).
+// 마지막 단어에는 한국어 조사가 붙어 있어도 됩니다 ("Go는", "자연어 처리를").
+func containsTerm(words, term []string) bool {
+	if len(term) == 0 {
+		return false
+	}
+	for i := 0; i+len(term) <= len(words); i++ {
+		matched := true
+		for j, t := range term {
+			w := words[i+j]
+			if w != t && (j < len(term)-1 || !hasParticle(w, t)) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// hasParticle은 word가 stem 뒤에 한국어 조사 하나를 붙인 형태인지 봅니다.
+func hasParticle(word, stem string) bool {
+	rest, ok := strings.CutPrefix(word, stem)
+	return ok && slices.Contains(koreanParticles, rest)
+}
+
+// tagWord는 단어를 태그 후보 형태로 다듬습니다. 조사를 떼고, 불용어·서술어·한 글자 단어·숫자는 빈 문자열로 바꿉니다.
+func tagWord(word string) string {
+	word = strings.Trim(word, "-")
+	if isHangulWord(word) {
+		for _, e := range koreanPredicateEndings {
+			if strings.HasSuffix(word, e) {
+				return ""
+			}
+		}
+		for _, p := range koreanParticles {
+			if stem := strings.TrimSuffix(word, p); stem != word && utf8.RuneCountInString(stem) >= 2 {
+				word = stem
+				break
+			}
+		}
+		if koreanStopwords[word] {
+			return ""
+		}
+	} else if englishTagStopwords[strings.ToLower(word)] {
+		return ""
+	}
+	if utf8.RuneCountInString(word) < 2 || strings.IndexFunc(word, unicode.IsLetter) < 0 {
+		return ""
+	}
+	return word
+}
+
+func isHangulWord(word string) bool {
+	for _, r := range word {
+		if !unicode.Is(unicode.Hangul, r) {
+			return false
+		}
+	}
+	return word != ""
+}
+
+func validTagEngine(engine string) bool {
+	return engine == tagEngineAuto || engine == tagEngineAI || engine == tagEngineLocal
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// useTagDictionary는 테스트 동안 tagDictionary를 terms로 바꿉니다.
+func useTagDictionary(t *testing.T, terms ...string) {
+	t.Helper()
+	prev := tagDictionary
+	tagDictionary = terms
+	t.Cleanup(func() { tagDictionary = prev })
+}
+
+func TestFrequentTermsSkipsStopwords(t *testing.T) {
+	terms := frequentTerms("그리고 우리는 임베딩 모델을 만들었다. 임베딩 모델은 벡터를 만든다. this is the model and the vector")
+	want := []string{"임베딩 모델", "임베딩", "모델", "벡터"}
+	if len(terms) < len(want) || !slices.Equal(terms[:len(want)], want) {
+		t.Errorf("frequentTerms = %q, want %q로 시작", terms, want)
+	}
+	for _, stop := range []string{"그리고", "우리", "우리는", "만들었다", "this", "is", "the", "and"} {
+		if slices.Contains(terms, stop) {
+			t.Errorf("불용어 %q가 후보에 있습니다: %q", stop, terms)
+		}
+	}
+}
+
+func TestTagWord(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"모델을", "모델"},
+		{"임베딩에서는", "임베딩"},
+		{"그리고", ""},
+		{"우리는", ""},
+		{"사용했다", ""},
+		{"The", ""},
+		{"which", ""},
+		{"Rust", "Rust"},
+		{"C++", "C++"},
+		{"-real-time-", "real-time"},
+		{"x", ""},
+		{"2026", ""},
+	}
+	for _, tt := range tests {
+		if got := tagWord(tt.word); got != tt.want {
+			t.Errorf("tagWord(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestContainsTerm(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		term string
+		want bool
+	}{
+		{"단어 그대로", "go tool", "go", true},
+		{"조사가 붙은 단어", "go는 빠릅니다", "go", true},
+		{"다른 단어의 일부", "good news", "go", false},
+		{"조사가 아닌 접미사", "gopher", "go", false},
+		{"두 단어", "자연어 처리를 공부", "자연어 처리", true},
+		{"두 단어가 떨어져 있음", "자연어 기반 처리", "자연어 처리", false},
+		{"앞 단어에는 조사를 허용하지 않음", "자연어의 처리", "자연어 처리", false},
+		{"빈 term", "go", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := containsTerm(tagTokens(tt.text), tagTokens(tt.term)); got != tt.want {
+				t.Errorf("containsTerm(%q, %q) = %v, want %v", tt.text, tt.term, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestURLTag(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://www.github.com/golang/go", "GitHub"},
+		{"https://en.wikipedia.org/wiki/Go", "Wikipedia"},
+		{"https://arxiv.org/abs/1706.03762", "arXiv"},
+		{"https://blog.example.co.kr/post/1", "example"},
+		{"https://news.ycombinator.com/item?id=1", "ycombinator"},
+		{"localhost", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := urlTag(tt.url); got != tt.want {
+			t.Errorf("urlTag(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestLocalTags(t *testing.T) {
+	useTagDictionary(t, "Go", "자연어 처리", "Rust")
+
+	tests := []struct {
+		name    string
+		text    string
+		url     string
+		maxTags int
+		want    []string
+	}{
+		{"사전 단어가 먼저", "good news about 자연어 처리를 공부", "", 5, []string{"자연어 처리", "good", "news", "공부"}},
+		{"조사가 붙은 사전 단어", "Go는 빠릅니다", "", 5, []string{"Go"}},
+		{"사전, 도메인, 빈도 순", "Rust 예제 모음", "https://github.com/x/y", 5, []string{"Rust", "GitHub", "예제", "모음"}},
+		{"URL만 있는 카드", "", "https://arxiv.org/abs/1", 5, []string{"arXiv"}},
+		{"겹치는 후보는 건너뜀", "형태소 분석 형태소 분석 형태소", "", 5, []string{"형태소", "분석"}},
+		{"maxTags에서 멈춤", "Rust 예제 모음", "https://github.com/x/y", 2, []string{"Rust", "GitHub"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := localTags(tt.text, tt.url, tt.maxTags); !slices.Equal(got, tt.want) {
+				t.Errorf("localTags = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestInfo는 요청 하나에 대한 로그 정보입니다.
+// 요청 ID 미들웨어가 만들고, authMiddleware가 인증된 사용자 ID를 채웁니다.
+// ProjectID는 핸들러가 프로젝트 권한을 확인한 뒤 setUsageProject로 채우며, AI 사용량 기록에 쓰입니다.
+type requestInfo struct {
+	ID        string
+	UserID    int64
+	ProjectID int64
+}
+
+const requestInfoKey = contextKey("requestInfo")
+
+// 클라이언트가 보낸 요청 ID는 로그 주입을 막기 위해 제한된 문자만 허용합니다.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+func setupLogger(c LogConfig) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		return fmt.Errorf("잘못된 로그 레벨 %q: %w", c.Level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch c.Format {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	case "text":
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	default:
+		return fmt.Errorf("지원하지 않는 로그 형식: %q (text, json)", c.Format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey).(*requestInfo)
+	return info
+}
+
+// detachedRequestInfo는 요청이 끝난 뒤 실행되는 백그라운드 작업에 넘길 요청 정보 사본을 만듭니다.
+func detachedRequestInfo(ctx context.Context) requestInfo {
+	if info := requestInfoFrom(ctx); info != nil {
+		return *info
+	}
+	return requestInfo{}
+}
+
+func requestIDFrom(ctx context.Context) string {
+	if info := requestInfoFrom(ctx); info != nil {
+		return info.ID
+	}
+	return ""
+}
+
+// statusRecorder는 액세스 로그를 위해 응답 상태 코드와 크기를 기록합니다.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap은 http.ResponseController가 Flush 등 원래 Writer의 기능을 사용할 수 있게 합니다.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// requestLogging은 모든 요청에 요청 ID를 부여하고, 응답 후 액세스 로그를 남깁니다.
+// 요청 ID는 X-Request-ID 응답 헤더와 AI 서버 호출 헤더로 전달됩니다.
+func requestLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		info := &requestInfo{ID: id}
+		w.Header().Set(requestIDHeader, id)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		ctx := context.WithValue(r.Context(), requestInfoKey, info)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= 500:
+			level = slog.LevelError
+		case rec.status >= 400:
+			level = slog.LevelWarn
+		}
+		attrs := []any{
+			"request_id", id,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_addr", r.RemoteAddr,
+		}
+		if info.UserID != 0 {
+			attrs = append(attrs, "user_id", info.UserID)
+		}
+		if traceID := traceIDFrom(r.Context()); traceID != "" {
+			attrs = append(attrs, "trace_id", traceID)
+		}
+		slog.Log(r.Context(), level, "http request", attrs...)
+	})
+}
+
+// httpError는 http.Error와 같지만 응답 본문에 요청 ID를 붙이고,
+// 서버 오류(5xx)는 같은 요청 ID로 로그를 남깁니다.
+func httpError(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	id := requestIDFrom(r.Context())
+	if code >= 500 {
+		slog.Error("요청 처리 실패", "request_id", id, "path", r.URL.Path, "status", code, "error", msg)
+	}
+	if id != "" && !strings.Contains(msg, id) {
+		msg = fmt.Sprintf("%s (요청 ID: %s)", msg, id)
+	}
+	http.Error(w, msg, code)
+}
@@ -1,13 +1,14 @@
 package main 
 
 import (
-	"os"
 	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"time"
 	"github.com/golang-jwt/jwt/v5"
@@ -21,30 +22,49 @@ type GitHubUser struct {
 type jwtClaims struct {
 	UserID int64 `json:"user_id"`
 	jwt.RegisteredClaims
+
+	// legacy는 kid 없이 서명된(키 로테이션 이전에 발급된) 토큰인지 나타냅니다. keyFunc가 채웁니다.
+	legacy bool
+}
+
+// Validate는 jwt 라이브러리의 기본 검증(만료 등) 이후에 호출되어
+// 발급자와 대상이 이 서버의 설정과 일치하는지 확인합니다.
+// 예전 형식 토큰은 iss·aud가 없으므로 jwt.legacy_until까지(비어 있으면 만료될 때까지) 검사 없이 받습니다.
+func (c *jwtClaims) Validate() error {
+	if c.UserID == 0 {
+		return errors.New("user_id 클레임이 없습니다")
+	}
+	if c.legacy && c.Issuer == "" && len(c.Audience) == 0 && jwtKeys.acceptsLegacy(time.Now()) {
+		return nil
+	}
+	if c.Issuer != jwtKeys.issuer {
+		return fmt.Errorf("잘못된 발급자: %q", c.Issuer)
+	}
+	for _, aud := range c.Audience {
+		if aud == jwtKeys.audience {
+			return nil
+		}
+	}
+	return fmt.Errorf("잘못된 대상: %v", c.Audience)
 }
 
 func createJWT(userID int64) (string, error) {
-	expirationTime := time.Now().Add(8 * time.Hour)
+	if jwtKeys == nil {
+		return "", fmt.Errorf("JWT 키가 초기화되지 않았습니다")
+	}
 
+	now := time.Now()
 	claims := &jwtClaims{
 		UserID: userID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			Issuer:    jwtKeys.issuer,
+			Audience:  jwt.ClaimStrings{jwtKeys.audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(8 * time.Hour)),
 		},
 	}
 
-	jwtKey := []byte(os.Getenv("JWT_SECRET_KEY"))
-	if len(jwtKey) == 0 {
-		return "", fmt.Errorf("JWT_SECRET_KEY가 설정되지 않았습니다")
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
-	if err != nil {
-		return "", err
-	}
-
-	return tokenString, nil
+	return jwtKeys.sign(claims)
 }
 
 func handleLogout(w http.ResponseWriter, r *http.Request) {
@@ -82,13 +102,13 @@ func handleGitHubCallback(w http.ResponseWriter, r *http.Request) {
 
 	stateCookie, err := r.Cookie("oauth_state")
 	if err != nil {
-		fmt.Println("State 쿠키 없음")
+		slog.Warn("State 쿠키 없음", "request_id", requestIDFrom(r.Context()))
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
 	if stateFromURL != stateCookie.Value {
-		fmt.Println("Invalid state: URL과 쿠키의 state 불일치")
+		slog.Warn("Invalid state: URL과 쿠키의 state 불일치", "request_id", requestIDFrom(r.Context()))
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
@@ -104,7 +124,7 @@ func handleGitHubCallback(w http.ResponseWriter, r *http.Request) {
 
 	token, err := githubOauthConfig.Exchange(context.Background(), code)
 	if err != nil {
-		fmt.Printf("Code 교환 실패: %s\n", err)
+		slog.Error("Code 교환 실패", "request_id", requestIDFrom(r.Context()), "error", err)
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
@@ -113,7 +133,7 @@ func handleGitHubCallback(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := client.Get("https://api.github.com/user")
 	if err != nil {
-		fmt.Printf("GitHub 유저 정보 요청 실패: %s\n", err)
+		slog.Error("GitHub 유저 정보 요청 실패", "request_id", requestIDFrom(r.Context()), "error", err)
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
@@ -121,20 +141,20 @@ func handleGitHubCallback(w http.ResponseWriter, r *http.Request) {
 
 	userData, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("유저 정보 응답 읽기 실패: %s\n", err)
+		slog.Error("유저 정보 응답 읽기 실패", "request_id", requestIDFrom(r.Context()), "error", err)
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
 	var githubUser GitHubUser
 	if err = json.Unmarshal(userData, &githubUser); err != nil {
-		fmt.Printf("유저 정보 JSON 파싱 실패: %s\n", err)
+		slog.Error("유저 정보 JSON 파싱 실패", "request_id", requestIDFrom(r.Context()), "error", err)
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
 	if db == nil {
-		fmt.Println("DB가 초기화되지 않았습니다. (main.go 확인 필요)")
+		slog.Error("DB가 초기화되지 않았습니다. (main.go 확인 필요)", "request_id", requestIDFrom(r.Context()))
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
@@ -142,16 +162,19 @@ func handleGitHubCallback(w http.ResponseWriter, r *http.Request) {
 	query := `INSERT OR IGNORE INTO users (id, username) VALUES (?, ?)`
 	_, err = db.Exec(query, githubUser.ID, githubUser.Username)
 	if err != nil {
-		fmt.Printf("DB에 유저 저장 실패: %s\n", err)
+		slog.Error("DB에 유저 저장 실패", "request_id", requestIDFrom(r.Context()), "error", err)
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	fmt.Printf("로그인 성공: %s (ID: %d)\n", githubUser.Username, githubUser.ID)
+	if info := requestInfoFrom(r.Context()); info != nil {
+		info.UserID = githubUser.ID
+	}
+	slog.Info("로그인 성공", "request_id", requestIDFrom(r.Context()), "username", githubUser.Username, "user_id", githubUser.ID)
 
 	tokenString, err := createJWT(githubUser.ID)
 	if err != nil {
-		fmt.Printf("JWT 생성 실패: %s\n", err)
+		slog.Error("JWT 생성 실패", "request_id", requestIDFrom(r.Context()), "error", err)
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
@@ -1,17 +1,26 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func handleMe(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(userContextKey).(int64)
 	if !ok {
-		http.Error(w, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
 		return
 	}
 
@@ -19,7 +28,7 @@ func handleMe(w http.ResponseWriter, r *http.Request) {
 		var userName string
 
 		query := `SELECT username FROM users WHERE id = ?;`
-		err := db.QueryRow(query, userID).Scan(&userName)
+		err := db.QueryRowContext(r.Context(), query, userID).Scan(&userName)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				w.WriteHeader(http.StatusNotFound)
@@ -39,7 +48,7 @@ func handleMe(w http.ResponseWriter, r *http.Request) {
 
 		jsonData, err := json.Marshal(respData)
 		if err != nil {
-			http.Error(w, "JSON 인코딩 실패", http.StatusInternalServerError)
+			httpError(w, r, "JSON 인코딩 실패", http.StatusInternalServerError)
 			return
 		}
 
@@ -54,21 +63,136 @@ func main() {
 	}
 	defer db.Close()
 
-	http.HandleFunc("/auth/logout", handleLogout)
-	http.HandleFunc("/auth/github", handleGitHubLogin)
-	http.HandleFunc("/auth/github/callback", handleGitHubCallback)
+	// SIGINT/SIGTERM을 받으면 ctx가 취소되고 종료 절차를 시작합니다.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := setupTracing(ctx, cfg.Tracing)
+	if err != nil {
+		log.Fatalf("트레이싱 설정 실패: %v", err)
+	}
+
+	aiBreaker = newCircuitBreaker(cfg.AI.BreakerThreshold, cfg.AI.BreakerOpenFor)
+	registerAIBreakerMetrics(aiBreaker)
+
+	jobs = newJobQueue(cfg.Jobs.QueueSize)
+	jobs.start(cfg.Jobs.Workers)
+	registerJobQueueMetrics(jobs)
+
+	projectEvents = newProjectHub()
+	registerProjectHubMetrics(projectEvents)
+
+	docSessions = newSessionManager()
+	registerDocumentSessionMetrics(docSessions)
+
+	embeddings = newEmbeddingCache(cfg.AI.EmbeddingCacheSize)
+	registerEmbeddingCacheMetrics(embeddings)
+
+	rateLimits = newRateLimiter(cfg.Throttle)
+
+	tagDictionary, err = loadTagDictionary(cfg.Tags.DictionaryPath)
+	if err != nil {
+		log.Fatalf("태그 사전 읽기 실패: %v", err)
+	}
+
+	var workers sync.WaitGroup
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		runAIHealthProbe(ctx, cfg.AI.HealthInterval)
+	}()
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		runEmbeddingPrune(ctx, cfg.AI.EmbeddingPruneInterval)
+	}()
+
+	http.HandleFunc("/healthz", handleHealthz)
+	http.HandleFunc("/readyz", handleReadyz)
+	if cfg.Metrics.Enabled {
+		http.Handle(cfg.Metrics.Path, promhttp.Handler())
+	}
+	http.HandleFunc("/auth/logout", rateLimit(handleLogout))
+	http.HandleFunc("/auth/github", rateLimit(handleGitHubLogin))
+	http.HandleFunc("/auth/github/callback", rateLimit(handleGitHubCallback))
 	http.HandleFunc("/api/me", authMiddleware(handleMe))
+	http.HandleFunc("GET /api/me/usage", authMiddleware(handleMyUsage))
 	http.HandleFunc("/api/projects/", authMiddleware(handleProjects))
 	http.HandleFunc("/api/projects/cluster", authMiddleware(handleCluster))
+	http.HandleFunc("POST /api/projects/{id}/cluster/apply", authMiddleware(handleClusterApply))
+	http.HandleFunc("GET /api/projects/{id}/cluster-runs", authMiddleware(handleClusterRuns))
+	http.HandleFunc("POST /api/projects/{id}/cluster-runs/{run}/revert", authMiddleware(handleClusterRunRevert))
+	http.HandleFunc("GET /api/projects/{id}/categories", authMiddleware(handleCategories))
+	http.HandleFunc("PUT /api/projects/{id}/categories/parent", authMiddleware(handleCategoryParent))
+	http.HandleFunc("POST /api/projects/{id}/categories/subcluster", authMiddleware(handleSubcluster))
+	http.HandleFunc("GET /api/projects/{id}/events", authMiddleware(handleProjectEvents))
+	http.HandleFunc("/api/projects/{id}/templates", authMiddleware(handleProjectTemplates))
+	http.HandleFunc("/api/templates/{id}", authMiddleware(handleTemplate))
 	http.HandleFunc("/api/cards/", authMiddleware(handleCards))
+	http.HandleFunc("GET /api/cards/{id}/documents", authMiddleware(handleCardDocuments))
+	http.HandleFunc("GET /api/cards/{id}/related", authMiddleware(handleRelatedCards))
+	http.HandleFunc("POST /api/cards/{id}/retag", authMiddleware(handleCardRetag))
+	http.HandleFunc("GET /api/search/semantic", authMiddleware(handleSemanticSearch))
 	http.HandleFunc("/api/documents/", authMiddleware(handleDocuments))
+	http.HandleFunc("GET /api/documents/{id}/session", authMiddleware(handleDocumentSession))
+	http.HandleFunc("POST /api/documents/{id}/ops", authMiddleware(handleDocumentOps))
+	http.HandleFunc("GET /api/documents/{id}/sources", authMiddleware(handleDocumentSources))
+	http.HandleFunc("GET /api/documents/{id}/sections", authMiddleware(handleDocumentSections))
+	http.HandleFunc("POST /api/documents/{id}/sections/{index}", authMiddleware(handleDocumentSection))
+	http.HandleFunc("POST /api/documents/{id}/expand", authMiddleware(handleDocumentExpand))
+	http.HandleFunc("GET /api/documents/{id}/revisions", authMiddleware(handleDocumentRevisions))
+	http.HandleFunc("GET /api/documents/{id}/revisions/{version}", authMiddleware(handleDocumentRevision))
 
 	// 위에서 등록된 API 경로 외의 모든 요청은 static 디렉토리의 파일을 제공합니다.
 	// 예를 들어, "/" 요청은 "static/index.html"을, "/css/index.css" 요청은 "static/css/index.css" 파일을 반환합니다.
-	http.Handle("/", http.FileServer(http.Dir("./static")))
+	http.Handle("/", rateLimitIP(http.FileServer(http.Dir(cfg.Server.StaticDir)).ServeHTTP))
+
+	srv := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           traceHTTP(requestLogging(instrumentHTTP(http.DefaultServeMux))),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	// 이벤트 구독과 편집 세션(SSE) 연결은 스스로 끝나지 않으므로 종료 시작과 함께 닫습니다.
+	// 편집 세션은 닫으면서 저장하지 않은 내용을 저장합니다.
+	srv.RegisterOnShutdown(projectEvents.close)
+	srv.RegisterOnShutdown(docSessions.close)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("서버 실행 중", "addr", cfg.Server.Addr, "env", cfg.Env)
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("서버 실행 오류", "error", err)
+			os.Exit(1)
+		}
+	case <-ctx.Done():
+		slog.Info("종료 신호를 받았습니다. 진행 중인 요청을 마무리합니다...")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
 
-	fmt.Println("서버가 8080 포트에서 실행 중입니다...")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		log.Fatalf("서버 실행 오류: %v", err)
+	// 새 연결을 받지 않고, 진행 중인 요청(AI 호출 포함)이 끝날 때까지 기다립니다.
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("HTTP 서버 종료 실패", "error", err)
 	}
+	// Shutdown 도중 마지막 요청이 만든 세션까지 DB를 닫기 전에 저장합니다.
+	docSessions.close()
+	if err := jobs.shutdown(shutdownCtx); err != nil {
+		slog.Error("백그라운드 작업 종료 실패", "error", err)
+	}
+	stop()
+	workers.Wait()
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("트레이스 exporter 종료 실패", "error", err)
+	}
+
+	slog.Info("서버가 정상적으로 종료되었습니다.")
 }
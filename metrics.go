@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 라벨에는 사용자 ID나 경로의 숫자 ID처럼 값이 무한히 늘어나는 항목을 넣지 않습니다.
+// HTTP 라우트는 ServeMux에 등록된 패턴("/api/cards/" 등)을 사용합니다.
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "acornhub_http_requests_total",
+		Help: "라우트, 메소드, 상태 코드별 HTTP 요청 수",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "acornhub_http_request_duration_seconds",
+		Help:    "라우트, 메소드별 HTTP 요청 처리 시간",
+		Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"route", "method"})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "acornhub_db_query_duration_seconds",
+		Help:    "SQLite 쿼리 종류(select, insert, update 등)별 실행 시간",
+		Buckets: []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1},
+	}, []string{"operation"})
+
+	dbQueryErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "acornhub_db_query_errors_total",
+		Help: "SQLite 쿼리 종류별 오류 수",
+	}, []string{"operation"})
+
+	aiRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "acornhub_ai_request_duration_seconds",
+		Help:    "AI 서버 엔드포인트별 호출 시간",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 90, 120, 180},
+	}, []string{"endpoint"})
+
+	aiRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "acornhub_ai_requests_total",
+		Help: "AI 서버 엔드포인트별 호출 수 (outcome: success, http_<상태 코드>, error)",
+	}, []string{"endpoint", "outcome"})
+
+	jobsProcessedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "acornhub_jobs_processed_total",
+		Help: "백그라운드 작업 종류별 처리 결과 수",
+	}, []string{"job", "outcome"})
+
+	rateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "acornhub_rate_limited_total",
+		Help: "속도 제한으로 거절(429)한 라우트별 요청 수",
+	}, []string{"route"})
+)
+
+// registerAIBreakerMetrics는 AI 회로 차단기가 열려 있는지(1) 닫혀 있는지(0)를 노출합니다.
+func registerAIBreakerMetrics(b *circuitBreaker) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "acornhub_ai_circuit_open",
+		Help: "AI 서버 회로 차단기 상태 (1: 열림 또는 시험 중, 0: 닫힘)",
+	}, func() float64 {
+		if b.isOpen() {
+			return 1
+		}
+		return 0
+	})
+}
+
+// registerJobQueueMetrics는 작업 큐의 현재 길이를 게이지로 노출합니다.
+func registerJobQueueMetrics(q *jobQueue) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "acornhub_job_queue_depth",
+		Help: "처리를 기다리는 백그라운드 작업 수",
+	}, func() float64 {
+		return float64(q.depth())
+	})
+}
+
+// registerProjectHubMetrics는 프로젝트 이벤트(SSE) 구독 연결 수를 게이지로 노출합니다.
+func registerProjectHubMetrics(h *projectHub) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "acornhub_event_subscribers",
+		Help: "프로젝트 변경 이벤트를 구독 중인 연결 수",
+	}, func() float64 {
+		return float64(h.subscribers())
+	})
+}
+
+// registerDocumentSessionMetrics는 진행 중인 실시간 문서 편집 세션 수를 게이지로 노출합니다.
+func registerDocumentSessionMetrics(m *sessionManager) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "acornhub_document_sessions",
+		Help: "진행 중인 실시간 문서 편집 세션 수",
+	}, func() float64 {
+		return float64(m.sessionCount())
+	})
+}
+
+// registerEmbeddingCacheMetrics는 카드 임베딩 캐시의 크기와 적중·실패 횟수를 노출합니다.
+func registerEmbeddingCacheMetrics(c *embeddingCache) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "acornhub_embedding_cache_entries",
+		Help: "메모리에 보관 중인 카드 임베딩 수",
+	}, func() float64 {
+		return float64(c.size())
+	})
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "acornhub_embedding_cache_hits_total",
+		Help: "AI 서버를 호출하지 않고 캐시에서 찾은 임베딩 수",
+	}, func() float64 {
+		hits, _ := c.stats()
+		return float64(hits)
+	})
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "acornhub_embedding_cache_misses_total",
+		Help: "캐시에 없어 AI 서버에 요청한 임베딩 수",
+	}, func() float64 {
+		_, misses := c.stats()
+		return float64(misses)
+	})
+}
+
+// instrumentHTTP는 요청 수와 처리 시간을 라우트별로 기록합니다.
+func instrumentHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		// ServeMux가 매칭한 패턴을 r.Pattern에 기록합니다.
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route))
+
+		httpRequestsTotal.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		httpRequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+func observeAIRequest(endpoint string, start time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+		if statusErr, ok := err.(*aiStatusError); ok {
+			outcome = "http_" + strconv.Itoa(statusErr.StatusCode)
+		}
+	}
+	aiRequestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	aiRequestsTotal.WithLabelValues(endpoint, outcome).Inc()
+}
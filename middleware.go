@@ -2,47 +2,41 @@ package main
 
 import (
 	"context" 
-	"fmt"
 	"net/http"
-	"os"
-
-	"github.com/golang-jwt/jwt/v5"
 )
 
 type contextKey string
 const userContextKey = contextKey("userID")
 
+// authMiddleware는 인증 전에 IP별로, 인증 후에는 사용자 ID별로 속도를 제한합니다.
+// IP 제한을 먼저 적용해 쿠키가 없거나 위조된 토큰으로 보내는 요청도 버킷을 거치게 합니다.
 func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+	return rateLimitIP(func(w http.ResponseWriter, r *http.Request) {
 		
 		cookie, err := r.Cookie("auth_token")
 		if err != nil {
 			if err == http.ErrNoCookie {
-				http.Error(w, "인증이 필요합니다.", http.StatusUnauthorized)
+				httpError(w, r, "인증이 필요합니다.", http.StatusUnauthorized)
 				return
 			}
-			http.Error(w, "잘못된 요청입니다.", http.StatusBadRequest)
+			httpError(w, r, "잘못된 요청입니다.", http.StatusBadRequest)
 			return
 		}
 
 		tokenString := cookie.Value
 		claims := &jwtClaims{} 
-		jwtKey := []byte(os.Getenv("JWT_SECRET_KEY"))
-
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("예상치 못한 서명 알고리즘: %v", token.Header["alg"])
-			}
-			return jwtKey, nil 
-		})
 
-		if err != nil || !token.Valid {
-			http.Error(w, "인증이 유효하지 않습니다.", http.StatusUnauthorized)
+		if err := jwtKeys.parse(tokenString, claims); err != nil {
+			httpError(w, r, "인증이 유효하지 않습니다.", http.StatusUnauthorized)
 			return
 		}
 
+		if info := requestInfoFrom(r.Context()); info != nil {
+			info.UserID = claims.UserID
+		}
+
 		ctx := context.WithValue(r.Context(), userContextKey, claims.UserID)
 		
-		next.ServeHTTP(w, r.WithContext(ctx))
-	}
+		rateLimit(next).ServeHTTP(w, r.WithContext(ctx))
+	})
 }
\ No newline at end of file
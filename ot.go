@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// textOp는 문서 전체를 처음부터 끝까지 훑는 편집 연산(operational transformation)입니다.
+// JSON 표현은 ot.js와 같습니다: 양수는 retain(그대로 두기), 문자열은 insert, 음수는 delete.
+// 예: [5, "abc", -2, 10]은 5글자를 두고 "abc"를 넣은 뒤 2글자를 지우고 나머지 10글자를 둡니다.
+//
+// 길이와 위치는 유니코드 코드 포인트(Go의 rune, JS의 Array.from) 단위입니다.
+type textOp []opComponent
+
+// opComponent는 Retain, Insert, Delete 중 하나만 값을 가집니다.
+type opComponent struct {
+	Retain int
+	Insert string
+	Delete int
+}
+
+func (c opComponent) insertLen() int {
+	return utf8.RuneCountInString(c.Insert)
+}
+
+func (op textOp) MarshalJSON() ([]byte, error) {
+	out := make([]interface{}, 0, len(op))
+	for _, c := range op {
+		switch {
+		case c.Retain > 0:
+			out = append(out, c.Retain)
+		case c.Insert != "":
+			out = append(out, c.Insert)
+		case c.Delete > 0:
+			out = append(out, -c.Delete)
+		}
+	}
+	return json.Marshal(out)
+}
+
+func (op *textOp) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var result textOp
+	for _, item := range raw {
+		var n int
+		if err := json.Unmarshal(item, &n); err == nil {
+			switch {
+			case n > 0:
+				result = result.retain(n)
+			case n < 0:
+				result = result.delete(-n)
+			default:
+				return errors.New("연산에 0은 사용할 수 없습니다")
+			}
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(item, &s); err != nil || s == "" {
+			return fmt.Errorf("잘못된 연산 요소: %s", item)
+		}
+		result = result.insert(s)
+	}
+	*op = result
+	return nil
+}
+
+// retain, insert, delete는 연산 끝에 요소를 붙이면서 인접한 같은 종류를 합칩니다.
+// insert와 delete가 이어지면 항상 insert를 앞에 두어 같은 편집이 하나의 표현만 갖게 합니다.
+func (op textOp) retain(n int) textOp {
+	if n <= 0 {
+		return op
+	}
+	if last := len(op) - 1; last >= 0 && op[last].Retain > 0 {
+		op[last].Retain += n
+		return op
+	}
+	return append(op, opComponent{Retain: n})
+}
+
+func (op textOp) insert(s string) textOp {
+	if s == "" {
+		return op
+	}
+	last := len(op) - 1
+	switch {
+	case last >= 0 && op[last].Insert != "":
+		op[last].Insert += s
+		return op
+	case last >= 0 && op[last].Delete > 0:
+		if last >= 1 && op[last-1].Insert != "" {
+			op[last-1].Insert += s
+			return op
+		}
+		del := op[last]
+		op[last] = opComponent{Insert: s}
+		return append(op, del)
+	default:
+		return append(op, opComponent{Insert: s})
+	}
+}
+
+func (op textOp) delete(n int) textOp {
+	if n <= 0 {
+		return op
+	}
+	if last := len(op) - 1; last >= 0 && op[last].Delete > 0 {
+		op[last].Delete += n
+		return op
+	}
+	return append(op, opComponent{Delete: n})
+}
+
+// baseLen은 연산을 적용할 수 있는 문서의 길이입니다.
+func (op textOp) baseLen() int {
+	n := 0
+	for _, c := range op {
+		n += c.Retain + c.Delete
+	}
+	return n
+}
+
+// targetLen은 연산을 적용한 뒤 문서의 길이입니다.
+func (op textOp) targetLen() int {
+	n := 0
+	for _, c := range op {
+		n += c.Retain + c.insertLen()
+	}
+	return n
+}
+
+// apply는 doc에 연산을 적용한 새 문서를 반환합니다.
+func (op textOp) apply(doc []rune) ([]rune, error) {
+	if op.baseLen() != len(doc) {
+		return nil, fmt.Errorf("연산 길이(%d)가 문서 길이(%d)와 다릅니다", op.baseLen(), len(doc))
+	}
+	out := make([]rune, 0, op.targetLen())
+	pos := 0
+	for _, c := range op {
+		switch {
+		case c.Retain > 0:
+			out = append(out, doc[pos:pos+c.Retain]...)
+			pos += c.Retain
+		case c.Insert != "":
+			out = append(out, []rune(c.Insert)...)
+		case c.Delete > 0:
+			pos += c.Delete
+		}
+	}
+	return out, nil
+}
+
+// transformOps는 같은 문서에 동시에 만들어진 a와 b를 받아
+// apply(apply(doc, a), b') == apply(apply(doc, b), a')가 되는 (a', b')를 반환합니다.
+// 같은 위치에 동시에 삽입하면 a의 삽입이 앞에 옵니다.
+func transformOps(a, b textOp) (textOp, textOp, error) {
+	if a.baseLen() != b.baseLen() {
+		return nil, nil, fmt.Errorf("동시 연산의 기준 길이가 다릅니다 (%d, %d)", a.baseLen(), b.baseLen())
+	}
+
+	var aPrime, bPrime textOp
+	i, j := 0, 0
+	var c1, c2 *opComponent
+	next := func(op textOp, idx *int) *opComponent {
+		if *idx >= len(op) {
+			return nil
+		}
+		c := op[*idx]
+		*idx++
+		return &c
+	}
+	c1, c2 = next(a, &i), next(b, &j)
+
+	for c1 != nil || c2 != nil {
+		if c1 != nil && c1.Insert != "" {
+			aPrime = aPrime.insert(c1.Insert)
+			bPrime = bPrime.retain(c1.insertLen())
+			c1 = next(a, &i)
+			continue
+		}
+		if c2 != nil && c2.Insert != "" {
+			aPrime = aPrime.retain(c2.insertLen())
+			bPrime = bPrime.insert(c2.Insert)
+			c2 = next(b, &j)
+			continue
+		}
+		if c1 == nil || c2 == nil {
+			return nil, nil, errors.New("연산 길이가 맞지 않습니다")
+		}
+
+		n1, n2 := c1.Retain+c1.Delete, c2.Retain+c2.Delete
+		n := min(n1, n2)
+		switch {
+		case c1.Retain > 0 && c2.Retain > 0:
+			aPrime = aPrime.retain(n)
+			bPrime = bPrime.retain(n)
+		case c1.Delete > 0 && c2.Retain > 0:
+			aPrime = aPrime.delete(n)
+		case c1.Retain > 0 && c2.Delete > 0:
+			bPrime = bPrime.delete(n)
+		}
+		// 둘 다 delete이면 이미 지워진 부분이므로 어느 쪽에도 남기지 않습니다.
+
+		c1 = shrink(c1, n, func() *opComponent { return next(a, &i) })
+		c2 = shrink(c2, n, func() *opComponent { return next(b, &j) })
+	}
+	return aPrime, bPrime, nil
+}
+
+// shrink는 retain/delete 요소에서 n만큼 소비하고, 다 쓰면 다음 요소를 반환합니다.
+func shrink(c *opComponent, n int, next func() *opComponent) *opComponent {
+	if c.Retain > 0 {
+		c.Retain -= n
+		if c.Retain > 0 {
+			return c
+		}
+	} else {
+		c.Delete -= n
+		if c.Delete > 0 {
+			return c
+		}
+	}
+	return next()
+}
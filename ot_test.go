@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func mustOp(t *testing.T, s string) textOp {
+	t.Helper()
+	var op textOp
+	if err := json.Unmarshal([]byte(s), &op); err != nil {
+		t.Fatalf("연산 %s 파싱 실패: %v", s, err)
+	}
+	return op
+}
+
+func applyString(t *testing.T, op textOp, doc string) string {
+	t.Helper()
+	out, err := op.apply([]rune(doc))
+	if err != nil {
+		t.Fatalf("연산 %v 적용 실패: %v", op, err)
+	}
+	return string(out)
+}
+
+func TestTransformOpsConverges(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		a, b string
+		want string
+	}{
+		{"같은 위치 삽입은 a가 앞", "abcdef", `[2, "X", 4]`, `[2, "Y", 4]`, "abXYcdef"},
+		{"문서 끝 삽입", "abcdef", `[6, "!"]`, `[6, "?"]`, "abcdef!?"},
+		{"겹치는 삭제", "abcdef", `[1, -3, 2]`, `[2, -3, 1]`, "af"},
+		{"같은 범위 삭제", "abcdef", `[-6]`, `[-6]`, ""},
+		{"삭제 범위 안에 삽입", "abcdef", `[1, -3, 2]`, `[2, "Z", 4]`, "aZef"},
+		{"삭제와 삽입이 떨어져 있음", "abcdef", `[-2, 4]`, `[5, "Z", 1]`, "cdeZf"},
+		{"retain만 있는 연산", "abcdef", `[6]`, `["<", 6, ">"]`, "<abcdef>"},
+		{"빈 문서에 동시 삽입", "", `["a"]`, `["b"]`, "ab"},
+		{"멀티바이트 문자", "가나다", `[1, "😀", 2]`, `[-1, 1, "라", 1]`, "😀나라다"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := mustOp(t, tt.a), mustOp(t, tt.b)
+			aPrime, bPrime, err := transformOps(a, b)
+			if err != nil {
+				t.Fatalf("transformOps 실패: %v", err)
+			}
+			left := applyString(t, bPrime, applyString(t, a, tt.doc))
+			right := applyString(t, aPrime, applyString(t, b, tt.doc))
+			if left != right {
+				t.Fatalf("수렴하지 않습니다: apply(a, b')=%q, apply(b, a')=%q", left, right)
+			}
+			if left != tt.want {
+				t.Errorf("결과 = %q, want %q", left, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformOpsRejectsMismatchedLengths(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"기준 길이가 다름", `[3]`, `[4]`},
+		{"삭제가 문서보다 김", `[-5]`, `[2, "x", 1]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := transformOps(mustOp(t, tt.a), mustOp(t, tt.b)); err == nil {
+				t.Errorf("transformOps(%s, %s)에 오류가 없습니다", tt.a, tt.b)
+			}
+		})
+	}
+}
+
+func TestApplyRejectsOutOfRange(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		op   string
+	}{
+		{"retain이 문서보다 김", "abc", `[10]`},
+		{"delete가 문서보다 김", "abc", `[1, -5]`},
+		{"문서를 다 덮지 않음", "abcdef", `[2, "x"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := mustOp(t, tt.op).apply([]rune(tt.doc)); err == nil {
+				t.Errorf("%s를 %q에 적용했는데 오류가 없습니다", tt.op, tt.doc)
+			}
+		})
+	}
+}
+
+func TestTextOpJSON(t *testing.T) {
+	op := mustOp(t, `[2, -1, "ab", 3]`)
+	data, err := json.Marshal(op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// insert와 delete가 이어지면 insert가 앞에 옵니다.
+	if got, want := string(data), `[2,"ab",-1,3]`; got != want {
+		t.Errorf("JSON = %s, want %s", got, want)
+	}
+
+	for _, bad := range []string{`[0]`, `[""]`, `[true]`, `{}`} {
+		var op textOp
+		if err := json.Unmarshal([]byte(bad), &op); err == nil {
+			t.Errorf("%s 파싱에 오류가 없습니다", bad)
+		}
+	}
+}
@@ -19,7 +19,7 @@ type Project struct {
 func handleProjects(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(userContextKey).(int64)
 	if !ok {
-		http.Error(w, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
 		return
 	}
 
@@ -32,19 +32,19 @@ func handleProjects(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method == "POST" {
 		if r.Header.Get("Content-Type") != "application/json" {
-			http.Error(w, "잘못된 요청: Content-Type이 application/json이 아님", http.StatusBadRequest)
+			httpError(w, r, "잘못된 요청: Content-Type이 application/json이 아님", http.StatusBadRequest)
 			return
 		}
 
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, "요청 본문 읽기 실패", http.StatusInternalServerError)
+			httpError(w, r, "요청 본문 읽기 실패", http.StatusInternalServerError)
 			return
 		}
 
 		var project Project
 		if err := json.Unmarshal(body, &project); err != nil {
-			http.Error(w, "잘못된 JSON 형식", http.StatusBadRequest)
+			httpError(w, r, "잘못된 JSON 형식", http.StatusBadRequest)
 			return
 		}
 
@@ -55,13 +55,13 @@ func handleProjects(w http.ResponseWriter, r *http.Request) {
 			project.Name, project.Desc, project.Userid,
 		)
 		if err != nil {
-			http.Error(w, "프로젝트 생성 실패", http.StatusInternalServerError)
+			httpError(w, r, "프로젝트 생성 실패", http.StatusInternalServerError)
 			return
 		}
 
 		projectID, err := result.LastInsertId()
 		if err != nil {
-			http.Error(w, "프로젝트 ID 가져오기 실패", http.StatusInternalServerError)
+			httpError(w, r, "프로젝트 ID 가져오기 실패", http.StatusInternalServerError)
 			return
 		}
 		project.Projectid = projectID
@@ -69,7 +69,7 @@ func handleProjects(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		if err := json.NewEncoder(w).Encode(project); err != nil {
-			http.Error(w, "응답 인코딩 실패", http.StatusInternalServerError)
+			httpError(w, r, "응답 인코딩 실패", http.StatusInternalServerError)
 			return
 		}
 
@@ -78,7 +78,7 @@ func handleProjects(w http.ResponseWriter, r *http.Request) {
 			// GET /api/projects/{id} - 특정 프로젝트 조회
 			projectID, err := strconv.ParseInt(idFromPath, 10, 64)
 			if err != nil {
-				http.Error(w, "잘못된 id 경로", http.StatusBadRequest)
+				httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
 				return
 			}
 
@@ -87,16 +87,16 @@ func handleProjects(w http.ResponseWriter, r *http.Request) {
 			err = db.QueryRow(query, projectID, userID).Scan(&p.Projectid, &p.Name, &p.Desc, &p.Userid)
 			if err != nil {
 				if err == sql.ErrNoRows {
-					http.Error(w, "프로젝트를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+					httpError(w, r, "프로젝트를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
 				} else {
-					http.Error(w, "DB 조회 실패", http.StatusInternalServerError)
+					httpError(w, r, "DB 조회 실패", http.StatusInternalServerError)
 				}
 				return
 			}
 
 			w.Header().Set("Content-Type", "application/json")
 			if err := json.NewEncoder(w).Encode(p); err != nil {
-				http.Error(w, "응답 인코딩 실패", http.StatusInternalServerError)
+				httpError(w, r, "응답 인코딩 실패", http.StatusInternalServerError)
 			}
 			return
 		}
@@ -121,7 +121,7 @@ func handleProjects(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if err != nil {
-			http.Error(w, "프로젝트 목록 조회 실패", http.StatusInternalServerError)
+			httpError(w, r, "프로젝트 목록 조회 실패", http.StatusInternalServerError)
 			return
 		}
 		defer rows.Close()
@@ -130,7 +130,7 @@ func handleProjects(w http.ResponseWriter, r *http.Request) {
 		for rows.Next() {
 			var p Project
 			if err := rows.Scan(&p.Projectid, &p.Name, &p.Desc, &p.Userid); err != nil {
-				http.Error(w, "DB 스캔 실패", http.StatusInternalServerError)
+				httpError(w, r, "DB 스캔 실패", http.StatusInternalServerError)
 				return
 			}
 			list = append(list, p)
@@ -138,7 +138,7 @@ func handleProjects(w http.ResponseWriter, r *http.Request) {
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(list); err != nil {
-			http.Error(w, "응답 인코딩 실패", http.StatusInternalServerError)
+			httpError(w, r, "응답 인코딩 실패", http.StatusInternalServerError)
 			return
 		}
 
@@ -148,7 +148,7 @@ func handleProjects(w http.ResponseWriter, r *http.Request) {
 		if idFromPath != "" {
 			id64, err := strconv.ParseInt(idFromPath, 10, 64)
 			if err != nil {
-				http.Error(w, "잘못된 id 경로", http.StatusBadRequest)
+				httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
 				return
 			}
 			targetID = id64
@@ -156,14 +156,14 @@ func handleProjects(w http.ResponseWriter, r *http.Request) {
 			// fallback to JSON body
 			body, err := io.ReadAll(r.Body)
 			if err != nil {
-				http.Error(w, "요청 본문 읽기 실패", http.StatusInternalServerError)
+				httpError(w, r, "요청 본문 읽기 실패", http.StatusInternalServerError)
 				return
 			}
 			var reqData struct {
 				Projectid int64 `json:"projectid"`
 			}
 			if err := json.Unmarshal(body, &reqData); err != nil {
-				http.Error(w, "잘못된 JSON 형식", http.StatusBadRequest)
+				httpError(w, r, "잘못된 JSON 형식", http.StatusBadRequest)
 				return
 			}
 			targetID = reqData.Projectid
@@ -174,17 +174,17 @@ func handleProjects(w http.ResponseWriter, r *http.Request) {
 			targetID, userID,
 		)
 		if err != nil {
-			http.Error(w, "프로젝트 삭제 실패", http.StatusInternalServerError)
+			httpError(w, r, "프로젝트 삭제 실패", http.StatusInternalServerError)
 			return
 		}
 
 		rowsAffected, err := result.RowsAffected()
 		if err != nil {
-			http.Error(w, "삭제된 행 수 가져오기 실패", http.StatusInternalServerError)
+			httpError(w, r, "삭제된 행 수 가져오기 실패", http.StatusInternalServerError)
 			return
 		}
 		if rowsAffected == 0 {
-			http.Error(w, "프로젝트를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+			httpError(w, r, "프로젝트를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
 			return
 		}
 
@@ -193,29 +193,29 @@ func handleProjects(w http.ResponseWriter, r *http.Request) {
 	} else if r.Method == "PUT" {
 		// require id in path for PUT
 		if idFromPath == "" {
-			http.Error(w, "경로에 id가 필요합니다", http.StatusBadRequest)
+			httpError(w, r, "경로에 id가 필요합니다", http.StatusBadRequest)
 			return
 		}
 		id64, err := strconv.ParseInt(idFromPath, 10, 64)
 		if err != nil {
-			http.Error(w, "잘못된 id 경로", http.StatusBadRequest)
+			httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
 			return
 		}
 
 		if r.Header.Get("Content-Type") != "application/json" {
-			http.Error(w, "잘못된 요청: Content-Type이 application/json이 아님", http.StatusBadRequest)
+			httpError(w, r, "잘못된 요청: Content-Type이 application/json이 아님", http.StatusBadRequest)
 			return
 		}
 
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, "요청 본문 읽기 실패", http.StatusInternalServerError)
+			httpError(w, r, "요청 본문 읽기 실패", http.StatusInternalServerError)
 			return
 		}
 
 		var project Project
 		if err := json.Unmarshal(body, &project); err != nil {
-			http.Error(w, "잘못된 JSON 형식", http.StatusBadRequest)
+			httpError(w, r, "잘못된 JSON 형식", http.StatusBadRequest)
 			return
 		}
 
@@ -224,17 +224,17 @@ func handleProjects(w http.ResponseWriter, r *http.Request) {
 			project.Name, project.Desc, id64, userID,
 		)
 		if err != nil {
-			http.Error(w, "프로젝트 수정 실패", http.StatusInternalServerError)
+			httpError(w, r, "프로젝트 수정 실패", http.StatusInternalServerError)
 			return
 		}
 
 		rowsAffected, err := result.RowsAffected()
 		if err != nil {
-			http.Error(w, "수정된 행 수 가져오기 실패", http.StatusInternalServerError)
+			httpError(w, r, "수정된 행 수 가져오기 실패", http.StatusInternalServerError)
 			return
 		}
 		if rowsAffected == 0 {
-			http.Error(w, "프로젝트를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+			httpError(w, r, "프로젝트를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
 			return
 		}
 
@@ -242,7 +242,7 @@ func handleProjects(w http.ResponseWriter, r *http.Request) {
 		project.Userid = userID
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(project); err != nil {
-			http.Error(w, "응답 인코딩 실패", http.StatusInternalServerError)
+			httpError(w, r, "응답 인코딩 실패", http.StatusInternalServerError)
 			return
 		}
 	}
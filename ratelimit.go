@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// 요청 속도 제한
+//
+// 클라이언트마다 라우트별 토큰 버킷(golang.org/x/time/rate)을 두고, 버킷이 비면 429와 Retry-After로 응답합니다.
+// 클라이언트는 authMiddleware를 거친 요청이면 사용자 ID, 아니면 IP로 구분합니다.
+// 한도는 rate_limit.routes에서 ServeMux에 등록된 패턴(r.Pattern)으로 찾고, 없으면 rate_limit.rate/burst를 씁니다.
+// 인증 전에는 rateLimitIP가 라우트와 관계없이 IP마다 버킷 하나(rate_limit.ip_rate/ip_burst)로 한 번 더 제한합니다.
+// 모든 응답에는 X-RateLimit-Limit(버킷 크기)과 X-RateLimit-Remaining(남은 요청 수) 헤더를 붙입니다.
+//
+// 버킷은 서버 프로세스 메모리에 있으므로 서버를 여러 대로 실행하면 서버마다 따로 셉니다.
+
+// rateLimitSweepInterval마다 가득 찬(오래 쓰지 않은) 버킷을 지웁니다. 가득 찬 버킷은 새로 만든 것과 같습니다.
+const rateLimitSweepInterval = time.Minute
+
+// rateLimits는 모든 라우트가 공유하는 속도 제한기입니다. main에서 설정을 읽은 뒤 만듭니다.
+var rateLimits *rateLimiter
+
+type rateLimiter struct {
+	cfg ThrottleConfig
+
+	mu        sync.Mutex
+	buckets   map[string]*rate.Limiter
+	lastSweep time.Time
+}
+
+func newRateLimiter(c ThrottleConfig) *rateLimiter {
+	return &rateLimiter{cfg: c, buckets: make(map[string]*rate.Limiter), lastSweep: time.Now()}
+}
+
+// rule은 요청 라우트의 한도와 버킷 이름을 반환합니다.
+// 메소드 없이 등록된 패턴은 "메소드 패턴" 설정을 먼저 찾습니다.
+func (l *rateLimiter) rule(r *http.Request) (string, RateLimitRule) {
+	route := r.Pattern
+	if route != "" && !strings.Contains(route, " ") {
+		if rule, ok := l.cfg.Routes[r.Method+" "+route]; ok {
+			return r.Method + " " + route, rule
+		}
+	}
+	if rule, ok := l.cfg.Routes[route]; ok {
+		return route, rule
+	}
+	return route, RateLimitRule{Rate: l.cfg.Rate, Burst: l.cfg.Burst}
+}
+
+// take는 key 버킷에서 요청 하나를 꺼냅니다. 버킷이 비었으면 다음 요청이 가능할 때까지의 시간을 반환합니다.
+func (l *rateLimiter) take(key string, rule RateLimitRule) (ok bool, remaining int, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		for k, b := range l.buckets {
+			if b.TokensAt(now) >= float64(b.Burst()) {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = rate.NewLimiter(rate.Limit(rule.Rate), rule.Burst)
+		l.buckets[key] = b
+	}
+	reservation := b.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, 0, delay
+	}
+	return true, int(b.TokensAt(now)), 0
+}
+
+// rateLimit은 next를 요청 속도 제한으로 감쌉니다.
+// 사용자 ID를 쓰려면 authMiddleware 안쪽(사용자 ID를 채운 뒤)에서 호출해야 합니다.
+func rateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rateLimits == nil || !rateLimits.cfg.Enabled {
+			next(w, r)
+			return
+		}
+		route, rule := rateLimits.rule(r)
+		if rule.Rate == 0 {
+			next(w, r)
+			return
+		}
+
+		client := "ip:" + clientIP(r, rateLimits.cfg.TrustProxy)
+		if info := requestInfoFrom(r.Context()); info != nil && info.UserID != 0 {
+			client = "user:" + strconv.FormatInt(info.UserID, 10)
+		}
+		if rateLimits.admit(w, r, route, route+"|"+client, rule) {
+			next(w, r)
+		}
+	}
+}
+
+// rateLimitIP는 next를 인증 전 IP별 속도 제한으로 감쌉니다. 모든 라우트가 IP 하나의 버킷을 함께 씁니다.
+func rateLimitIP(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rateLimits == nil || !rateLimits.cfg.Enabled || rateLimits.cfg.IPRate == 0 {
+			next(w, r)
+			return
+		}
+		rule := RateLimitRule{Rate: rateLimits.cfg.IPRate, Burst: rateLimits.cfg.IPBurst}
+		if rateLimits.admit(w, r, r.Pattern, "ip|"+clientIP(r, rateLimits.cfg.TrustProxy), rule) {
+			next(w, r)
+		}
+	}
+}
+
+// admit은 key 버킷에서 요청 하나를 꺼내고 속도 제한 헤더를 붙입니다.
+// 버킷이 비었으면 429 응답을 쓰고 false를 반환합니다.
+func (l *rateLimiter) admit(w http.ResponseWriter, r *http.Request, route, key string, rule RateLimitRule) bool {
+	ok, remaining, retryAfter := l.take(key, rule)
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rule.Burst))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	if !ok {
+		rateLimitedTotal.WithLabelValues(route).Inc()
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		httpError(w, r, "요청이 너무 많습니다. 잠시 후 다시 시도해주세요.", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// clientIP는 요청을 보낸 클라이언트의 IP입니다. trustProxy면 X-Forwarded-For의 첫 주소를 씁니다.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			if ip := strings.TrimSpace(first); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func validRateLimit(name string, rule RateLimitRule) error {
+	if rule.Rate < 0 || (rule.Rate > 0 && rule.Burst < 1) {
+		return fmt.Errorf("%s: rate는 0 이상, rate가 0보다 크면 burst는 1 이상이어야 합니다 (rate=%v, burst=%d)", name, rule.Rate, rule.Burst)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// 문서 렌더링
+//
+// 문서 content는 LLM이나 사용자가 쓴 그대로 저장하고, 문서 하나를 조회할 때 서버에서 안전한 HTML로 바꿔
+// content_html로 함께 보냅니다. Markdown 문서는 goldmark로 HTML을 만든 뒤(표, 각주, 코드, 수식),
+// AI가 HTML로 쓴 문서는 그대로 bluemonday로 허용한 태그와 속성만 남깁니다.
+// 수식($...$, $$...$$)은 <span class="math math-inline">\(...\)</span> 형태로 남겨 브라우저에서 KaTeX 등으로 그립니다.
+
+// tocEntry는 문서 목차 항목입니다. ID는 content_html의 제목 요소 id입니다.
+type tocEntry struct {
+	Level int    `json:"level"`
+	Title string `json:"title"`
+	ID    string `json:"id"`
+}
+
+type renderedContent struct {
+	HTML string
+	TOC  []tocEntry
+}
+
+var (
+	markdownRenderer = goldmark.New(
+		goldmark.WithExtensions(
+			extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+			extension.Strikethrough,
+			extension.Linkify,
+			extension.TaskList,
+			extension.Footnote,
+			mathExtension{},
+		),
+		// 원본의 HTML은 그대로 두고 아래 sanitizer가 거릅니다. [card:ID]에서 만든 인용 표시(<sup class="citation">)도 HTML입니다.
+		goldmark.WithRendererOptions(goldmarkhtml.WithUnsafe()),
+	)
+	documentPolicy = newDocumentPolicy()
+
+	citationSup = regexp.MustCompile(`(?is)<sup class="citation"[^>]*>.*?</sup>`)
+)
+
+// newDocumentPolicy는 사용자 작성 콘텐츠 정책에 인용 표시, 각주, 수식, 체크박스 목록에 필요한 속성만 더합니다.
+// 제목의 id는 허용하지 않고 renderContent가 목차용으로 다시 붙입니다.
+func newDocumentPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^citation$`)).OnElements("sup")
+	p.AllowAttrs("data-card-id").Matching(regexp.MustCompile(`^\d+$`)).OnElements("sup")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^math math-(inline|display)$`)).OnElements("span")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^footnote-(ref|backref)$`)).OnElements("a")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^footnotes$`)).OnElements("div")
+	p.AllowAttrs("role").Matching(regexp.MustCompile(`^doc-(noteref|backlink|endnotes)$`)).OnElements("a", "div")
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^fn(ref\d*)?:[\w-]+$`)).OnElements("sup", "li")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").Matching(regexp.MustCompile(`^$`)).OnElements("input")
+	return p
+}
+
+// renderContent는 문서 본문을 안전한 HTML과 목차로 바꿉니다.
+// 본문의 [card:ID] 표시는 ordinals의 인용 번호를 단 <sup class="citation">으로 바꿉니다.
+func renderContent(content string, ordinals map[int64]int) renderedContent {
+	// 인용 표시를 HTML로 바꾸기 전에 형식을 정합니다.
+	format := detectDocumentFormat(content)
+	content = citationSups(content, ordinals)
+	source := content
+	if format == documentFormatMarkdown {
+		var buf bytes.Buffer
+		if err := markdownRenderer.Convert([]byte(content), &buf); err != nil {
+			// goldmark는 io.Writer 오류 외에는 실패하지 않지만, 실패하면 원문을 이스케이프해 보여 줍니다.
+			slog.Error("Markdown 렌더링 실패", "error", err)
+			source = "<pre>" + html.EscapeString(content) + "</pre>"
+		} else {
+			source = buf.String()
+		}
+	}
+	return addHeadingIDs(documentPolicy.Sanitize(source))
+}
+
+// addHeadingIDs는 정리된 HTML의 제목에 section-N id를 붙이고 목차를 만듭니다.
+func addHeadingIDs(sanitized string) renderedContent {
+	toc := []tocEntry{}
+	out := htmlHeading.ReplaceAllStringFunc(sanitized, func(h string) string {
+		m := htmlHeading.FindStringSubmatch(h)
+		level := int(m[1][0] - '0')
+		title := citationSup.ReplaceAllString(m[2], "")
+		title = strings.TrimSpace(html.UnescapeString(htmlTag.ReplaceAllString(title, "")))
+		id := fmt.Sprintf("section-%d", len(toc))
+		toc = append(toc, tocEntry{Level: level, Title: title, ID: id})
+		return fmt.Sprintf(`<h%d id="%s">%s</h%d>`, level, id, m[2], level)
+	})
+	return renderedContent{HTML: out, TOC: toc}
+}
+
+// renderedDocument는 문서 하나를 조회할 때의 응답입니다. 원문 content와 함께 렌더링한 content_html과 목차 toc를 넣습니다.
+// 렌더링은 비싸므로 목록과 이벤트에는 쓰지 않습니다.
+type renderedDocument struct {
+	Document
+	ContentHTML string     `json:"content_html"`
+	TOC         []tocEntry `json:"toc"`
+}
+
+func newRenderedDocument(ctx context.Context, d Document) renderedDocument {
+	ordinals, err := documentCitationOrdinals(ctx, d.ID)
+	if err != nil {
+		// 번호를 읽지 못해도 본문은 보여 주고, 인용 번호는 본문에 나온 순서로 매깁니다.
+		slog.Warn("인용 번호 조회 실패", "request_id", requestIDFrom(ctx), "document_id", d.ID, "error", err)
+	}
+	rendered := renderContent(d.Content, ordinals)
+	return renderedDocument{Document: d, ContentHTML: rendered.HTML, TOC: rendered.TOC}
+}
+
+// 수식: $...$(한 줄 안)은 인라인, $$...$$(여러 줄 가능)은 별행 수식입니다.
+// "$5 and $10"처럼 금액을 쓴 경우는 수식으로 보지 않도록 여는 $ 뒤와 닫는 $ 앞에 공백이 없고
+// 닫는 $ 뒤에 숫자가 오지 않을 때만 인라인 수식으로 보며, 그 전에 닫을 수 없는 $가 나오면 수식이 아닙니다.
+var kindMath = ast.NewNodeKind("Math")
+
+type mathNode struct {
+	ast.BaseInline
+	display bool
+	tex     []byte
+}
+
+func (n *mathNode) Kind() ast.NodeKind { return kindMath }
+
+func (n *mathNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"TeX": string(n.tex)}, nil)
+}
+
+type mathParser struct{}
+
+func (mathParser) Trigger() []byte { return []byte{'$'} }
+
+func (mathParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if len(line) > 1 && line[1] == '$' {
+		return parseDisplayMath(block)
+	}
+	if len(line) < 3 || line[1] == ' ' {
+		return nil
+	}
+	for i := 2; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '$':
+			// 닫을 수 없는 $가 먼저 나오면 여는 $도 수식이 아닌 것으로 봅니다 ("$5 and $10").
+			if line[i-1] == ' ' || (i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '9') {
+				return nil
+			}
+			node := &mathNode{tex: append([]byte(nil), line[1:i]...)}
+			block.Advance(i + 1)
+			return node
+		}
+	}
+	return nil
+}
+
+func parseDisplayMath(block text.Reader) ast.Node {
+	block.Advance(2)
+	var tex bytes.Buffer
+	for {
+		line, _ := block.PeekLine()
+		if line == nil {
+			return nil
+		}
+		if i := bytes.Index(line, []byte("$$")); i >= 0 {
+			tex.Write(line[:i])
+			block.Advance(i + 2)
+			if bytes.TrimSpace(tex.Bytes()) == nil {
+				return nil
+			}
+			return &mathNode{display: true, tex: bytes.TrimSpace(tex.Bytes())}
+		}
+		tex.Write(line)
+		block.AdvanceLine()
+	}
+}
+
+type mathRenderer struct{}
+
+func (mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMath, func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		n := node.(*mathNode)
+		if n.display {
+			fmt.Fprintf(w, `<span class="math math-display">\[%s\]</span>`, html.EscapeString(string(n.tex)))
+		} else {
+			fmt.Fprintf(w, `<span class="math math-inline">\(%s\)</span>`, html.EscapeString(string(n.tex)))
+		}
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+type mathExtension struct{}
+
+func (mathExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(mathParser{}, 150)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(mathRenderer{}, 150)))
+}
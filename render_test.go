@@ -0,0 +1,136 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectDocumentFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"Markdown 제목", "# 제목\n\n본문", documentFormatMarkdown},
+		{"HTML 제목", "<h2>제목</h2><p>본문</p>", documentFormatHTML},
+		{"제목 없는 HTML 블록", "  <p>본문</p>", documentFormatHTML},
+		{"제목 없는 Markdown의 부등호", "- item\n- if x < 3 and y > 2\n\n| a | b |\n|---|---|\n| 1 | 2 |", documentFormatMarkdown},
+		{"제목 없는 Markdown의 인라인 태그", "**bold** line<br>next", documentFormatMarkdown},
+		{"인용 표시만 있는 본문", "본문 [card:5]", documentFormatMarkdown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectDocumentFormat(tt.content); got != tt.want {
+				t.Errorf("detectDocumentFormat(%q) = %s, want %s", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		contains []string
+		excludes []string
+	}{
+		{
+			"제목 없는 Markdown 목록과 표",
+			"- item\n- if x < 3 and y > 2\n\n| a | b |\n|---|---|\n| 1 | 2 |",
+			[]string{"<li>if x &lt; 3 and y &gt; 2</li>", "<th>a</th>", "<td>2</td>"},
+			[]string{"| a |"},
+		},
+		{
+			"Markdown 안의 <br>",
+			"**bold** line<br>next",
+			[]string{"<strong>bold</strong>", "<br>"},
+			[]string{"**"},
+		},
+		{
+			"스크립트와 이벤트 속성 제거",
+			`<p>hi<script>alert(1)</script><img src="x" onerror="alert(1)"><a href="javascript:alert(1)">x</a></p>`,
+			[]string{"<p>hi", `<img src="x">`},
+			[]string{"<script", "alert(1)", "onerror", "javascript:"},
+		},
+		{
+			"Markdown 링크의 javascript: 제거",
+			"[x](javascript:alert(1))",
+			[]string{"x"},
+			[]string{"javascript:"},
+		},
+		{
+			"인용 표시",
+			"본문 [card:5] 그리고 [card:9]",
+			[]string{
+				`<sup class="citation" data-card-id="5">[2]</sup>`,
+				`<sup class="citation" data-card-id="9">[3]</sup>`,
+			},
+			[]string{"[card:"},
+		},
+		{
+			"금액은 수식이 아님",
+			"가격은 $5 and $10 입니다",
+			[]string{"$5 and $10"},
+			[]string{"math"},
+		},
+		{
+			"인라인과 별행 수식",
+			"수식 $x^2$ 와 $$\\int f$$",
+			[]string{`<span class="math math-inline">\(x^2\)</span>`, `<span class="math math-display">\[\int f\]</span>`},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderContent(tt.content, map[int64]int{5: 2}).HTML
+			for _, s := range tt.contains {
+				if !strings.Contains(got, s) {
+					t.Errorf("HTML에 %q가 없습니다: %s", s, got)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(got, s) {
+					t.Errorf("HTML에 %q가 남아 있습니다: %s", s, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderContentHeadingIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []tocEntry
+	}{
+		{
+			"Markdown 제목과 코드 블록",
+			"# 제목 [card:5]\n\n## 둘째\n\n```\n# 코드\n```",
+			[]tocEntry{{1, "제목", "section-0"}, {2, "둘째", "section-1"}},
+		},
+		{
+			"HTML 제목의 id는 다시 붙임",
+			`<h2 id="evil">HTML 제목</h2><p>본문</p><h3>하위</h3>`,
+			[]tocEntry{{2, "HTML 제목", "section-0"}, {3, "하위", "section-1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := renderContent(tt.content, nil)
+			if len(r.TOC) != len(tt.want) {
+				t.Fatalf("목차 = %v, want %v", r.TOC, tt.want)
+			}
+			for i, e := range tt.want {
+				if r.TOC[i] != e {
+					t.Errorf("목차[%d] = %v, want %v", i, r.TOC[i], e)
+				}
+				if !strings.Contains(r.HTML, `id="`+e.ID+`"`) {
+					t.Errorf("HTML에 id %q가 없습니다: %s", e.ID, r.HTML)
+				}
+			}
+			if strings.Contains(r.HTML, "evil") {
+				t.Errorf("원문의 제목 id가 남아 있습니다: %s", r.HTML)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 카드 검색
+//
+// 관련 카드와 의미 검색은 카드 임베딩의 코사인 유사도로 순위를 매깁니다. AI 서버에 연결할 수 없어
+// 임베딩을 받지 못하면 BM25로 대신 검색합니다. BM25 토큰은 영문·숫자는 단어 단위, 한글은 음절 bigram
+// ("자연어처리" → 자연, 연어, 어처, 처리)이라 조사가 붙거나 띄어쓰기가 달라도 어느 정도 찾을 수 있습니다.
+
+const (
+	searchEngineEmbedding = "embedding"
+	searchEngineBM25      = "bm25"
+
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+	maxSearchQueryLen  = 1000
+
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// englishStopwords는 BM25 토큰에서 뺄 흔한 영어 단어입니다.
+var englishStopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"for": true, "from": true, "in": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"that": true, "the": true, "this": true, "to": true, "was": true, "with": true,
+}
+
+// SearchResult는 검색된 카드와 점수입니다. 점수는 engine에 따라 코사인 유사도 또는 BM25 점수입니다.
+type SearchResult struct {
+	Card
+	Score float64 `json:"score"`
+}
+
+// SearchResponse는 관련 카드·의미 검색 응답입니다.
+type SearchResponse struct {
+	Engine  string         `json:"engine"`
+	Results []SearchResult `json:"results"`
+}
+
+// handleRelatedCards는 GET /api/cards/{id}/related?limit=10 요청을 처리합니다.
+// 같은 프로젝트에서 내용이 비슷한 카드를 유사도 순으로 반환합니다.
+func handleRelatedCards(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+	cardID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
+		return
+	}
+	limit, err := searchLimit(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var text string
+	var projectID int64
+	err = db.QueryRowContext(r.Context(), "SELECT COALESCE(cardtext, ''), project_id FROM cards WHERE id = ? AND user_id = ?", cardID, userID).Scan(&text, &projectID)
+	if err != nil {
+		httpError(w, r, "카드를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		return
+	}
+	if strings.TrimSpace(text) == "" {
+		writeSearchResponse(w, SearchResponse{Engine: searchEngineEmbedding, Results: []SearchResult{}})
+		return
+	}
+
+	searchCards(w, r, projectID, userID, text, limit, cardID)
+}
+
+// handleSemanticSearch는 GET /api/search/semantic?project_id={id}&q=...&limit=10 요청을 처리합니다.
+func handleSemanticSearch(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+	projectID, err := strconv.ParseInt(r.URL.Query().Get("project_id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "project_id 쿼리 파라미터가 필요합니다", http.StatusBadRequest)
+		return
+	}
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		httpError(w, r, "q 쿼리 파라미터가 필요합니다", http.StatusBadRequest)
+		return
+	}
+	if len([]rune(query)) > maxSearchQueryLen {
+		httpError(w, r, fmt.Sprintf("q는 %d자 이하여야 합니다", maxSearchQueryLen), http.StatusBadRequest)
+		return
+	}
+	limit, err := searchLimit(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var projectOwnerID int64
+	err = db.QueryRowContext(r.Context(), "SELECT user_id FROM projects WHERE id = ?", projectID).Scan(&projectOwnerID)
+	if err != nil || projectOwnerID != userID {
+		httpError(w, r, "프로젝트를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		return
+	}
+
+	searchCards(w, r, projectID, userID, query, limit, 0)
+}
+
+func searchLimit(r *http.Request) (int, error) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return defaultSearchLimit, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 || limit > maxSearchLimit {
+		return 0, fmt.Errorf("limit은 1~%d 사이여야 합니다", maxSearchLimit)
+	}
+	return limit, nil
+}
+
+// searchCards는 프로젝트 카드를 query와의 유사도로 정렬해 응답합니다. exclude 카드는 결과에서 뺍니다.
+// 임베딩을 쓸 수 없으면 BM25로 검색하고 X-AI-Degraded: search 헤더를 붙입니다.
+func searchCards(w http.ResponseWriter, r *http.Request, projectID, userID int64, query string, limit int, exclude int64) {
+	setUsageProject(r.Context(), projectID)
+	cards, err := loadProjectCards(r.Context(), projectID, userID)
+	if err != nil {
+		httpError(w, r, "카드 목록 조회 실패", http.StatusInternalServerError)
+		return
+	}
+
+	resp := SearchResponse{Engine: searchEngineEmbedding}
+	scored, err := rankByEmbedding(r.Context(), cards, query, limit, exclude)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		slog.Warn("임베딩 검색 실패, BM25로 검색합니다", "request_id", requestIDFrom(r.Context()), "error", err)
+		w.Header().Set("X-AI-Degraded", "search")
+		resp.Engine = searchEngineBM25
+		scored = rankBM25(query, cards, limit, exclude)
+	}
+
+	byID := make(map[int64]Card, len(cards))
+	for _, c := range cards {
+		byID[c.CardID] = c
+	}
+	resp.Results = make([]SearchResult, 0, len(scored))
+	for _, s := range scored {
+		if card, ok := byID[s.CardID]; ok {
+			resp.Results = append(resp.Results, SearchResult{Card: card, Score: s.Score})
+		}
+	}
+	writeSearchResponse(w, resp)
+}
+
+func writeSearchResponse(w http.ResponseWriter, resp SearchResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// rankByEmbedding은 searchCards가 읽어 둔 cards를 query 임베딩과의 코사인 유사도로 정렬합니다.
+func rankByEmbedding(ctx context.Context, cards []Card, query string, limit int, exclude int64) ([]scoredCard, error) {
+	candidates, err := cardEmbeddings(ctx, cards)
+	if err != nil {
+		return nil, err
+	}
+	vecs, err := embedTexts(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	return searchSimilar(vecs[0], candidates, limit, exclude), nil
+}
+
+// loadProjectCards는 검색 결과에 담을 프로젝트 카드를 읽습니다.
+func loadProjectCards(ctx context.Context, projectID, userID int64) ([]Card, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT id, COALESCE(cardtext, ''), COALESCE(cardurl, ''), COALESCE(cardtags, ''), COALESCE(category, ''), project_id, category_confidence, suggested_category FROM cards WHERE project_id = ? AND user_id = ?",
+		projectID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cards []Card
+	for rows.Next() {
+		var c Card
+		var confidence sql.NullFloat64
+		var suggested sql.NullString
+		if err := rows.Scan(&c.CardID, &c.Text, &c.URL, &c.Tags, &c.Category, &c.ProjectID, &confidence, &suggested); err != nil {
+			return nil, err
+		}
+		c.setClassification(confidence, suggested)
+		cards = append(cards, c)
+	}
+	return cards, rows.Err()
+}
+
+// searchTokens는 BM25용 토큰을 만듭니다. 한글은 음절 bigram, 그 밖의 문자·숫자는 소문자 단어입니다.
+func searchTokens(text string) []string {
+	var tokens []string
+	var run []rune
+	hangul := false
+	flush := func() {
+		switch {
+		case len(run) == 0:
+		case hangul && len(run) == 1:
+			tokens = append(tokens, string(run))
+		case hangul:
+			for i := 0; i+1 < len(run); i++ {
+				tokens = append(tokens, string(run[i:i+2]))
+			}
+		default:
+			if word := string(run); !englishStopwords[word] {
+				tokens = append(tokens, word)
+			}
+		}
+		run = run[:0]
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Hangul, r):
+			if !hangul {
+				flush()
+				hangul = true
+			}
+			run = append(run, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if hangul {
+				flush()
+				hangul = false
+			}
+			run = append(run, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+// rankBM25는 카드를 query에 대한 BM25 점수로 정렬해 점수가 0보다 큰 카드를 최대 limit개 반환합니다.
+func rankBM25(query string, cards []Card, limit int, exclude int64) []scoredCard {
+	type doc struct {
+		id     int64
+		tf     map[string]int
+		length int
+	}
+	docs := make([]doc, 0, len(cards))
+	df := make(map[string]int)
+	totalLength := 0
+	for _, c := range cards {
+		tokens := searchTokens(c.Text)
+		d := doc{id: c.CardID, tf: make(map[string]int), length: len(tokens)}
+		for _, t := range tokens {
+			if d.tf[t] == 0 {
+				df[t]++
+			}
+			d.tf[t]++
+		}
+		docs = append(docs, d)
+		totalLength += d.length
+	}
+	if len(docs) == 0 {
+		return []scoredCard{}
+	}
+	avgLength := float64(totalLength) / float64(len(docs))
+
+	terms := make(map[string]bool)
+	for _, t := range searchTokens(query) {
+		terms[t] = true
+	}
+
+	results := []scoredCard{}
+	for _, d := range docs {
+		if d.id == exclude {
+			continue
+		}
+		var score float64
+		for t := range terms {
+			tf := float64(d.tf[t])
+			if tf == 0 {
+				continue
+			}
+			n := float64(df[t])
+			idf := math.Log(1 + (float64(len(docs))-n+0.5)/(n+0.5))
+			score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(d.length)/avgLength))
+		}
+		if score > 0 {
+			results = append(results, scoredCard{CardID: d.id, Score: score})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSearchTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"한글 음절 bigram", "자연어처리", []string{"자연", "연어", "어처", "처리"}},
+		{"한 글자 한글", "책 읽기", []string{"책", "읽기"}},
+		{"영어 소문자와 불용어 제거", "The Go Programming Language is fun", []string{"go", "programming", "language", "fun"}},
+		{"한글과 영숫자 경계", "GPT4로 요약", []string{"gpt4", "로", "요약"}},
+		{"문장 부호로 나눔", "BM25, TF-IDF!", []string{"bm25", "tf", "idf"}},
+		{"불용어만 있음", "to be or not", []string{"not"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := searchTokens(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("searchTokens(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRankBM25(t *testing.T) {
+	cards := []Card{
+		{CardID: 1, Text: "Go 고루틴과 채널로 동시성 처리"},
+		{CardID: 2, Text: "고루틴 누수를 찾는 방법과 고루틴 덤프"},
+		{CardID: 3, Text: "김치찌개 레시피"},
+		{CardID: 4, Text: "채널 select 패턴"},
+		{CardID: 5, Text: ""},
+	}
+	ids := func(results []scoredCard) []int64 {
+		out := make([]int64, len(results))
+		for i, r := range results {
+			out[i] = r.CardID
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		limit   int
+		exclude int64
+		want    []int64
+	}{
+		{"점수 순으로 정렬", "고루틴", 10, 0, []int64{2, 1}},
+		{"맞는 단어가 없는 카드는 제외", "채널 고루틴", 10, 0, []int64{1, 2, 4}},
+		{"원본 카드 제외", "채널 고루틴", 10, 1, []int64{2, 4}},
+		{"limit에서 자름", "채널 고루틴", 2, 0, []int64{1, 2}},
+		{"불용어만 있는 질의", "the and of", 10, 0, []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := rankBM25(tt.query, cards, tt.limit, tt.exclude)
+			if got := ids(results); !slices.Equal(got, tt.want) {
+				t.Errorf("rankBM25(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+			for i := 1; i < len(results); i++ {
+				if results[i].Score > results[i-1].Score {
+					t.Errorf("점수가 내림차순이 아닙니다: %v", results)
+				}
+			}
+		})
+	}
+
+	if got := rankBM25("고루틴", nil, 10, 0); got == nil || len(got) != 0 {
+		t.Errorf("카드가 없을 때 결과 = %v, want 빈 목록", got)
+	}
+}
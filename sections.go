@@ -0,0 +1,511 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 문서 본문 형식. Markdown 제목(#)이 있으면 Markdown으로, 없으면 AI가 생성한 HTML(<h2> 등)로 봅니다.
+const (
+	documentFormatMarkdown = "markdown"
+	documentFormatHTML     = "html"
+)
+
+// 섹션 재생성 방식
+const (
+	sectionModeRegenerate = "regenerate"
+	sectionModeExpand     = "expand"
+)
+
+// 리비전 source: 변경 직전 내용은 snapshot, AI가 바꾼 내용은 섹션 재생성 방식이나 document_expand(문서 전체 확장)를 기록합니다.
+const (
+	revisionSourceSnapshot       = "snapshot"
+	revisionSourceDocumentExpand = "document_expand"
+)
+
+const maxSectionInstructionLen = 2000
+
+var (
+	markdownHeading = regexp.MustCompile(`^ {0,3}(#{1,6})[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+	markdownFence   = regexp.MustCompile("^ {0,3}(```|~~~)")
+	htmlHeading     = regexp.MustCompile(`(?is)<h([1-6])(?:\s[^>]*)?>(.*?)</h[1-6]\s*>`)
+	htmlTag         = regexp.MustCompile(`<[^>]*>`)
+	htmlBlockStart  = regexp.MustCompile(`(?i)^\s*<(h[1-6]|p|div|section|article|ul|ol|table|blockquote|pre)\b`)
+)
+
+// errSectionChanged는 AI가 섹션을 생성하는 동안 다른 곳에서 그 섹션이 바뀌었거나 없어졌을 때 반환됩니다.
+var errSectionChanged = errors.New("섹션을 생성하는 동안 문서가 수정되어 섹션을 찾을 수 없습니다. 문서를 다시 불러온 뒤 시도하세요")
+
+// documentSection은 제목 하나로 시작하는 문서 구간입니다. 구간은 같거나 더 높은 수준의 다음 제목 앞에서 끝나므로
+// 하위 제목의 섹션은 상위 섹션 안에 포함됩니다. start, bodyStart, end는 content의 바이트 위치입니다.
+type documentSection struct {
+	Index   int    `json:"index"`
+	Level   int    `json:"level"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+
+	start, bodyStart, end int
+}
+
+// parseSections는 본문을 제목 기준으로 나눕니다. 첫 제목 앞의 내용은 섹션에 속하지 않습니다.
+func parseSections(content string) (string, []documentSection) {
+	if sections := parseMarkdownSections(content); len(sections) > 0 {
+		return documentFormatMarkdown, sections
+	}
+	if sections := parseHTMLSections(content); len(sections) > 0 {
+		return documentFormatHTML, sections
+	}
+	return documentFormatMarkdown, []documentSection{}
+}
+
+func parseMarkdownSections(content string) []documentSection {
+	var sections []documentSection
+	inFence := false
+	for pos := 0; pos < len(content); {
+		lineEnd := strings.IndexByte(content[pos:], '\n')
+		next := len(content)
+		if lineEnd >= 0 {
+			next = pos + lineEnd + 1
+			lineEnd += pos
+		} else {
+			lineEnd = len(content)
+		}
+		line := strings.TrimSuffix(content[pos:lineEnd], "\r")
+
+		// 코드 블록 안의 #은 제목이 아닙니다.
+		if markdownFence.MatchString(line) {
+			inFence = !inFence
+		} else if m := markdownHeading.FindStringSubmatch(line); !inFence && m != nil && strings.TrimSpace(m[2]) != "" {
+			sections = append(sections, documentSection{
+				Level:     len(m[1]),
+				Title:     strings.TrimSpace(m[2]),
+				start:     pos,
+				bodyStart: next,
+			})
+		}
+		pos = next
+	}
+	return closeSections(content, sections)
+}
+
+func parseHTMLSections(content string) []documentSection {
+	var sections []documentSection
+	for _, m := range htmlHeading.FindAllStringSubmatchIndex(content, -1) {
+		level, _ := strconv.Atoi(content[m[2]:m[3]])
+		title := strings.TrimSpace(html.UnescapeString(htmlTag.ReplaceAllString(content[m[4]:m[5]], "")))
+		sections = append(sections, documentSection{
+			Level:     level,
+			Title:     title,
+			start:     m[0],
+			bodyStart: m[1],
+		})
+	}
+	return closeSections(content, sections)
+}
+
+// detectDocumentFormat은 본문 형식을 추정합니다. 제목이 없는 본문은 블록 HTML 태그로 시작할 때만 HTML로 봅니다.
+// Markdown 본문에도 <br>이나 "x < 3" 같은 꺾쇠가 나올 수 있으므로 태그가 있다는 것만으로는 HTML로 보지 않습니다.
+func detectDocumentFormat(content string) string {
+	format, sections := parseSections(content)
+	if len(sections) == 0 && htmlBlockStart.MatchString(content) {
+		return documentFormatHTML
+	}
+	return format
+}
+
+// closeSections는 각 섹션의 끝 위치와 번호, 본문을 채웁니다.
+func closeSections(content string, sections []documentSection) []documentSection {
+	for i := range sections {
+		sections[i].Index = i
+		sections[i].end = len(content)
+		for j := i + 1; j < len(sections); j++ {
+			if sections[j].Level <= sections[i].Level {
+				sections[i].end = sections[j].start
+				break
+			}
+		}
+		sections[i].Content = strings.TrimSpace(content[sections[i].bodyStart:sections[i].end])
+	}
+	return sections
+}
+
+// replaceSectionBody는 섹션의 제목은 그대로 두고 본문만 body로 바꾼 문서를 반환합니다.
+func replaceSectionBody(content, format string, sec documentSection, body string) string {
+	body = strings.TrimSpace(body)
+	before, after := content[:sec.bodyStart], content[sec.end:]
+	if format == documentFormatHTML {
+		return before + body + after
+	}
+	if !strings.HasSuffix(before, "\n") {
+		before += "\n"
+	}
+	if after != "" {
+		body += "\n"
+	}
+	return before + "\n" + body + "\n" + after
+}
+
+// findSection은 index 위치의 섹션이 title, level과 같을 때만 반환합니다.
+func findSection(sections []documentSection, index int, title string, level int) (documentSection, bool) {
+	if index < 0 || index >= len(sections) {
+		return documentSection{}, false
+	}
+	sec := sections[index]
+	if (title != "" && sec.Title != title) || (level != 0 && sec.Level != level) {
+		return documentSection{}, false
+	}
+	return sec, true
+}
+
+// AgentSectionRequest는 AI 서버 /agent/section 엔드포인트에 보낼 요청 본문입니다.
+// 문서 생성 요청의 카드, 태그, 카테고리, 형식 옵션에 수정할 섹션 정보를 더합니다.
+type AgentSectionRequest struct {
+	AgentInvokeRequest
+	Mode           string `json:"mode"`
+	Format         string `json:"format"`
+	Document       string `json:"document"`
+	SectionTitle   string `json:"section_title"`
+	SectionContent string `json:"section_content"`
+	Instruction    string `json:"instruction"`
+}
+
+// DocumentRevision은 GET /api/documents/{id}/revisions 응답 항목입니다. 목록에서는 Content를 생략합니다.
+type DocumentRevision struct {
+	Version      int64     `json:"version"`
+	Source       string    `json:"source"`
+	SectionTitle string    `json:"section_title,omitempty"`
+	Instruction  string    `json:"instruction,omitempty"`
+	Content      string    `json:"content,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// handleDocumentSections는 GET /api/documents/{id}/sections 요청을 처리합니다.
+func handleDocumentSections(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+	docID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
+		return
+	}
+
+	// 편집 세션에 저장하지 않은 편집이 있으면 저장한 뒤 읽어야 섹션 번호가 재생성 요청과 맞습니다.
+	docSessions.save(docID)
+
+	var content string
+	var version int64
+	err = db.QueryRowContext(r.Context(), "SELECT content, version FROM documents WHERE id = ? AND user_id = ?", docID, userID).Scan(&content, &version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			httpError(w, r, "문서를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		} else {
+			httpError(w, r, "문서 조회 실패", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	format, sections := parseSections(content)
+	w.Header().Set("ETag", documentETag(version))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"format":   format,
+		"version":  version,
+		"sections": sections,
+	})
+}
+
+// handleDocumentSection은 POST /api/documents/{id}/sections/{index} 요청을 처리합니다.
+// 본문 {"mode": "regenerate"|"expand", "instruction": "...", "title": "..."}로 섹션 하나를
+// 프로젝트 카드를 바탕으로 다시 쓰거나 보강하고, 바뀌기 전과 후의 문서를 리비전으로 남깁니다.
+// title을 보내면 그 번호의 섹션 제목이 다를 때 409를 반환합니다. If-Match 헤더도 지원합니다.
+func handleDocumentSection(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+	docID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
+		return
+	}
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil {
+		httpError(w, r, "잘못된 섹션 번호", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Mode        string `json:"mode"`
+		Instruction string `json:"instruction"`
+		Title       string `json:"title"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "잘못된 JSON 형식", http.StatusBadRequest)
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = sectionModeRegenerate
+	}
+	if req.Mode != sectionModeRegenerate && req.Mode != sectionModeExpand {
+		httpError(w, r, "잘못된 mode 값 (regenerate, expand)", http.StatusBadRequest)
+		return
+	}
+	req.Instruction = strings.TrimSpace(req.Instruction)
+	if len([]rune(req.Instruction)) > maxSectionInstructionLen {
+		httpError(w, r, fmt.Sprintf("instruction은 %d자 이하여야 합니다", maxSectionInstructionLen), http.StatusBadRequest)
+		return
+	}
+
+	docSessions.save(docID)
+
+	var doc Document
+	var options sql.NullString
+	err = db.QueryRowContext(r.Context(),
+		"SELECT title, content, project_id, version, mode, doc_type, generation_options FROM documents WHERE id = ? AND user_id = ?",
+		docID, userID,
+	).Scan(&doc.Title, &doc.Content, &doc.ProjectID, &doc.Version, &doc.Mode, &doc.DocType, &options)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			httpError(w, r, "문서를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		} else {
+			httpError(w, r, "문서 조회 실패", http.StatusInternalServerError)
+		}
+		return
+	}
+	doc.ID, doc.UserID = docID, userID
+	doc.GenerationOptions = parseGenerationOptions(options)
+	setUsageProject(r.Context(), doc.ProjectID)
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etagMatches(ifMatch, doc.Version) {
+		writeVersionConflict(w, r, doc.Version)
+		return
+	}
+
+	format, sections := parseSections(doc.Content)
+	if index < 0 || index >= len(sections) {
+		httpError(w, r, "섹션을 찾을 수 없습니다", http.StatusNotFound)
+		return
+	}
+	sec, ok := findSection(sections, index, req.Title, 0)
+	if !ok {
+		httpError(w, r, fmt.Sprintf("%d번 섹션의 제목이 %q가 아닙니다. 문서를 다시 불러온 뒤 시도하세요", index, req.Title), http.StatusConflict)
+		return
+	}
+
+	agentReq, err := buildDocumentAgentRequest(r.Context(), &doc)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var aiResponse AgentInvokeResponse
+	err = aiPost(r.Context(), "/agent/section", AgentSectionRequest{
+		AgentInvokeRequest: agentReq,
+		Mode:               req.Mode,
+		Format:             format,
+		Document:           doc.Content,
+		SectionTitle:       sec.Title,
+		SectionContent:     sec.Content,
+		Instruction:        req.Instruction,
+	}, &aiResponse)
+	if err != nil {
+		writeAIError(w, r, "AI 섹션 생성", err)
+		return
+	}
+
+	err = saveRegeneratedSection(r.Context(), &doc, sec, req.Mode, req.Instruction, aiResponse, projectCardSet(agentReq.AllCards))
+	if err != nil {
+		if errors.Is(err, errSectionChanged) {
+			httpError(w, r, err.Error(), http.StatusConflict)
+		} else {
+			httpError(w, r, "섹션 저장 실패: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	docSessions.replace(docID, doc.Content, doc.Version)
+	publishProjectEvent(r.Context(), doc.ProjectID, eventDocumentUpdated, documentEventData(doc))
+
+	_, sections = parseSections(doc.Content)
+	sec, _ = findSection(sections, index, "", 0)
+
+	w.Header().Set("ETag", documentETag(doc.Version))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"document": doc,
+		"section":  sec,
+	})
+}
+
+// buildDocumentAgentRequest는 이미 있는 문서를 AI로 고칠 때 문서에 저장된 생성 옵션으로 요청을 만듭니다.
+func buildDocumentAgentRequest(ctx context.Context, doc *Document) (AgentInvokeRequest, error) {
+	req, err := buildAgentRequest(ctx, doc.Title, doc.ProjectID, doc.UserID, doc.GenerationOptions)
+	if errors.Is(err, errInvalidOptions) {
+		// 문서를 만들 때 선택한 카드나 카테고리가 그 뒤 지워졌으면 프로젝트 전체 카드를 사용합니다.
+		slog.Warn("저장된 생성 옵션의 카드 선택을 적용할 수 없어 전체 카드를 사용합니다", "request_id", requestIDFrom(ctx), "document_id", doc.ID, "error", err)
+		wider := *doc.GenerationOptions
+		wider.Categories, wider.CardIDs = nil, nil
+		req, err = buildAgentRequest(ctx, doc.Title, doc.ProjectID, doc.UserID, &wider)
+	}
+	return req, err
+}
+
+// saveRegeneratedSection은 AI가 생성한 섹션 본문을 문서에 반영하고 리비전과 인용 정보를 저장합니다.
+// AI 호출 중에 문서가 수정되었으면 같은 번호에 같은 제목의 섹션이 남아 있을 때만 그 섹션을 바꿉니다.
+// 성공하면 doc의 Content, Version, UpdatedAt을 새 값으로 채웁니다.
+func saveRegeneratedSection(ctx context.Context, doc *Document, sec documentSection, mode, instruction string, ai AgentInvokeResponse, projectCards map[int64]bool) error {
+	existing, err := documentCitationOrdinals(ctx, doc.ID)
+	if err != nil {
+		return fmt.Errorf("인용 정보 조회 실패: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var content string
+	var version int64
+	if err := tx.QueryRowContext(ctx, "SELECT content, version FROM documents WHERE id = ?", doc.ID).Scan(&content, &version); err != nil {
+		return err
+	}
+	format, sections := parseSections(content)
+	current, ok := findSection(sections, sec.Index, sec.Title, sec.Level)
+	if !ok {
+		return errSectionChanged
+	}
+
+	body, citations := applyCitationsFrom(ai.Report, projectCards, ai.CardIDs, existing)
+	newContent := replaceSectionBody(content, format, current, body)
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT OR IGNORE INTO document_revisions (document_id, version, content, source) VALUES (?, ?, ?, ?)",
+		doc.ID, version, content, revisionSourceSnapshot,
+	)
+	if err != nil {
+		return fmt.Errorf("리비전 저장 실패: %w", err)
+	}
+	result, err := tx.ExecContext(ctx,
+		"UPDATE documents SET content = ?, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND version = ?",
+		newContent, doc.ID, version,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errSectionChanged
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO document_revisions (document_id, version, content, source, section_title, instruction) VALUES (?, ?, ?, ?, ?, ?)",
+		doc.ID, version+1, newContent, mode, current.Title, instruction,
+	)
+	if err != nil {
+		return fmt.Errorf("리비전 저장 실패: %w", err)
+	}
+	if err := insertCitations(ctx, tx, doc.ID, citations); err != nil {
+		return err
+	}
+	if err := tx.QueryRowContext(ctx, "SELECT status, created_at, updated_at FROM documents WHERE id = ?", doc.ID).Scan(&doc.Status, &doc.CreatedAt, &doc.UpdatedAt); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	doc.Content, doc.Version = newContent, version+1
+	return nil
+}
+
+// handleDocumentRevisions는 GET /api/documents/{id}/revisions 요청을 처리합니다 (최신 순, 내용 제외).
+func handleDocumentRevisions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+	docID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
+		return
+	}
+	if _, err := documentProjectID(r.Context(), docID, userID); err != nil {
+		httpError(w, r, "문서를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(),
+		"SELECT version, source, section_title, instruction, created_at FROM document_revisions WHERE document_id = ? ORDER BY version DESC",
+		docID,
+	)
+	if err != nil {
+		httpError(w, r, "리비전 목록 조회 실패", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	revisions := []DocumentRevision{}
+	for rows.Next() {
+		var rev DocumentRevision
+		if err := rows.Scan(&rev.Version, &rev.Source, &rev.SectionTitle, &rev.Instruction, &rev.CreatedAt); err != nil {
+			httpError(w, r, "DB 스캔 실패", http.StatusInternalServerError)
+			return
+		}
+		revisions = append(revisions, rev)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// handleDocumentRevision은 GET /api/documents/{id}/revisions/{version} 요청을 처리합니다.
+func handleDocumentRevision(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+	docID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
+		return
+	}
+	version, err := strconv.ParseInt(r.PathValue("version"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 version 경로", http.StatusBadRequest)
+		return
+	}
+	if _, err := documentProjectID(r.Context(), docID, userID); err != nil {
+		httpError(w, r, "문서를 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+		return
+	}
+
+	var rev DocumentRevision
+	err = db.QueryRowContext(r.Context(),
+		"SELECT version, source, section_title, instruction, content, created_at FROM document_revisions WHERE document_id = ? AND version = ?",
+		docID, version,
+	).Scan(&rev.Version, &rev.Source, &rev.SectionTitle, &rev.Instruction, &rev.Content, &rev.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			httpError(w, r, "리비전을 찾을 수 없습니다", http.StatusNotFound)
+		} else {
+			httpError(w, r, "리비전 조회 실패", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rev)
+}
@@ -0,0 +1,137 @@
+package main
+
+import "testing"
+
+// sectionSummary는 비교하기 쉽도록 섹션의 수준, 제목, 본문만 남깁니다.
+type sectionSummary struct {
+	Level   int
+	Title   string
+	Content string
+}
+
+func summarizeSections(sections []documentSection) []sectionSummary {
+	out := make([]sectionSummary, len(sections))
+	for i, s := range sections {
+		out[i] = sectionSummary{s.Level, s.Title, s.Content}
+	}
+	return out
+}
+
+func TestParseSections(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		format  string
+		want    []sectionSummary
+	}{
+		{
+			"하위 제목은 상위 섹션에 포함",
+			"intro\n# A\na\n## B\nb\n### C\nc\n## D\nd\n# E\ne\n",
+			documentFormatMarkdown,
+			[]sectionSummary{
+				{1, "A", "a\n## B\nb\n### C\nc\n## D\nd"},
+				{2, "B", "b\n### C\nc"},
+				{3, "C", "c"},
+				{2, "D", "d"},
+				{1, "E", "e"},
+			},
+		},
+		{
+			"코드 블록 안의 #은 제목이 아님",
+			"# A\n```\n# not\n```\n~~~\n## no\n~~~\n# B  ##\nb",
+			documentFormatMarkdown,
+			[]sectionSummary{
+				{1, "A", "```\n# not\n```\n~~~\n## no\n~~~"},
+				{1, "B", "b"},
+			},
+		},
+		{
+			"HTML 제목",
+			`<h2>A</h2><p>a</p><h3 class="x">B <b>bold</b></h3><p>b</p><h2>C</h2>`,
+			documentFormatHTML,
+			[]sectionSummary{
+				{2, "A", `<p>a</p><h3 class="x">B <b>bold</b></h3><p>b</p>`},
+				{3, "B bold", "<p>b</p>"},
+				{2, "C", ""},
+			},
+		},
+		{"제목 없음", "#nospace\n#   \n본문", documentFormatMarkdown, []sectionSummary{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, sections := parseSections(tt.content)
+			if format != tt.format {
+				t.Errorf("형식 = %s, want %s", format, tt.format)
+			}
+			got := summarizeSections(sections)
+			if len(got) != len(tt.want) {
+				t.Fatalf("섹션 = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("섹션[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+				if sections[i].Index != i {
+					t.Errorf("섹션[%d].Index = %d", i, sections[i].Index)
+				}
+			}
+		})
+	}
+}
+
+func TestReplaceSectionBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		index   int
+		body    string
+		want    string
+	}{
+		{"하위 섹션", "# A\na\n## B\nb\n# C\nc", 1, "new b", "# A\na\n## B\n\nnew b\n\n# C\nc"},
+		{"상위 섹션은 하위 섹션까지 바뀜", "# A\na\n## B\nb\n# C\nc", 0, "new a", "# A\n\nnew a\n\n# C\nc"},
+		{"마지막 섹션", "# A\na\n## B\nb\n# C\nc", 2, "new c", "# A\na\n## B\nb\n# C\n\nnew c\n"},
+		{"HTML 섹션", "<h2>A</h2><p>a</p><h2>B</h2><p>b</p>", 0, " <p>new</p>\n", "<h2>A</h2><p>new</p><h2>B</h2><p>b</p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, sections := parseSections(tt.content)
+			got := replaceSectionBody(tt.content, format, sections[tt.index], tt.body)
+			if got != tt.want {
+				t.Errorf("결과 = %q, want %q", got, tt.want)
+			}
+			// 바꾼 뒤에도 제목 구조는 그대로여야 합니다.
+			if _, after := parseSections(got); sections[tt.index].Title != after[tt.index].Title {
+				t.Errorf("바꾼 뒤 섹션[%d] 제목 = %q, want %q", tt.index, after[tt.index].Title, sections[tt.index].Title)
+			}
+		})
+	}
+}
+
+func TestFindSection(t *testing.T) {
+	_, sections := parseSections("# A\na\n## B\nb\n# C\nc")
+	tests := []struct {
+		name  string
+		index int
+		title string
+		level int
+		ok    bool
+	}{
+		{"번호, 제목, 수준이 맞음", 1, "B", 2, true},
+		{"제목과 수준을 비우면 번호만 봄", 2, "", 0, true},
+		{"제목이 다름", 1, "A", 2, false},
+		{"수준이 다름", 1, "B", 1, false},
+		{"번호가 범위 밖", 3, "", 0, false},
+		{"음수 번호", -1, "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sec, ok := findSection(sections, tt.index, tt.title, tt.level)
+			if ok != tt.ok {
+				t.Fatalf("findSection(%d, %q, %d) ok = %v, want %v", tt.index, tt.title, tt.level, ok, tt.ok)
+			}
+			if ok && sec.Index != tt.index {
+				t.Errorf("섹션 번호 = %d, want %d", sec.Index, tt.index)
+			}
+		})
+	}
+}
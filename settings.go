@@ -0,0 +1,542 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config는 서버 실행에 필요한 모든 설정값입니다.
+// 우선순위는 기본값 < 설정 파일(YAML/TOML) < 환경 변수 < 명령행 플래그 순입니다.
+// 각 필드의 env 태그는 해당 값을 덮어쓰는 환경 변수 이름이며,
+// secret 태그가 붙은 필드는 시작 로그에 출력할 때 가려집니다.
+type Config struct {
+	Env      string         `yaml:"env" toml:"env" env:"APP_ENV"`
+	Server   ServerConfig   `yaml:"server" toml:"server"`
+	DB       DBConfig       `yaml:"database" toml:"database"`
+	GitHub   GitHubConfig   `yaml:"github" toml:"github"`
+	AI       AIConfig       `yaml:"ai" toml:"ai"`
+	Classify ClassifyConfig `yaml:"classify" toml:"classify"`
+	Cluster  ClusterConfig  `yaml:"cluster" toml:"cluster"`
+	Tags     TagsConfig     `yaml:"tags" toml:"tags"`
+	Usage    UsageConfig    `yaml:"usage" toml:"usage"`
+	Throttle ThrottleConfig `yaml:"rate_limit" toml:"rate_limit"`
+	JWT      JWTConfig      `yaml:"jwt" toml:"jwt"`
+	Jobs     JobsConfig     `yaml:"jobs" toml:"jobs"`
+	Log      LogConfig      `yaml:"log" toml:"log"`
+	Metrics  MetricsConfig  `yaml:"metrics" toml:"metrics"`
+	Tracing  TracingConfig  `yaml:"tracing" toml:"tracing"`
+}
+
+type ServerConfig struct {
+	Addr      string `yaml:"addr" toml:"addr" env:"SERVER_ADDR"`
+	PublicURL string `yaml:"public_url" toml:"public_url" env:"PUBLIC_URL"`
+	StaticDir string `yaml:"static_dir" toml:"static_dir" env:"STATIC_DIR"`
+
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	// AI 문서 생성은 1분 이상 걸릴 수 있으므로 WriteTimeout은 AI 호출 시간보다 길어야 합니다.
+	WriteTimeout    time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+}
+
+type DBConfig struct {
+	Path string `yaml:"path" toml:"path" env:"DB_PATH"`
+}
+
+type GitHubConfig struct {
+	ClientID     string `yaml:"client_id" toml:"client_id" env:"GITHUB_CLIENT_ID"`
+	ClientSecret string `yaml:"client_secret" toml:"client_secret" env:"GITHUB_CLIENT_SECRET" secret:"true"`
+	// RedirectURL이 비어 있으면 PublicURL + "/auth/github/callback"을 사용합니다.
+	RedirectURL string `yaml:"redirect_url" toml:"redirect_url" env:"OAUTH_REDIRECT_URL"`
+}
+
+type AIConfig struct {
+	ServerURL      string        `yaml:"server_url" toml:"server_url" env:"AI_SERVER_URL"`
+	HealthInterval time.Duration `yaml:"health_interval" toml:"health_interval" env:"AI_HEALTH_INTERVAL"`
+
+	// 엔드포인트별 시도당 타임아웃
+	DefaultTimeout time.Duration `yaml:"default_timeout" toml:"default_timeout" env:"AI_DEFAULT_TIMEOUT"`
+	TagsTimeout    time.Duration `yaml:"tags_timeout" toml:"tags_timeout" env:"AI_TAGS_TIMEOUT"`
+	ClusterTimeout time.Duration `yaml:"cluster_timeout" toml:"cluster_timeout" env:"AI_CLUSTER_TIMEOUT"`
+	AgentTimeout   time.Duration `yaml:"agent_timeout" toml:"agent_timeout" env:"AI_AGENT_TIMEOUT"`
+	// 스트리밍 보고서 생성은 쓰기 타임아웃 대신 이 시간으로 전체 스트림을 제한합니다.
+	StreamTimeout time.Duration `yaml:"stream_timeout" toml:"stream_timeout" env:"AI_STREAM_TIMEOUT"`
+
+	// 재시도는 idempotent 엔드포인트(태그 생성, 클러스터링)에만 적용됩니다.
+	MaxRetries   int           `yaml:"max_retries" toml:"max_retries" env:"AI_MAX_RETRIES"`
+	RetryBackoff time.Duration `yaml:"retry_backoff" toml:"retry_backoff" env:"AI_RETRY_BACKOFF"`
+
+	// 카드 임베딩 모델 이름. 임베딩은 (내용 해시, 모델)로 DB에 저장되며, 바꾸면 새 모델로 다시 받습니다.
+	EmbeddingModel string `yaml:"embedding_model" toml:"embedding_model" env:"AI_EMBEDDING_MODEL"`
+	// 메모리에 보관할 카드 임베딩 수 (DB에는 모두 저장됩니다)
+	EmbeddingCacheSize int `yaml:"embedding_cache_size" toml:"embedding_cache_size" env:"EMBEDDING_CACHE_SIZE"`
+	// 바뀌거나 삭제된 카드의 임베딩을 DB에서 지우는 주기
+	EmbeddingPruneInterval time.Duration `yaml:"embedding_prune_interval" toml:"embedding_prune_interval" env:"EMBEDDING_PRUNE_INTERVAL"`
+
+	// 연속 BreakerThreshold번 실패하면 BreakerOpenFor 동안 AI 호출을 즉시 거부합니다.
+	BreakerThreshold int           `yaml:"breaker_threshold" toml:"breaker_threshold" env:"AI_BREAKER_THRESHOLD"`
+	BreakerOpenFor   time.Duration `yaml:"breaker_open_for" toml:"breaker_open_for" env:"AI_BREAKER_OPEN_FOR"`
+}
+
+// ClassifyConfig는 새 카드를 기존 카테고리로 자동 분류하는 설정입니다.
+type ClassifyConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"CLASSIFY_ENABLED"`
+	// 가장 가까운 카테고리와의 코사인 유사도가 이 값 이상일 때만 카테고리를 바꿉니다.
+	MinConfidence float64 `yaml:"min_confidence" toml:"min_confidence" env:"CLASSIFY_MIN_CONFIDENCE"`
+}
+
+type ClusterConfig struct {
+	// 요청에 engine이 없을 때 쓰는 클러스터링 엔진입니다 (auto, ai, local).
+	Engine string `yaml:"engine" toml:"engine" env:"CLUSTER_ENGINE"`
+}
+
+// TagsConfig는 카드 태그 자동 생성 설정입니다.
+type TagsConfig struct {
+	// auto: AI 서버로 만들고 실패하면 로컬 추출기 사용, ai: AI 서버만, local: 로컬 추출기만
+	Engine string `yaml:"engine" toml:"engine" env:"TAGS_ENGINE"`
+	// 로컬 추출기가 만들 최대 태그 수 (AI 서버는 자체 규칙을 따릅니다)
+	MaxTags int `yaml:"max_tags" toml:"max_tags" env:"TAGS_MAX_TAGS"`
+	// 한 줄에 태그 하나씩 적은 사용자 사전 파일. 카드 내용에 나오는 사전 단어를 먼저 태그로 고릅니다.
+	DictionaryPath string `yaml:"dictionary_path" toml:"dictionary_path" env:"TAGS_DICTIONARY_PATH"`
+}
+
+// UsageConfig는 사용자별 하루(UTC) AI 사용 한도입니다. 0이면 제한하지 않습니다.
+type UsageConfig struct {
+	// 하루 AI 서버 호출 수
+	DailyRequests int `yaml:"daily_requests" toml:"daily_requests" env:"USAGE_DAILY_REQUESTS"`
+	// 하루 토큰 수 (AI 서버가 알려 준 입력 + 출력 토큰)
+	DailyTokens int64 `yaml:"daily_tokens" toml:"daily_tokens" env:"USAGE_DAILY_TOKENS"`
+}
+
+// ThrottleConfig는 요청 속도 제한(토큰 버킷) 설정입니다.
+// 인증된 API는 사용자 ID별로, 로그인 경로는 클라이언트 IP별로 라우트마다 버킷을 따로 둡니다.
+type ThrottleConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"RATE_LIMIT_ENABLED"`
+	// routes에 없는 라우트의 초당 요청 수와 한 번에 몰아 보낼 수 있는 요청 수
+	Rate  float64 `yaml:"rate" toml:"rate" env:"RATE_LIMIT_RATE"`
+	Burst int     `yaml:"burst" toml:"burst" env:"RATE_LIMIT_BURST"`
+	// 등록된 라우트 패턴(예: "/api/projects/cluster", "POST /api/cards/{id}/retag")별 한도. rate가 0이면 제한하지 않습니다.
+	// 메소드 없이 등록된 패턴은 "POST /api/documents/"처럼 메소드를 붙여 그 메소드만 따로 제한할 수 있습니다.
+	Routes map[string]RateLimitRule `yaml:"routes" toml:"routes"`
+	// 인증 전(모든 /api 요청과 정적 파일)에 적용하는 IP별 한도. 라우트와 관계없이 IP 하나에 버킷 하나입니다.
+	IPRate  float64 `yaml:"ip_rate" toml:"ip_rate" env:"RATE_LIMIT_IP_RATE"`
+	IPBurst int     `yaml:"ip_burst" toml:"ip_burst" env:"RATE_LIMIT_IP_BURST"`
+	// X-Forwarded-For의 첫 주소를 클라이언트 IP로 씁니다. 리버스 프록시 뒤에서만 켜세요.
+	TrustProxy bool `yaml:"trust_proxy" toml:"trust_proxy" env:"RATE_LIMIT_TRUST_PROXY"`
+}
+
+// RateLimitRule은 토큰 버킷 하나의 크기입니다. 버킷에는 초당 Rate개씩 최대 Burst개까지 요청이 쌓입니다.
+type RateLimitRule struct {
+	Rate  float64 `yaml:"rate" toml:"rate"`
+	Burst int     `yaml:"burst" toml:"burst"`
+}
+
+type JobsConfig struct {
+	Workers   int `yaml:"workers" toml:"workers" env:"JOBS_WORKERS"`
+	QueueSize int `yaml:"queue_size" toml:"queue_size" env:"JOBS_QUEUE_SIZE"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL"`    // debug, info, warn, error
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT"` // text, json
+}
+
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled" env:"METRICS_ENABLED"`
+	Path    string `yaml:"path" toml:"path" env:"METRICS_PATH"`
+}
+
+type TracingConfig struct {
+	Exporter string `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER"` // none, stdout, otlp
+	// OTLP/HTTP 수집기 URL (예: http://localhost:4318/v1/traces)
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint" env:"TRACING_ENDPOINT"`
+	ServiceName string  `yaml:"service_name" toml:"service_name" env:"TRACING_SERVICE_NAME"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+type JWTConfig struct {
+	SigningAlg     string `yaml:"signing_alg" toml:"signing_alg" env:"JWT_SIGNING_ALG"`
+	KeyID          string `yaml:"key_id" toml:"key_id" env:"JWT_KEY_ID"`
+	SecretKey      string `yaml:"secret_key" toml:"secret_key" env:"JWT_SECRET_KEY" secret:"true"`
+	PrivateKeyFile string `yaml:"private_key_file" toml:"private_key_file" env:"JWT_PRIVATE_KEY_FILE"`
+	VerifyKeys     string `yaml:"verify_keys" toml:"verify_keys" env:"JWT_VERIFY_KEYS" secret:"true"`
+	Issuer         string `yaml:"issuer" toml:"issuer" env:"JWT_ISSUER"`
+	Audience       string `yaml:"audience" toml:"audience" env:"JWT_AUDIENCE"`
+	// kid·iss·aud가 없는 예전 형식 토큰을 받는 마지막 시각 (RFC 3339). 비어 있으면 토큰이 만료될 때까지 받습니다.
+	LegacyUntil string `yaml:"legacy_until" toml:"legacy_until" env:"JWT_LEGACY_UNTIL"`
+	// kid가 없는 예전 토큰을 검증할 키의 kid. 비어 있으면 현재 서명 키로 검증합니다.
+	// 서명 알고리즘을 바꾼 뒤에는 verify_keys에 넣은 예전 키의 kid를 지정합니다.
+	LegacyKeyID string `yaml:"legacy_key_id" toml:"legacy_key_id" env:"JWT_LEGACY_KEY_ID"`
+}
+
+var cfg *Config
+
+func defaultConfig() *Config {
+	return &Config{
+		Env: "dev",
+		Server: ServerConfig{
+			Addr:      ":8080",
+			PublicURL: "http://localhost:8080",
+			StaticDir: "./static",
+
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      3 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   2 * time.Minute,
+		},
+		DB: DBConfig{
+			Path: "./main.db",
+		},
+		AI: AIConfig{
+			ServerURL:      "http://127.0.0.1:8000",
+			HealthInterval: 15 * time.Second,
+
+			DefaultTimeout: 30 * time.Second,
+			TagsTimeout:    20 * time.Second,
+			ClusterTimeout: 2 * time.Minute,
+			AgentTimeout:   150 * time.Second,
+			StreamTimeout:  5 * time.Minute,
+
+			MaxRetries:   2,
+			RetryBackoff: 500 * time.Millisecond,
+
+			EmbeddingModel:         "gemini-embedding-001",
+			EmbeddingCacheSize:     10000,
+			EmbeddingPruneInterval: 24 * time.Hour,
+
+			BreakerThreshold: 5,
+			BreakerOpenFor:   30 * time.Second,
+		},
+		Classify: ClassifyConfig{
+			Enabled:       true,
+			MinConfidence: 0.7,
+		},
+		Cluster: ClusterConfig{
+			Engine: clusterEngineAuto,
+		},
+		Tags: TagsConfig{
+			Engine:  tagEngineAuto,
+			MaxTags: 5,
+		},
+		JWT: JWTConfig{
+			SigningAlg: "HS256",
+			KeyID:      "primary",
+			Issuer:     "acornhub",
+			Audience:   "acornhub",
+		},
+		Throttle: ThrottleConfig{
+			Enabled: true,
+			Rate:    10,
+			Burst:   20,
+			IPRate:  50,
+			IPBurst: 100,
+			Routes: map[string]RateLimitRule{
+				// AI 서버를 부르는 무거운 요청
+				"/api/projects/cluster":                         {Rate: 0.2, Burst: 3},
+				"POST /api/projects/{id}/categories/subcluster": {Rate: 0.2, Burst: 3},
+				"POST /api/documents/{id}/sections/{index}":     {Rate: 0.2, Burst: 3},
+				"POST /api/documents/{id}/expand":               {Rate: 0.2, Burst: 3},
+				"POST /api/documents/":                          {Rate: 0.2, Burst: 3},
+				"POST /api/cards/{id}/retag":                    {Rate: 1, Burst: 5},
+				"GET /api/search/semantic":                      {Rate: 2, Burst: 10},
+				// 로그인은 IP별로 제한합니다.
+				"/auth/github":          {Rate: 0.5, Burst: 5},
+				"/auth/github/callback": {Rate: 0.5, Burst: 5},
+				// 실시간 편집 연산은 입력할 때마다 오므로 넉넉하게 둡니다.
+				"POST /api/documents/{id}/ops": {Rate: 50, Burst: 100},
+			},
+		},
+		Jobs: JobsConfig{
+			Workers:   2,
+			QueueSize: 100,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+			Path:    "/metrics",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "acornhub",
+			SampleRatio: 1.0,
+		},
+	}
+}
+
+// parseConfig는 기본값에 설정 파일, 환경 변수, 플래그를 차례로 덮어써 Config를 만듭니다.
+// 설정 파일 경로는 -config 플래그 또는 CONFIG_FILE 환경 변수로 지정합니다.
+func parseConfig(args []string) (*Config, error) {
+	c := defaultConfig()
+
+	fs := flag.NewFlagSet("acornhub", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML 또는 TOML 설정 파일 경로")
+	env := fs.String("env", "", "실행 환경 (dev, staging, prod)")
+	addr := fs.String("addr", "", "HTTP 리슨 주소 (예: :8080)")
+	publicURL := fs.String("public-url", "", "외부에서 접근하는 서버 URL")
+	dbPath := fs.String("db", "", "SQLite DB 파일 경로")
+	aiURL := fs.String("ai-url", "", "AI 서버 URL")
+	logLevel := fs.String("log-level", "", "로그 레벨 (debug, info, warn, error)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		if err := loadConfigFile(*configFile, c); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(c).Elem()); err != nil {
+		return nil, err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "env":
+			c.Env = *env
+		case "addr":
+			c.Server.Addr = *addr
+		case "public-url":
+			c.Server.PublicURL = *publicURL
+		case "db":
+			c.DB.Path = *dbPath
+		case "ai-url":
+			c.AI.ServerURL = *aiURL
+		case "log-level":
+			c.Log.Level = *logLevel
+		}
+	})
+
+	if c.GitHub.RedirectURL == "" {
+		c.GitHub.RedirectURL = strings.TrimRight(c.Server.PublicURL, "/") + "/auth/github/callback"
+	}
+	c.AI.ServerURL = strings.TrimRight(c.AI.ServerURL, "/")
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func loadConfigFile(path string, c *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("설정 파일 읽기 실패: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(strings.NewReader(string(data)))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil {
+			return fmt.Errorf("YAML 설정 파싱 실패 (%s): %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("TOML 설정 파싱 실패 (%s): %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("알 수 없는 설정 키 (%s): %v", path, undecoded)
+		}
+	default:
+		return fmt.Errorf("지원하지 않는 설정 파일 형식: %s (.yaml, .yml, .toml만 지원)", path)
+	}
+	return nil
+}
+
+// applyEnv는 env 태그가 붙은 필드를 해당 환경 변수 값으로 덮어씁니다.
+func applyEnv(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct && field.Type() != reflect.TypeOf(time.Duration(0)) {
+			if err := applyEnv(field); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := t.Field(i).Tag.Get("env")
+		raw, ok := os.LookupEnv(name)
+		if name == "" || !ok || raw == "" {
+			continue
+		}
+		if err := setFieldFromString(field, raw); err != nil {
+			return fmt.Errorf("환경 변수 %s 값이 잘못되었습니다: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setFieldFromString(field reflect.Value, raw string) error {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(raw)
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case int, int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("지원하지 않는 필드 타입 %s", field.Type())
+	}
+	return nil
+}
+
+func (c *Config) validate() error {
+	var errs []error
+
+	switch c.Env {
+	case "dev", "staging", "prod":
+	default:
+		errs = append(errs, fmt.Errorf("env는 dev, staging, prod 중 하나여야 합니다: %q", c.Env))
+	}
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr가 비어 있습니다"))
+	}
+	if c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server의 read/write/shutdown 타임아웃은 0보다 커야 합니다"))
+	}
+	if c.AI.HealthInterval <= 0 {
+		errs = append(errs, errors.New("ai.health_interval은 0보다 커야 합니다"))
+	}
+	if c.AI.DefaultTimeout <= 0 || c.AI.TagsTimeout <= 0 || c.AI.ClusterTimeout <= 0 || c.AI.AgentTimeout <= 0 || c.AI.StreamTimeout <= 0 {
+		errs = append(errs, errors.New("ai의 엔드포인트 타임아웃은 0보다 커야 합니다"))
+	}
+	if c.AI.AgentTimeout >= c.Server.WriteTimeout {
+		errs = append(errs, errors.New("ai.agent_timeout은 server.write_timeout보다 짧아야 합니다"))
+	}
+	if c.AI.MaxRetries < 0 || c.AI.RetryBackoff <= 0 {
+		errs = append(errs, errors.New("ai.max_retries는 0 이상, ai.retry_backoff는 0보다 커야 합니다"))
+	}
+	if c.AI.BreakerThreshold <= 0 || c.AI.BreakerOpenFor <= 0 {
+		errs = append(errs, errors.New("ai.breaker_threshold와 ai.breaker_open_for는 0보다 커야 합니다"))
+	}
+	if c.Classify.MinConfidence < -1 || c.Classify.MinConfidence > 1 {
+		errs = append(errs, fmt.Errorf("classify.min_confidence는 -1과 1 사이여야 합니다: %v", c.Classify.MinConfidence))
+	}
+	if !validClusterEngine(c.Cluster.Engine) {
+		errs = append(errs, fmt.Errorf("cluster.engine은 auto, ai, local 중 하나여야 합니다: %q", c.Cluster.Engine))
+	}
+	if !validTagEngine(c.Tags.Engine) {
+		errs = append(errs, fmt.Errorf("tags.engine은 auto, ai, local 중 하나여야 합니다: %q", c.Tags.Engine))
+	}
+	if c.Tags.MaxTags < 1 || c.Tags.MaxTags > 20 {
+		errs = append(errs, fmt.Errorf("tags.max_tags는 1~20 사이여야 합니다: %d", c.Tags.MaxTags))
+	}
+	if err := validRateLimit("rate_limit", RateLimitRule{Rate: c.Throttle.Rate, Burst: c.Throttle.Burst}); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validRateLimit("rate_limit.ip", RateLimitRule{Rate: c.Throttle.IPRate, Burst: c.Throttle.IPBurst}); err != nil {
+		errs = append(errs, err)
+	}
+	for route, rule := range c.Throttle.Routes {
+		if err := validRateLimit(fmt.Sprintf("rate_limit.routes[%q]", route), rule); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.Usage.DailyRequests < 0 || c.Usage.DailyTokens < 0 {
+		errs = append(errs, errors.New("usage.daily_requests와 usage.daily_tokens는 0 이상이어야 합니다 (0은 제한 없음)"))
+	}
+	if c.AI.EmbeddingModel == "" || c.AI.EmbeddingCacheSize <= 0 || c.AI.EmbeddingPruneInterval <= 0 {
+		errs = append(errs, errors.New("ai.embedding_model은 비어 있지 않고, ai.embedding_cache_size와 ai.embedding_prune_interval은 0보다 커야 합니다"))
+	}
+	if c.Jobs.Workers <= 0 || c.Jobs.QueueSize <= 0 {
+		errs = append(errs, errors.New("jobs.workers와 jobs.queue_size는 0보다 커야 합니다"))
+	}
+	if c.Metrics.Enabled && !strings.HasPrefix(c.Metrics.Path, "/") {
+		errs = append(errs, fmt.Errorf("metrics.path는 /로 시작해야 합니다: %q", c.Metrics.Path))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracing.sample_ratio는 0과 1 사이여야 합니다: %v", c.Tracing.SampleRatio))
+	}
+	if c.DB.Path == "" {
+		errs = append(errs, errors.New("database.path가 비어 있습니다"))
+	}
+	for name, raw := range map[string]string{
+		"server.public_url":   c.Server.PublicURL,
+		"github.redirect_url": c.GitHub.RedirectURL,
+		"ai.server_url":       c.AI.ServerURL,
+	} {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s가 올바른 http(s) URL이 아닙니다: %q", name, raw))
+		}
+	}
+
+	// 운영 환경에서는 로그인에 필요한 값과 HTTPS 콜백을 강제합니다.
+	if c.Env == "prod" {
+		if c.GitHub.ClientID == "" || c.GitHub.ClientSecret == "" {
+			errs = append(errs, errors.New("prod 환경에는 GitHub OAuth 클라이언트 ID/시크릿이 필요합니다"))
+		}
+		if !strings.HasPrefix(c.GitHub.RedirectURL, "https://") {
+			errs = append(errs, errors.New("prod 환경의 github.redirect_url은 https여야 합니다"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// redactedLines는 시크릿을 가린 "섹션.키=값" 목록을 반환합니다.
+func (c *Config) redactedLines() []string {
+	var lines []string
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			key := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			field := v.Field(i)
+			if field.Kind() == reflect.Struct && field.Type() != reflect.TypeOf(time.Duration(0)) {
+				walk(key, field)
+				continue
+			}
+			value := fmt.Sprint(field.Interface())
+			if f.Tag.Get("secret") == "true" && value != "" {
+				value = "********"
+			}
+			lines = append(lines, key+"="+value)
+		}
+	}
+	walk("", reflect.ValueOf(c).Elem())
+	return lines
+}
@@ -8,6 +8,7 @@ document.addEventListener("DOMContentLoaded", () => {
   const cardGridEl = document.getElementById("card-grid");
   const addDocumentBtn = document.getElementById("add-document-btn");
   const clusterBtn = document.getElementById("cluster-btn");
+  const clusterUndoBtn = document.getElementById("cluster-undo-btn");
 
   const listContainer = document.getElementById("document-list-container");
   const detailContainer = document.getElementById("document-detail-container");
@@ -22,6 +23,8 @@ document.addEventListener("DOMContentLoaded", () => {
   let projectDesc = "";
   let documents = [];
   let cards = [];
+  // 카테고리 이름 → "상위 > 하위" 경로 (하위 카테고리를 상위 카테고리 아래에 정렬해 보여 줍니다)
+  let categoryPaths = {};
 
   function getProjectIdFromUrl() {
     const params = new URLSearchParams(window.location.search);
@@ -61,6 +64,30 @@ document.addEventListener("DOMContentLoaded", () => {
     }
   }
 
+  async function fetchCategories(id) {
+    try {
+      const response = await fetch(`${PROJECTS_API_URL}${id}/categories`, {
+        credentials: "include",
+      });
+      if (!response.ok) {
+        throw new Error(`HTTP error! status: ${response.status}`);
+      }
+      const tree = await response.json();
+      categoryPaths = {};
+      const walk = (nodes, prefix) => {
+        nodes.forEach((node) => {
+          const path = prefix ? `${prefix} > ${node.category_name}` : node.category_name;
+          categoryPaths[node.category_name] = path;
+          walk(node.children || [], path);
+        });
+      };
+      walk(tree || [], "");
+    } catch (error) {
+      console.error("Error fetching categories:", error);
+      categoryPaths = {};
+    }
+  }
+
   async function fetchDocuments(id) {
     try {
       const response = await fetch(`${DOCUMENTS_API_URL}?project_id=${id}`, {
@@ -80,6 +107,7 @@ document.addEventListener("DOMContentLoaded", () => {
   async function loadData() {
     await fetchProjectDetails(projectId);
     await fetchCards(projectId);
+    await fetchCategories(projectId);
     await fetchDocuments(projectId);
   }
 
@@ -102,10 +130,11 @@ document.addEventListener("DOMContentLoaded", () => {
       return acc;
     }, {});
 
+    const categoryPath = (category) => categoryPaths[category] || category;
     const sortedCategories = Object.keys(groupedCards).sort((a, b) => {
       if (a === "미분류") return 1;
       if (b === "미분류") return -1;
-      return a.localeCompare(b);
+      return categoryPath(a).localeCompare(categoryPath(b));
     });
 
     sortedCategories.forEach((category) => {
@@ -114,7 +143,7 @@ document.addEventListener("DOMContentLoaded", () => {
 
       const categoryTitle = document.createElement("h2");
       categoryTitle.className = "category-title";
-      categoryTitle.textContent = category;
+      categoryTitle.textContent = categoryPath(category);
       categorySection.appendChild(categoryTitle);
 
       const innerGrid = document.createElement("div");
@@ -164,6 +193,14 @@ document.addEventListener("DOMContentLoaded", () => {
       <button class="card-delete-btn">&times;</button>
     `;
 
+    // 자동 분류 유사도가 낮아 '미분류'로 남은 카드에는 가장 가까운 카테고리를 보여 줍니다.
+    if (card.suggested_category && (card.category || "미분류") === "미분류") {
+      const suggestionEl = document.createElement("div");
+      suggestionEl.className = "card-suggestion";
+      suggestionEl.textContent = `추천 카테고리: ${card.suggested_category}`;
+      cardEl.firstElementChild.appendChild(suggestionEl);
+    }
+
     cardEl.addEventListener("click", (e) => {
       if (e.target.classList.contains("card-delete-btn")) return;
       openCardModal(card);
@@ -194,8 +231,24 @@ document.addEventListener("DOMContentLoaded", () => {
     renderDocumentList();
   }
 
-  function showDetailView(docId) {
-    const doc = documents.find((d) => d.id === docId);
+  // 목록 응답에는 content_html과 toc가 없으므로 문서 하나를 다시 받아 표시합니다.
+  async function fetchDocument(docId) {
+    try {
+      const response = await fetch(`${DOCUMENTS_API_URL}${docId}`, {
+        credentials: "include",
+      });
+      if (!response.ok) {
+        throw new Error(`HTTP error! status: ${response.status}`);
+      }
+      return await response.json();
+    } catch (error) {
+      console.error("Error fetching document:", error);
+      return null;
+    }
+  }
+
+  async function showDetailView(docId) {
+    const doc = await fetchDocument(docId);
     if (!doc) {
       console.error(`Document with id ${docId} not found.`);
       showListView();
@@ -219,6 +272,10 @@ document.addEventListener("DOMContentLoaded", () => {
       <html>
       <head>
         <meta charset="UTF-8">
+        <link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/katex@0.16.11/dist/katex.min.css">
+        <script defer src="https://cdn.jsdelivr.net/npm/katex@0.16.11/dist/katex.min.js"></script>
+        <script defer src="https://cdn.jsdelivr.net/npm/katex@0.16.11/dist/contrib/auto-render.min.js"
+          onload="renderMathInElement(document.body)"></script>
         <style>
           body {
             margin: 0;
@@ -239,15 +296,68 @@ document.addEventListener("DOMContentLoaded", () => {
           p {
             margin-bottom: 1rem;
           }
+          sup.citation {
+            color: #b08968;
+            font-size: 0.7em;
+            cursor: help;
+          }
+          nav.toc {
+            display: flex;
+            flex-direction: column;
+            gap: 0.25rem;
+            padding: 0.75rem 1rem;
+            margin-bottom: 1.5rem;
+            border-left: 3px solid #e6dcd3;
+            font-size: 0.9rem;
+          }
+          nav.toc a {
+            color: #8c7b70;
+            text-decoration: none;
+          }
+          table {
+            border-collapse: collapse;
+            margin-bottom: 1rem;
+          }
+          th, td {
+            border: 1px solid #e6dcd3;
+            padding: 0.4rem 0.75rem;
+          }
+          pre {
+            background: #f7f3ef;
+            padding: 0.75rem 1rem;
+            overflow-x: auto;
+          }
+          .footnotes {
+            font-size: 0.85rem;
+          }
         </style>
       </head>
       <body>
-        ${doc.content}
+        ${doc.content_html}
       </body>
       </html>
     `);
     iframeDoc.close();
 
+    // content_html은 서버가 정리한 HTML이고, 목차 제목은 textContent로만 넣습니다.
+    if (doc.toc && doc.toc.length > 1) {
+      const minLevel = Math.min(...doc.toc.map((entry) => entry.level));
+      const nav = iframeDoc.createElement("nav");
+      nav.className = "toc";
+      doc.toc.forEach((entry) => {
+        const link = iframeDoc.createElement("a");
+        link.href = `#${entry.id}`;
+        link.textContent = entry.title;
+        link.style.paddingLeft = `${entry.level - minLevel}rem`;
+        link.addEventListener("click", (event) => {
+          event.preventDefault();
+          iframeDoc.getElementById(entry.id)?.scrollIntoView({ behavior: "smooth" });
+        });
+        nav.appendChild(link);
+      });
+      iframeDoc.body.prepend(nav);
+    }
+
     document
       .getElementById("back-to-list-btn")
       .addEventListener("click", showListView);
@@ -284,16 +394,49 @@ document.addEventListener("DOMContentLoaded", () => {
     });
   }
 
-  async function handleClusterCards() {
-    if (!confirm("카드를 자동으로 분류할까요? 기존 카테고리 정보는 사라집니다.")) return;
+  // 되돌리지 않은 가장 최근 클러스터링을 되돌립니다.
+  async function handleUndoClustering() {
+    try {
+      const response = await fetch(`${PROJECTS_API_URL}${projectId}/cluster-runs`, {
+        credentials: "include",
+      });
+      if (!response.ok) throw new Error(`클러스터링 기록 조회 실패: ${await response.text()}`);
+
+      const runs = await response.json();
+      const latest = runs.find((run) => !run.reverted_at);
+      if (!latest) {
+        alert("되돌릴 클러스터링이 없습니다.");
+        return;
+      }
+      const when = new Date(latest.created_at).toLocaleString();
+      if (!confirm(`${when}에 실행한 분류(카드 ${latest.card_count}개)를 되돌릴까요?`)) return;
+
+      const revertResponse = await fetch(
+        `${PROJECTS_API_URL}${projectId}/cluster-runs/${latest.id}/revert`,
+        { method: "POST", credentials: "include" }
+      );
+      if (!revertResponse.ok) throw new Error(`되돌리기 실패: ${await revertResponse.text()}`);
+
+      await fetchCards(projectId);
+      await fetchCategories(projectId);
+      renderCards();
+    } catch (error) {
+      console.error(error);
+      alert(error.message);
+    }
+  }
 
+  async function handleClusterCards() {
     clusterBtn.textContent = "분류 중...";
     clusterBtn.disabled = true;
 
     try {
+      // 먼저 저장하지 않고 분류 제안만 받아 사용자에게 보여 줍니다.
       const response = await fetch(`${CLUSTER_API_URL}?project_id=${projectId}`, {
         method: "POST",
         credentials: "include",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ dry_run: true }),
       });
 
       if (!response.ok) {
@@ -301,7 +444,26 @@ document.addEventListener("DOMContentLoaded", () => {
         throw new Error(`클러스터링 실패: ${errorText}`);
       }
 
+      const proposal = await response.json();
+      const summary = proposal.clusters
+        .map((c) => `- ${c.category_name}: 카드 ${c.card_ids.length}개`)
+        .join("\n");
+      if (!confirm(`다음과 같이 분류할까요? 기존 카테고리 정보는 사라집니다.\n\n${summary}`)) return;
+
+      const applyResponse = await fetch(`/api/projects/${projectId}/cluster/apply`, {
+        method: "POST",
+        credentials: "include",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(proposal),
+      });
+
+      if (!applyResponse.ok) {
+        const errorText = await applyResponse.text();
+        throw new Error(`분류 적용 실패: ${errorText}`);
+      }
+
       await fetchCards(projectId);
+      await fetchCategories(projectId);
       renderCards();
 
     } catch (error) {
@@ -380,10 +542,12 @@ document.addEventListener("DOMContentLoaded", () => {
   async function handleAddDocument() {
     const title = prompt("새 문서의 제목을 입력하세요.");
     if (!title || title.trim() === "") return;
+    // 취소를 누르면 AI 서버를 거치지 않고 빈 메모를 만듭니다. 나중에 AI로 확장할 수 있습니다.
+    const mode = confirm("AI로 보고서 초안을 생성할까요?\n(취소를 누르면 직접 작성할 빈 메모를 만듭니다)") ? "ai" : "manual";
 
     const originalButtonText = addDocumentBtn.textContent;
     addDocumentBtn.disabled = true;
-    addDocumentBtn.textContent = "AI 초안 생성 중...";
+    addDocumentBtn.textContent = mode === "ai" ? "AI 초안 생성 중..." : "문서 만드는 중...";
 
     try {
       const response = await fetch(DOCUMENTS_API_URL, {
@@ -393,6 +557,7 @@ document.addEventListener("DOMContentLoaded", () => {
         body: JSON.stringify({
           title: title.trim(),
           project_id: parseInt(projectId, 10),
+          mode,
         }),
       });
 
@@ -438,6 +603,58 @@ document.addEventListener("DOMContentLoaded", () => {
     }
   }
 
+  // 다른 창이나 사용자가 이 프로젝트를 바꾸면 서버가 SSE로 알려줍니다.
+  // 이벤트가 몰려올 수 있으므로 잠시 모았다가 한 번에 다시 불러옵니다.
+  function subscribeProjectEvents() {
+    const source = new EventSource(`${PROJECTS_API_URL}${projectId}/events`, {
+      withCredentials: true,
+    });
+    let reloadCards = false;
+    let reloadDocuments = false;
+    let reloadTimer = null;
+
+    function scheduleReload() {
+      if (reloadTimer) return;
+      reloadTimer = setTimeout(async () => {
+        reloadTimer = null;
+        if (reloadCards) {
+          reloadCards = false;
+          await fetchCards(projectId);
+          await fetchCategories(projectId);
+          renderCards();
+        }
+        if (reloadDocuments) {
+          reloadDocuments = false;
+          await fetchDocuments(projectId);
+          if (listContainer.style.display !== "none") renderDocumentList();
+        }
+      }, 300);
+    }
+
+    ["card.created", "card.updated", "card.deleted", "cards.clustered", "cards.cluster_reverted", "category.moved"].forEach((type) => {
+      source.addEventListener(type, () => {
+        reloadCards = true;
+        scheduleReload();
+      });
+    });
+    ["document.created", "document.updated", "document.deleted"].forEach((type) => {
+      source.addEventListener(type, () => {
+        reloadDocuments = true;
+        scheduleReload();
+      });
+    });
+    // 연결이 끊겼다 다시 연결되면 그 사이 놓친 변경이 있을 수 있으므로 전체를 다시 불러옵니다.
+    let connectedOnce = false;
+    source.addEventListener("open", () => {
+      if (connectedOnce) {
+        reloadCards = true;
+        reloadDocuments = true;
+        scheduleReload();
+      }
+      connectedOnce = true;
+    });
+  }
+
   async function init() {
     projectId = getProjectIdFromUrl();
     if (!projectId) {
@@ -450,12 +667,14 @@ document.addEventListener("DOMContentLoaded", () => {
     modalCloseBtn.addEventListener("click", closeCardModal);
     modalOverlay.addEventListener("click", closeCardModal);
     clusterBtn.addEventListener("click", handleClusterCards);
+    clusterUndoBtn.addEventListener("click", handleUndoClustering);
 
     await loadData();
     renderCards();
     showListView();
 
     addDocumentBtn.addEventListener("click", handleAddDocument);
+    subscribeProjectEvents();
   }
 
   init();
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReportTemplate은 프로젝트별로 저장해 두고 보고서 생성 시 재사용하는 문서 형식입니다.
+type ReportTemplate struct {
+	ID        int64     `json:"id"`
+	ProjectID int64     `json:"project_id"`
+	Name      string    `json:"name"`
+	Sections  []string  `json:"sections"`
+	Tone      string    `json:"tone"`
+	Length    string    `json:"length"`
+	Language  string    `json:"language"`
+	Audience  string    `json:"audience"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GenerationOptions는 문서 생성 요청의 generation_options입니다.
+// 요청에서는 template_id로 템플릿을 고르고 일부 항목만 덮어쓸 수 있으며,
+// 문서에는 템플릿을 적용한 최종 값이 저장되어 나중에 템플릿이 바뀌어도 같은 조건으로 다시 생성할 수 있습니다.
+type GenerationOptions struct {
+	TemplateID   int64    `json:"template_id,omitempty"`
+	TemplateName string   `json:"template_name,omitempty"`
+	Sections     []string `json:"sections,omitempty"`
+	Tone         string   `json:"tone,omitempty"`
+	Length       string   `json:"length,omitempty"`
+	Language     string   `json:"language,omitempty"`
+	Audience     string   `json:"audience,omitempty"`
+	// Categories와 CardIDs를 지정하면 그 카테고리의 카드와 지정한 카드만 보고서에 사용합니다.
+	Categories []string `json:"categories,omitempty"`
+	CardIDs    []int64  `json:"card_ids,omitempty"`
+}
+
+// AgentReportOptions는 AI 서버에 전달하는 보고서 형식입니다.
+type AgentReportOptions struct {
+	Sections []string `json:"sections,omitempty"`
+	Tone     string   `json:"tone,omitempty"`
+	Length   string   `json:"length,omitempty"`
+	Language string   `json:"language,omitempty"`
+	Audience string   `json:"audience,omitempty"`
+}
+
+// errInvalidOptions는 사용자가 보낸 템플릿이나 생성 옵션이 잘못되었을 때 반환됩니다 (400).
+var errInvalidOptions = errors.New("잘못된 생성 옵션")
+
+const (
+	maxTemplateSections = 12
+	maxOptionTextLen    = 200
+)
+
+var validReportLengths = map[string]bool{"": true, "short": true, "medium": true, "long": true}
+
+// validateReportFormat은 템플릿과 생성 옵션이 공유하는 형식 항목을 검사합니다.
+func validateReportFormat(sections []string, tone, length, language, audience string) error {
+	if len(sections) > maxTemplateSections {
+		return fmt.Errorf("%w: 섹션은 %d개까지 지정할 수 있습니다", errInvalidOptions, maxTemplateSections)
+	}
+	for _, s := range sections {
+		if strings.TrimSpace(s) == "" || len([]rune(s)) > maxOptionTextLen {
+			return fmt.Errorf("%w: 섹션 이름은 비어 있지 않고 %d자 이하여야 합니다", errInvalidOptions, maxOptionTextLen)
+		}
+	}
+	if !validReportLengths[length] {
+		return fmt.Errorf("%w: length는 short, medium, long 중 하나여야 합니다", errInvalidOptions)
+	}
+	for name, v := range map[string]string{"tone": tone, "language": language, "audience": audience} {
+		if len([]rune(v)) > maxOptionTextLen {
+			return fmt.Errorf("%w: %s는 %d자 이하여야 합니다", errInvalidOptions, name, maxOptionTextLen)
+		}
+	}
+	return nil
+}
+
+// resolveGenerationOptions는 요청의 생성 옵션에 템플릿을 적용해 문서에 저장할 최종 옵션을 만듭니다.
+// 요청에 옵션이 없으면 nil을 반환합니다 (기본 형식).
+func resolveGenerationOptions(ctx context.Context, projectID, userID int64, in *GenerationOptions) (*GenerationOptions, error) {
+	if in == nil {
+		return nil, nil
+	}
+	out := *in
+	out.TemplateName = ""
+
+	if in.TemplateID != 0 {
+		t, err := getTemplate(ctx, in.TemplateID, userID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && t.ProjectID != projectID) {
+			return nil, fmt.Errorf("%w: 이 프로젝트에서 템플릿 %d을 찾을 수 없습니다", errInvalidOptions, in.TemplateID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		out.TemplateName = t.Name
+		// 요청에 지정한 항목이 템플릿보다 우선합니다.
+		if len(out.Sections) == 0 {
+			out.Sections = t.Sections
+		}
+		if out.Tone == "" {
+			out.Tone = t.Tone
+		}
+		if out.Length == "" {
+			out.Length = t.Length
+		}
+		if out.Language == "" {
+			out.Language = t.Language
+		}
+		if out.Audience == "" {
+			out.Audience = t.Audience
+		}
+	}
+
+	if err := validateReportFormat(out.Sections, out.Tone, out.Length, out.Language, out.Audience); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// agentOptions는 생성 옵션 중 AI 서버에 전달할 형식 항목만 골라냅니다.
+func (o *GenerationOptions) agentOptions() *AgentReportOptions {
+	if o == nil {
+		return nil
+	}
+	return &AgentReportOptions{
+		Sections: o.Sections,
+		Tone:     o.Tone,
+		Length:   o.Length,
+		Language: o.Language,
+		Audience: o.Audience,
+	}
+}
+
+// cardSelection은 생성 옵션의 카테고리·카드 선택을 카드 ID 집합으로 바꿉니다.
+// 선택이 없으면 nil(모든 카드)을 반환합니다.
+func (o *GenerationOptions) cardSelection(cards []CardForAI, categories []CategoryInfo) (map[int64]bool, error) {
+	if o == nil || (len(o.Categories) == 0 && len(o.CardIDs) == 0) {
+		return nil, nil
+	}
+
+	projectCards := projectCardSet(cards)
+	selected := make(map[int64]bool)
+	for _, id := range o.CardIDs {
+		if !projectCards[id] {
+			return nil, fmt.Errorf("%w: 프로젝트에 카드 %d이 없습니다", errInvalidOptions, id)
+		}
+		selected[id] = true
+	}
+	for _, name := range o.Categories {
+		// 상위 카테고리를 고르면 하위 카테고리의 카드도 함께 고릅니다.
+		category := findCategory(categories, name)
+		if category == nil {
+			return nil, fmt.Errorf("%w: 프로젝트에 카테고리 %q가 없습니다", errInvalidOptions, name)
+		}
+		for _, id := range category.allCardIDs() {
+			selected[id] = true
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("%w: 선택한 카테고리에 카드가 없습니다", errInvalidOptions)
+	}
+	return selected, nil
+}
+
+// filterSelectedCards는 선택한 카드만 남기고, 카테고리 트리도 선택한 카드가 있는 가지만 담도록 줄입니다.
+func filterSelectedCards(cards []CardForAI, categories []CategoryInfo, selected map[int64]bool) ([]CardForAI, []CategoryInfo) {
+	var keptCards []CardForAI
+	for _, c := range cards {
+		if selected[c.ID] {
+			keptCards = append(keptCards, c)
+		}
+	}
+	return keptCards, filterCategories(categories, selected)
+}
+
+func filterCategories(categories []CategoryInfo, selected map[int64]bool) []CategoryInfo {
+	var kept []CategoryInfo
+	for _, c := range categories {
+		ids := []int64{}
+		for _, id := range c.CardIDs {
+			if selected[id] {
+				ids = append(ids, id)
+			}
+		}
+		children := filterCategories(c.Children, selected)
+		if len(ids) > 0 || len(children) > 0 {
+			kept = append(kept, CategoryInfo{CategoryName: c.CategoryName, CardIDs: ids, Children: children})
+		}
+	}
+	return kept
+}
+
+// prepareAgentRequest는 문서 생성 요청의 generation_options를 확정하고 AI 서버 요청을 만듭니다.
+// 확정된 옵션은 doc.GenerationOptions에 담겨 문서와 함께 저장됩니다.
+// 실패하면 오류 응답을 쓰고 false를 반환합니다.
+func prepareAgentRequest(w http.ResponseWriter, r *http.Request, doc *Document) (AgentInvokeRequest, bool) {
+	opts, err := resolveGenerationOptions(r.Context(), doc.ProjectID, doc.UserID, doc.GenerationOptions)
+	if err == nil {
+		doc.GenerationOptions = opts
+		var req AgentInvokeRequest
+		if req, err = buildAgentRequest(r.Context(), doc.Title, doc.ProjectID, doc.UserID, opts); err == nil {
+			req.DocType = doc.DocType
+			return req, true
+		}
+	}
+	if errors.Is(err, errInvalidOptions) {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+	} else {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+	}
+	return AgentInvokeRequest{}, false
+}
+
+// parseGenerationOptions는 documents.generation_options 열의 JSON을 읽습니다. 없거나 읽을 수 없으면 nil입니다.
+func parseGenerationOptions(s sql.NullString) *GenerationOptions {
+	if !s.Valid || s.String == "" {
+		return nil
+	}
+	var opts GenerationOptions
+	if err := json.Unmarshal([]byte(s.String), &opts); err != nil {
+		return nil
+	}
+	return &opts
+}
+
+func getTemplate(ctx context.Context, templateID, userID int64) (ReportTemplate, error) {
+	var t ReportTemplate
+	var sections string
+	err := db.QueryRowContext(ctx,
+		"SELECT id, project_id, name, sections, tone, length, language, audience, created_at, updated_at FROM report_templates WHERE id = ? AND user_id = ?",
+		templateID, userID,
+	).Scan(&t.ID, &t.ProjectID, &t.Name, &sections, &t.Tone, &t.Length, &t.Language, &t.Audience, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return t, err
+	}
+	err = json.Unmarshal([]byte(sections), &t.Sections)
+	return t, err
+}
+
+// decodeTemplate은 요청 본문의 템플릿을 읽고 검사합니다.
+func decodeTemplate(w http.ResponseWriter, r *http.Request) (ReportTemplate, bool) {
+	var t ReportTemplate
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		httpError(w, r, "잘못된 JSON 형식", http.StatusBadRequest)
+		return t, false
+	}
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		httpError(w, r, "템플릿 이름이 필요합니다", http.StatusBadRequest)
+		return t, false
+	}
+	if t.Sections == nil {
+		t.Sections = []string{}
+	}
+	if err := validateReportFormat(t.Sections, t.Tone, t.Length, t.Language, t.Audience); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return t, false
+	}
+	return t, true
+}
+
+// handleProjectTemplates는 GET, POST /api/projects/{id}/templates 요청을 처리합니다.
+func handleProjectTemplates(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+	projectID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 프로젝트 ID", http.StatusBadRequest)
+		return
+	}
+
+	var projectOwnerID int64
+	err = db.QueryRowContext(r.Context(), "SELECT user_id FROM projects WHERE id = ?", projectID).Scan(&projectOwnerID)
+	if err != nil || projectOwnerID != userID {
+		httpError(w, r, "프로젝트를 찾을 수 없거나 권한이 없습니다", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		rows, err := db.QueryContext(r.Context(),
+			"SELECT id, project_id, name, sections, tone, length, language, audience, created_at, updated_at FROM report_templates WHERE project_id = ? AND user_id = ? ORDER BY name",
+			projectID, userID,
+		)
+		if err != nil {
+			httpError(w, r, "템플릿 목록 조회 실패", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		templates := []ReportTemplate{}
+		for rows.Next() {
+			var t ReportTemplate
+			var sections string
+			if err := rows.Scan(&t.ID, &t.ProjectID, &t.Name, &sections, &t.Tone, &t.Length, &t.Language, &t.Audience, &t.CreatedAt, &t.UpdatedAt); err != nil {
+				httpError(w, r, "DB 스캔 실패", http.StatusInternalServerError)
+				return
+			}
+			json.Unmarshal([]byte(sections), &t.Sections)
+			templates = append(templates, t)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(templates)
+
+	case "POST":
+		t, ok := decodeTemplate(w, r)
+		if !ok {
+			return
+		}
+		sections, _ := json.Marshal(t.Sections)
+		result, err := db.ExecContext(r.Context(),
+			"INSERT INTO report_templates (project_id, user_id, name, sections, tone, length, language, audience) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			projectID, userID, t.Name, string(sections), t.Tone, t.Length, t.Language, t.Audience,
+		)
+		if err != nil {
+			httpError(w, r, "템플릿 생성 실패: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		templateID, err := result.LastInsertId()
+		if err != nil {
+			httpError(w, r, "템플릿 ID 가져오기 실패", http.StatusInternalServerError)
+			return
+		}
+		if t, err = getTemplate(r.Context(), templateID, userID); err != nil {
+			httpError(w, r, "생성된 템플릿 조회 실패", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(t)
+
+	default:
+		httpError(w, r, "지원하지 않는 메소드", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTemplate은 GET, PUT, DELETE /api/templates/{id} 요청을 처리합니다.
+func handleTemplate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+	templateID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "잘못된 id 경로", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		t, err := getTemplate(r.Context(), templateID, userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				httpError(w, r, "템플릿을 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+			} else {
+				httpError(w, r, "템플릿 조회 실패", http.StatusInternalServerError)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t)
+
+	case "PUT":
+		t, ok := decodeTemplate(w, r)
+		if !ok {
+			return
+		}
+		sections, _ := json.Marshal(t.Sections)
+		result, err := db.ExecContext(r.Context(),
+			"UPDATE report_templates SET name = ?, sections = ?, tone = ?, length = ?, language = ?, audience = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ?",
+			t.Name, string(sections), t.Tone, t.Length, t.Language, t.Audience, templateID, userID,
+		)
+		if err != nil {
+			httpError(w, r, "템플릿 수정 실패", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			httpError(w, r, "템플릿을 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+			return
+		}
+		if t, err = getTemplate(r.Context(), templateID, userID); err != nil {
+			httpError(w, r, "수정된 템플릿 조회 실패", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t)
+
+	case "DELETE":
+		// 이미 생성된 문서에는 템플릿을 적용한 값이 저장되어 있으므로 템플릿을 지워도 영향이 없습니다.
+		result, err := db.ExecContext(r.Context(), "DELETE FROM report_templates WHERE id = ? AND user_id = ?", templateID, userID)
+		if err != nil {
+			httpError(w, r, "템플릿 삭제 실패", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			httpError(w, r, "템플릿을 찾을 수 없거나 권한이 없습니다", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		httpError(w, r, "지원하지 않는 메소드", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// AI 사용량 기록과 일일 한도
+//
+// AI 서버 호출(aiPost의 시도 하나, aiOpenStream의 스트림 하나)마다 사용자, 프로젝트, 엔드포인트,
+// 요청 크기, 걸린 시간, AI 서버가 알려 준 토큰 수를 ai_usage 테이블에 남깁니다.
+// 토큰 수는 응답 헤더(X-AI-Input-Tokens, X-AI-Output-Tokens)로 받고, 스트림은 끝에 오는 usage 이벤트로 받습니다.
+// usage.daily_requests나 usage.daily_tokens가 0보다 크면 사용자의 오늘(UTC) 사용량이 한도에 닿았을 때
+// AI 서버를 호출하지 않고 *aiQuotaError를 반환합니다. 로컬 엔진으로 대신할 수 있는 기능은 그대로 대신합니다.
+// 호출 수 한도는 성공한(status = 'ok') 호출만 세므로 실패한 시도와 재시도는 한도를 쓰지 않습니다.
+// 한도는 호출을 시작할 때 한 번만 검사하고 따로 잠그지 않으므로, 한도 직전에 동시에 보낸 호출들은
+// 모두 통과해 한도를 조금 넘을 수 있습니다. 넘은 만큼은 다음 호출부터 막힙니다.
+
+const (
+	aiInputTokensHeader  = "X-AI-Input-Tokens"
+	aiOutputTokensHeader = "X-AI-Output-Tokens"
+	aiUsageEvent         = "usage"
+
+	usageStatusOK    = "ok"
+	usageStatusError = "error"
+
+	maxUsageDays = 31
+)
+
+// aiTokens는 AI 서버가 호출 하나에 쓴 LLM 토큰 수입니다.
+type aiTokens struct {
+	Input  int64 `json:"input_tokens"`
+	Output int64 `json:"output_tokens"`
+}
+
+func tokensFromHeader(h http.Header) aiTokens {
+	input, _ := strconv.ParseInt(h.Get(aiInputTokensHeader), 10, 64)
+	output, _ := strconv.ParseInt(h.Get(aiOutputTokensHeader), 10, 64)
+	return aiTokens{Input: input, Output: output}
+}
+
+// aiQuotaError는 사용자가 오늘 AI 사용 한도를 모두 써서 호출하지 않았을 때 반환됩니다.
+type aiQuotaError struct {
+	Limit      string // "requests" 또는 "tokens"
+	Max        int64
+	RetryAfter time.Duration
+}
+
+func (e *aiQuotaError) Error() string {
+	if e.Limit == "tokens" {
+		return fmt.Sprintf("오늘 AI 토큰 한도(%d)를 모두 사용했습니다", e.Max)
+	}
+	return fmt.Sprintf("오늘 AI 호출 한도(%d회)를 모두 사용했습니다", e.Max)
+}
+
+// setUsageProject는 이후 AI 호출을 projectID 프로젝트의 사용량으로 기록하게 합니다.
+func setUsageProject(ctx context.Context, projectID int64) {
+	if info := requestInfoFrom(ctx); info != nil {
+		info.ProjectID = projectID
+	}
+}
+
+// usageDayStart는 t가 속한 날(UTC)의 0시입니다. 일일 한도는 이 시각부터 다시 셉니다.
+func usageDayStart(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// sqliteTime은 CURRENT_TIMESTAMP로 저장된 created_at과 문자열로 비교할 수 있는 형식입니다.
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(time.DateTime)
+}
+
+// checkAIQuota는 ctx의 사용자가 오늘 한도를 넘었으면 *aiQuotaError를 반환합니다.
+// 한도가 없거나 사용자가 없는 호출은 검사하지 않고, 사용량 조회에 실패하면 호출을 막지 않습니다.
+func checkAIQuota(ctx context.Context) error {
+	info := requestInfoFrom(ctx)
+	if info == nil || info.UserID == 0 || (cfg.Usage.DailyRequests == 0 && cfg.Usage.DailyTokens == 0) {
+		return nil
+	}
+	now := time.Now()
+	dayStart := usageDayStart(now)
+	var requests, tokens int64
+	err := db.QueryRowContext(ctx,
+		"SELECT COALESCE(SUM(status = ?), 0), COALESCE(SUM(input_tokens + output_tokens), 0) FROM ai_usage WHERE user_id = ? AND created_at >= ?",
+		usageStatusOK, info.UserID, sqliteTime(dayStart),
+	).Scan(&requests, &tokens)
+	if err != nil {
+		slog.Warn("AI 사용량 조회 실패, 한도 검사를 건너뜁니다", "request_id", info.ID, "user_id", info.UserID, "error", err)
+		return nil
+	}
+
+	retryAfter := dayStart.Add(24 * time.Hour).Sub(now)
+	if limit := int64(cfg.Usage.DailyRequests); limit > 0 && requests >= limit {
+		return &aiQuotaError{Limit: "requests", Max: limit, RetryAfter: retryAfter}
+	}
+	if limit := cfg.Usage.DailyTokens; limit > 0 && tokens >= limit {
+		return &aiQuotaError{Limit: "tokens", Max: limit, RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// recordAIUsage는 AI 서버 호출 하나를 ai_usage에 남깁니다.
+// AI 서버에 연결조차 하지 못한 호출은 AI 서버가 일하지 않았으므로 기록하지 않습니다.
+// 기록 실패는 로그만 남기고 호출 결과에는 영향을 주지 않습니다.
+func recordAIUsage(info *requestInfo, path string, inputBytes int, duration time.Duration, tokens aiTokens, callErr error) {
+	var opErr *net.OpError
+	if errors.As(callErr, &opErr) && opErr.Op == "dial" {
+		return
+	}
+	var userID, projectID int64
+	var requestID string
+	if info != nil {
+		userID, projectID, requestID = info.UserID, info.ProjectID, info.ID
+	}
+	status := usageStatusOK
+	if callErr != nil {
+		status = usageStatusError
+	}
+
+	// 호출한 요청이 취소되었더라도 AI 서버는 이미 일을 했을 수 있으므로 요청 ctx와 무관하게 기록합니다.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO ai_usage (user_id, project_id, endpoint, input_bytes, duration_ms, input_tokens, output_tokens, status) VALUES (?, NULLIF(?, 0), ?, ?, ?, ?, ?, ?)",
+		userID, projectID, path, inputBytes, duration.Milliseconds(), tokens.Input, tokens.Output, status,
+	)
+	if err != nil {
+		slog.Warn("AI 사용량 기록 실패", "request_id", requestID, "endpoint", path, "error", err)
+	}
+}
+
+// UsageTotals는 기간 동안의 AI 호출 합계입니다.
+type UsageTotals struct {
+	Requests     int64 `json:"requests"`
+	Errors       int64 `json:"errors"`
+	InputBytes   int64 `json:"input_bytes"`
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+	DurationMS   int64 `json:"duration_ms"`
+}
+
+// UsageDay는 하루(UTC)의 사용량입니다. Date는 YYYY-MM-DD입니다.
+type UsageDay struct {
+	Date string `json:"date"`
+	UsageTotals
+}
+
+// UsageEndpoint는 AI 엔드포인트별 사용량입니다.
+type UsageEndpoint struct {
+	Endpoint string `json:"endpoint"`
+	UsageTotals
+}
+
+// UsageLimit은 일일 한도와 오늘 남은 양입니다. Max가 0이면 제한이 없고 Remaining은 비어 있습니다.
+// 호출 수 한도의 Used는 checkAIQuota와 같이 성공한 호출만 셉니다.
+type UsageLimit struct {
+	Max       int64  `json:"max"`
+	Used      int64  `json:"used"`
+	Remaining *int64 `json:"remaining,omitempty"`
+}
+
+// UsageResponse는 GET /api/me/usage 응답입니다.
+type UsageResponse struct {
+	Today     UsageTotals           `json:"today"`
+	Limits    map[string]UsageLimit `json:"limits"`
+	ResetAt   time.Time             `json:"reset_at"`
+	Days      []UsageDay            `json:"days"`
+	Endpoints []UsageEndpoint       `json:"endpoints"`
+}
+
+const usageTotalsColumns = `COUNT(*), COALESCE(SUM(status = 'error'), 0), COALESCE(SUM(input_bytes), 0),
+	COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0), COALESCE(SUM(duration_ms), 0)`
+
+func (t *UsageTotals) scanDest() []interface{} {
+	return []interface{}{&t.Requests, &t.Errors, &t.InputBytes, &t.InputTokens, &t.OutputTokens, &t.DurationMS}
+}
+
+// handleMyUsage는 GET /api/me/usage?days=7 요청을 처리합니다.
+// 오늘 사용량과 한도, 최근 days일(오늘 포함, 기본 7일)의 날짜별·엔드포인트별 사용량을 반환합니다.
+func handleMyUsage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userContextKey).(int64)
+	if !ok {
+		httpError(w, r, "서버 내부 오류: 유저 ID를 찾을 수 없음", http.StatusInternalServerError)
+		return
+	}
+	days := 7
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxUsageDays {
+			httpError(w, r, fmt.Sprintf("days는 1~%d 사이여야 합니다", maxUsageDays), http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	today := usageDayStart(time.Now())
+	since := sqliteTime(today.AddDate(0, 0, -(days - 1)))
+	resp := UsageResponse{ResetAt: today.Add(24 * time.Hour), Days: []UsageDay{}, Endpoints: []UsageEndpoint{}}
+
+	err := db.QueryRowContext(r.Context(),
+		"SELECT "+usageTotalsColumns+" FROM ai_usage WHERE user_id = ? AND created_at >= ?",
+		userID, sqliteTime(today),
+	).Scan(resp.Today.scanDest()...)
+	if err != nil {
+		httpError(w, r, "AI 사용량 조회 실패", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(),
+		"SELECT date(created_at), "+usageTotalsColumns+" FROM ai_usage WHERE user_id = ? AND created_at >= ? GROUP BY date(created_at) ORDER BY date(created_at) DESC",
+		userID, since,
+	)
+	if err != nil {
+		httpError(w, r, "AI 사용량 조회 실패", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d UsageDay
+		if err := rows.Scan(append([]interface{}{&d.Date}, d.scanDest()...)...); err != nil {
+			httpError(w, r, "AI 사용량 조회 실패", http.StatusInternalServerError)
+			return
+		}
+		resp.Days = append(resp.Days, d)
+	}
+	if err := rows.Err(); err != nil {
+		httpError(w, r, "AI 사용량 조회 실패", http.StatusInternalServerError)
+		return
+	}
+
+	endpointRows, err := db.QueryContext(r.Context(),
+		"SELECT endpoint, "+usageTotalsColumns+" FROM ai_usage WHERE user_id = ? AND created_at >= ? GROUP BY endpoint ORDER BY COUNT(*) DESC, endpoint",
+		userID, since,
+	)
+	if err != nil {
+		httpError(w, r, "AI 사용량 조회 실패", http.StatusInternalServerError)
+		return
+	}
+	defer endpointRows.Close()
+	for endpointRows.Next() {
+		var e UsageEndpoint
+		if err := endpointRows.Scan(append([]interface{}{&e.Endpoint}, e.scanDest()...)...); err != nil {
+			httpError(w, r, "AI 사용량 조회 실패", http.StatusInternalServerError)
+			return
+		}
+		resp.Endpoints = append(resp.Endpoints, e)
+	}
+	if err := endpointRows.Err(); err != nil {
+		httpError(w, r, "AI 사용량 조회 실패", http.StatusInternalServerError)
+		return
+	}
+
+	resp.Limits = map[string]UsageLimit{
+		"requests": usageLimit(int64(cfg.Usage.DailyRequests), resp.Today.Requests-resp.Today.Errors),
+		"tokens":   usageLimit(cfg.Usage.DailyTokens, resp.Today.InputTokens+resp.Today.OutputTokens),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func usageLimit(limit, used int64) UsageLimit {
+	u := UsageLimit{Max: limit, Used: used}
+	if limit > 0 {
+		remaining := max(limit-used, 0)
+		u.Remaining = &remaining
+	}
+	return u
+}